@@ -1,12 +1,28 @@
 import sys
 import time
-from os import chdir
+from os import chdir, environ
 
 from utils import execute_commands
 
 OS = ['darwin', 'linux', 'windows']
 ARCHS = ['386', 'amd64']
 
+# C compilers for cgo, which the SQLite driver of slangd needs. They can be overridden with CC_OS_ARCH,
+# e.g. CC_DARWIN_AMD64.
+CC = {
+    ('darwin', '386'): 'o32-clang',
+    ('darwin', 'amd64'): 'o64-clang',
+    ('linux', '386'): 'gcc -m32',
+    ('linux', 'amd64'): 'gcc',
+    ('windows', '386'): 'i686-w64-mingw32-gcc',
+    ('windows', 'amd64'): 'x86_64-w64-mingw32-gcc',
+}
+
+
+def cgo_env(os, arch):
+    cc = environ.get(f"CC_{os.upper()}_{arch.upper()}", CC[(os, arch)])
+    return f"CGO_ENABLED=1 CC=\"{cc}\""
+
 
 def build_slangd(version, b6k_cs_pw):
     versioned_dist = 'slangd-' + version.replace('.', '_')
@@ -25,7 +41,7 @@ def build_slangd(version, b6k_cs_pw):
                 compress_cmd = f"tar -czvf {filename}.tar.gz {filename_with_ending}"
 
             execute_commands([
-                f"env GOOS={os} GOARCH={arch} go build -ldflags \"{ldflags}\" -o ./ci/release/{filename_with_ending} ./cmd/slangd",
+                f"env GOOS={os} GOARCH={arch} {cgo_env(os, arch)} go build -ldflags \"{ldflags}\" -o ./ci/release/{filename_with_ending} ./cmd/slangd",
             ])
 
             if os == 'windows' and b6k_cs_pw:
@@ -58,7 +74,7 @@ def build_slang(version):
                 compress_cmd = f"tar -czvf {filename}.tar.gz {filename_with_ending}"
 
             execute_commands([
-                f"env GOOS={os} GOARCH={arch} go build -o ./ci/release/{filename_with_ending} ./cmd/slang",
+                f"env GOOS={os} GOARCH={arch} CGO_ENABLED=0 go build -o ./ci/release/{filename_with_ending} ./cmd/slang",
             ])
 
             chdir("./ci/release/")
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// operatorArgs holds the generics and properties an operator is run with
+type operatorArgs struct {
+	Generics   core.Generics   `json:"generics,omitempty" yaml:"generics,omitempty"`
+	Properties core.Properties `json:"properties,omitempty" yaml:"properties,omitempty"`
+}
+
+// readFile reads generics and properties from a YAML or JSON file
+func (a *operatorArgs) readFile(argsPath string) error {
+	b, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		return err
+	}
+
+	var fileArgs operatorArgs
+	if utils.IsJSON(argsPath) {
+		err = json.Unmarshal(b, &fileArgs)
+	} else {
+		err = yaml.Unmarshal(b, &fileArgs)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", argsPath, err)
+	}
+
+	for name, gen := range fileArgs.Generics {
+		a.Generics[name] = gen
+	}
+	for name, prop := range fileArgs.Properties {
+		a.Properties[name] = core.CleanValue(prop)
+	}
+	return nil
+}
+
+// parseGenerics parses generics given as name=type.
+// The type is either the name of a type without sub types such as "string" or a JSON type definition.
+func (a *operatorArgs) parseGenerics(gens []string) error {
+	for _, gen := range gens {
+		name, value, err := splitArg(gen)
+		if err != nil {
+			return err
+		}
+
+		var typeDef core.TypeDef
+		if strings.HasPrefix(value, "{") {
+			if err := json.Unmarshal([]byte(value), &typeDef); err != nil {
+				return fmt.Errorf("generic %s: %s", name, err)
+			}
+		} else {
+			typeDef = core.TypeDef{Type: value}
+		}
+
+		if err := typeDef.Validate(); err != nil {
+			return fmt.Errorf("generic %s: %s", name, err)
+		}
+
+		a.Generics[name] = &typeDef
+	}
+	return nil
+}
+
+// parseProperties parses properties given as name=value.
+// The value is parsed as JSON, if that fails it is taken as string.
+func (a *operatorArgs) parseProperties(props []string) error {
+	for _, prop := range props {
+		name, value, err := splitArg(prop)
+		if err != nil {
+			return err
+		}
+
+		var propVal interface{}
+		if err := json.Unmarshal([]byte(value), &propVal); err != nil {
+			propVal = value
+		}
+
+		a.Properties[name] = core.CleanValue(propVal)
+	}
+	return nil
+}
+
+// mergedWith returns the arguments of the bundle overridden by these arguments, the bundle stays unchanged
+// so that its signatures still match
+func (a *operatorArgs) mergedWith(bundle *core.SlangBundle) (core.Generics, core.Properties) {
+	gens := core.Generics{}
+	props := core.Properties{}
+	for name, gen := range bundle.Args.Generics {
+		gens[name] = gen
+	}
+	for name, prop := range bundle.Args.Properties {
+		props[name] = prop
+	}
+	for name, gen := range a.Generics {
+		gens[name] = gen
+	}
+	for name, prop := range a.Properties {
+		props[name] = prop
+	}
+	return gens, props
+}
+
+func splitArg(arg string) (string, string, error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("expected name=value: %s", arg)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperatorArgs_Parse(t *testing.T) {
+	a := assertions.New(t)
+
+	args := &operatorArgs{core.Generics{}, core.Properties{}}
+	a.NoError(args.parseGenerics([]string{"itemType=number", `mapType={"type": "map", "map": {"a": {"type": "string"}}}`}))
+	a.Equal("number", args.Generics["itemType"].Type)
+	a.Equal("map", args.Generics["mapType"].Type)
+	a.Equal("string", args.Generics["mapType"].Map["a"].Type)
+
+	a.NoError(args.parseProperties([]string{"count=3", "name=hello", `list=[1, 2]`, "expr=a=b"}))
+	a.Equal(3.0, args.Properties["count"])
+	a.Equal("hello", args.Properties["name"])
+	a.Equal([]interface{}{1.0, 2.0}, args.Properties["list"])
+	a.Equal("a=b", args.Properties["expr"])
+
+	a.Error(args.parseGenerics([]string{"itemType=unknown"}))
+	a.Error(args.parseProperties([]string{"=value"}))
+	a.Error(args.parseProperties([]string{"value"}))
+}
+
+func TestOperatorArgs_ReadFile(t *testing.T) {
+	a := assertions.New(t)
+
+	dir, err := ioutil.TempDir("", "slang-args")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "args.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("generics:\n  itemType:\n    type: string\nproperties:\n  count: 2\n"), 0644))
+
+	args := &operatorArgs{core.Generics{}, core.Properties{"count": 1.0, "other": true}}
+	a.NoError(args.readFile(file))
+	a.Equal("string", args.Generics["itemType"].Type)
+	a.Equal(2.0, args.Properties["count"])
+	a.Equal(true, args.Properties["other"])
+}
+
+func TestOperatorArgs_MergedWith(t *testing.T) {
+	a := assertions.New(t)
+
+	bundle := &core.SlangBundle{}
+	bundle.Args.Properties = core.Properties{"count": 1.0, "name": "bundle"}
+
+	args := &operatorArgs{core.Generics{"itemType": {Type: "number"}}, core.Properties{"count": 2.0}}
+	gens, props := args.mergedWith(bundle)
+	a.Equal(2.0, props["count"])
+	a.Equal("bundle", props["name"])
+	a.Equal("number", gens["itemType"].Type)
+	a.Equal(1.0, bundle.Args.Properties["count"])
+	a.Nil(bundle.Args.Generics)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ed25519"
+)
+
+func bundleCommand() *command {
+	cmd := newCommand("bundle", "[BLUEPRINT...]", "Creates self-contained JSON slang bundles which can be run by 'slang run'", nil)
+
+	outDir := cmd.flags.String("outdir", "./", "Output location of the bundle files")
+	all := cmd.flags.Bool("all", false, "Bundle all blueprints of the storage")
+	signKey := cmd.flags.String("sign", "", "Name of the key the bundles are signed with")
+	kr := addKeysFlag(cmd)
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		st := stCfg.open()
+
+		var ids []uuid.UUID
+		var err error
+		if *all {
+			ids, err = st.List()
+		} else if len(args) > 0 {
+			ids, err = resolveBlueprintIds(st, args)
+		} else {
+			err = errors.New("missing blueprint")
+		}
+		if err != nil {
+			return err
+		}
+
+		var priv ed25519.PrivateKey
+		if *signKey != "" {
+			if priv, err = kr.privateKey(*signKey); err != nil {
+				return err
+			}
+		}
+
+		if _, err := utils.EnsureDirExists(*outDir); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			blueprint, err := st.Load(id)
+			if err != nil {
+				return err
+			}
+
+			b, err := api.CreateBundle(blueprint, st)
+			if err != nil {
+				return fmt.Errorf("%s: %s", id, err)
+			}
+
+			if priv != nil {
+				if err := api.SignBundle(b, priv); err != nil {
+					return fmt.Errorf("%s: %s", id, err)
+				}
+			}
+
+			bundlePath := filepath.Join(*outDir, id.String()+".slang.json")
+			if err := writeSlangBundle(bundlePath, b); err != nil {
+				return err
+			}
+
+			fmt.Println(bundlePath)
+		}
+
+		fmt.Printf("%d blueprints have been bundled\n", len(ids))
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+)
+
+func checkCommand() *command {
+	cmd := newCommand("check", "[BLUEPRINT...]", "Validates blueprints and their dependencies, all local blueprints if none are given", nil)
+
+	strict := cmd.flags.Bool("strict", false, "Also validate the meta information such as name, description and tags")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		st := stCfg.open()
+
+		var ids []uuid.UUID
+		var err error
+		if len(args) == 0 {
+			ids, err = localBlueprintIds(st)
+		} else {
+			ids, err = resolveBlueprintIds(st, args)
+		}
+		if err != nil {
+			return err
+		}
+
+		fails := 0
+		for _, id := range ids {
+			name, err := checkBlueprint(st, id, *strict)
+			if err != nil {
+				fails++
+				fmt.Printf("FAIL %s %s: %s\n", id, name, err)
+			} else {
+				fmt.Printf("OK   %s %s\n", id, name)
+			}
+		}
+
+		if fails > 0 {
+			return fmt.Errorf("%d of %d blueprints are invalid", fails, len(ids))
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func checkBlueprint(st *storage.Storage, id uuid.UUID, strict bool) (string, error) {
+	blueprint, err := st.Load(id)
+	if err != nil {
+		return "", err
+	}
+
+	if err := blueprint.Validate(); err != nil {
+		return blueprint.Meta.Name, err
+	}
+
+	if strict {
+		if err := blueprint.Meta.Validate(); err != nil {
+			return blueprint.Meta.Name, err
+		}
+	}
+
+	// Creating a bundle loads and validates all dependencies
+	if _, err := api.CreateBundle(blueprint, st); err != nil {
+		return blueprint.Meta.Name, err
+	}
+
+	// Blueprints without generics and properties must also compile
+	if len(blueprint.PropertyDefs) == 0 && blueprint.GenericsSpecified() == nil {
+		if _, err := api.BuildAndCompile(id, core.Generics{}, core.Properties{}, *st); err != nil {
+			return blueprint.Meta.Name, err
+		}
+	}
+
+	return blueprint.Meta.Name, nil
+}
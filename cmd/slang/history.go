@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/tabwriter"
+
+	"github.com/Bitspark/slang/pkg/storage"
+)
+
+var authorPattern = regexp.MustCompile(`^\s*(.*?)\s*<(.+)>\s*$`)
+
+// parseAuthor reads an author given like "Name <email>"
+func parseAuthor(s string) (storage.GitAuthor, error) {
+	m := authorPattern.FindStringSubmatch(s)
+	if m == nil || m[1] == "" {
+		return storage.GitAuthor{}, fmt.Errorf("invalid author, expected \"Name <email>\": %s", s)
+	}
+	return storage.GitAuthor{Name: m[1], Email: m[2]}, nil
+}
+
+func historyCommand() *command {
+	cmd := newCommand("history", "BLUEPRINT [REVISION]",
+		"Lists the revisions of a blueprint kept in a git repository, prints or reverts to a revision", nil)
+
+	revert := cmd.flags.Bool("revert", false, "Save the blueprint as it has been at the revision")
+	author := cmd.flags.String("author", fmt.Sprintf("%s <%s>", storage.DefaultGitAuthor.Name, storage.DefaultGitAuthor.Email),
+		"Author of the revert commit")
+	asJSON := cmd.flags.Bool("json", false, "Print as JSON instead of YAML")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		if len(args) == 0 || len(args) > 2 {
+			return errors.New("missing blueprint")
+		}
+		if *revert && len(args) != 2 {
+			return errors.New("missing revision")
+		}
+		if _, err := os.Stat(filepath.Join(stCfg.dir, ".git")); err != nil {
+			return fmt.Errorf("%s is not a git repository", stCfg.dir)
+		}
+		gitAuthor, err := parseAuthor(*author)
+		if err != nil {
+			return err
+		}
+		repo, err := storage.NewGitRepository(stCfg.dir, gitAuthor)
+		if err != nil {
+			return err
+		}
+		st := stCfg.open().WithWritableBackend(repo)
+
+		id, err := resolveBlueprintId(st, args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			revisions, err := st.History(id)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "REVISION\tTIME\tAUTHOR\tMESSAGE")
+			for _, rev := range revisions {
+				fmt.Fprintf(w, "%s\t%s\t%s <%s>\t%s\n", rev.Hash, rev.Time.Format("2006-01-02 15:04:05"), rev.Author.Name, rev.Author.Email, rev.Message)
+			}
+			return w.Flush()
+		}
+
+		if *revert {
+			blueprint, err := st.Revert(id, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("reverted %s (%s) to %s\n", blueprint.Meta.Name, id, args[1])
+			return nil
+		}
+
+		blueprint, err := st.LoadRevision(id, args[1])
+		if err != nil {
+			return err
+		}
+		return printBlueprint(blueprint, *asJSON)
+	}
+
+	return cmd
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/tests/assertions"
+)
+
+func TestParseAuthor(t *testing.T) {
+	a := assertions.New(t)
+
+	author, err := parseAuthor("Alice Smith <alice@example.com>")
+	a.NoError(err)
+	a.Equal(storage.GitAuthor{Name: "Alice Smith", Email: "alice@example.com"}, author)
+
+	_, err = parseAuthor("alice@example.com")
+	a.Error(err)
+	_, err = parseAuthor("<alice@example.com>")
+	a.Error(err)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/utils"
+	"golang.org/x/crypto/ed25519"
+)
+
+// keyring is the directory of the own keys NAME.key and NAME.pub, trusted public keys are kept in trusted/
+type keyring struct {
+	dir string
+}
+
+func addKeysFlag(cmd *command) *keyring {
+	kr := &keyring{}
+	cmd.flags.StringVar(&kr.dir, "keys", slangPath("SLANG_KEYS", "keys"), "Directory of the signing keys and trusted/ public keys, $SLANG_KEYS if set")
+	return kr
+}
+
+func (kr *keyring) trustedDir() string {
+	return filepath.Join(kr.dir, "trusted")
+}
+
+func (kr *keyring) privateKey(name string) (ed25519.PrivateKey, error) {
+	return api.ReadPrivateKey(filepath.Join(kr.dir, name+".key"))
+}
+
+func (kr *keyring) trustedKeys() ([]ed25519.PublicKey, error) {
+	return api.ReadTrustedKeys(kr.trustedDir())
+}
+
+// generate creates a new key pair, its public key is trusted
+func (kr *keyring) generate(name string) (ed25519.PublicKey, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid key name: %s", name)
+	}
+	keyFile := filepath.Join(kr.dir, name+".key")
+	if _, err := os.Stat(keyFile); err == nil {
+		return nil, fmt.Errorf("key %s already exists", name)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := utils.EnsureDirExists(kr.trustedDir()); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, api.EncodePrivateKey(priv), 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(kr.dir, name+".pub"), api.EncodePublicKey(pub), 0644); err != nil {
+		return nil, err
+	}
+	return pub, ioutil.WriteFile(filepath.Join(kr.trustedDir(), name+".pub"), api.EncodePublicKey(pub), 0644)
+}
+
+// trust copies the public key file into the trusted keys
+func (kr *keyring) trust(file string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := api.ParsePublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if _, err := utils.EnsureDirExists(kr.trustedDir()); err != nil {
+		return nil, err
+	}
+	return pub, ioutil.WriteFile(filepath.Join(kr.trustedDir(), filepath.Base(file)), b, 0644)
+}
+
+func (kr *keyring) list() error {
+	own, err := filepath.Glob(filepath.Join(kr.dir, "*.pub"))
+	if err != nil {
+		return err
+	}
+	trusted, err := filepath.Glob(filepath.Join(kr.trustedDir(), "*.pub"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(own)
+	sort.Strings(trusted)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tKIND")
+	for _, entry := range []struct {
+		kind  string
+		files []string
+	}{{"own", own}, {"trusted", trusted}} {
+		for _, file := range entry.files {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			pub, err := api.ParsePublicKey(b)
+			if err != nil {
+				return fmt.Errorf("%s: %s", file, err)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", strings.TrimSuffix(filepath.Base(file), ".pub"), api.KeyId(pub), entry.kind)
+		}
+	}
+	return w.Flush()
+}
+
+func keyCommand() *command {
+	cmd := newCommand("key", "generate|list|trust|sign|verify [ARGS]", "Manages the keys slang bundles are signed with:\n\n"+
+		"  generate NAME      Creates the key pair NAME.key and NAME.pub, the public key is trusted\n"+
+		"  list               Lists the own and the trusted keys\n"+
+		"  trust FILE.pub     Trusts bundles signed with the key of the public key file\n"+
+		"  sign BUNDLE...     Signs slang bundles with the key given by -key\n"+
+		"  verify BUNDLE...   Verifies the signatures of slang bundles against the trusted keys", nil)
+
+	kr := addKeysFlag(cmd)
+	keyName := cmd.flags.String("key", "", "Name of the key sign uses")
+
+	cmd.run = func(args []string) error {
+		if len(args) == 0 {
+			return errors.New("missing subcommand")
+		}
+
+		switch args[0] {
+		case "generate":
+			if len(args) != 2 {
+				return errors.New("expecting a key name")
+			}
+			pub, err := kr.generate(args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("generated key %s (%s)\n", args[1], api.KeyId(pub))
+			return nil
+		case "list":
+			return kr.list()
+		case "trust":
+			if len(args) != 2 {
+				return errors.New("expecting a public key file")
+			}
+			pub, err := kr.trust(args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("trusted key %s\n", api.KeyId(pub))
+			return nil
+		case "sign":
+			if *keyName == "" {
+				return errors.New("missing -key")
+			}
+			priv, err := kr.privateKey(*keyName)
+			if err != nil {
+				return err
+			}
+			for _, file := range args[1:] {
+				bundle, err := readSlangBundleJSON(file)
+				if err != nil {
+					return fmt.Errorf("%s: %s", file, err)
+				}
+				if err := api.SignBundle(bundle, priv); err != nil {
+					return fmt.Errorf("%s: %s", file, err)
+				}
+				if err := writeSlangBundle(file, bundle); err != nil {
+					return err
+				}
+				fmt.Println(file)
+			}
+			return nil
+		case "verify":
+			trusted, err := kr.trustedKeys()
+			if err != nil {
+				return err
+			}
+			policy := api.TrustPolicy{RequireSignature: true, TrustedKeys: trusted}
+			failed := 0
+			for _, file := range args[1:] {
+				bundle, err := readSlangBundleJSON(file)
+				if err == nil {
+					err = policy.Check(bundle)
+				}
+				if err != nil {
+					fmt.Printf("%s: %s\n", file, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: ok\n", file)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d bundles failed verification", failed)
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown subcommand: %s", args[0])
+		}
+	}
+
+	return cmd
+}
+
+func writeSlangBundle(file string, bundle *core.SlangBundle) error {
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, os.ModePerm)
+}
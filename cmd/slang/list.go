@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func listCommand() *command {
+	cmd := newCommand("list", "", "Lists the blueprints of the storage", nil)
+
+	withElems := cmd.flags.Bool("elems", false, "Also list elementary blueprints")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		entries, err := listBlueprints(stCfg.open(), *withElems)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tDESCRIPTION")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.blueprint.Id, e.blueprint.Meta.Name, e.kind, e.blueprint.Meta.ShortDescription)
+		}
+		return w.Flush()
+	}
+
+	return cmd
+}
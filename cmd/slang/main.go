@@ -1,189 +1,102 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	"github.com/Bitspark/go-funk"
-	"github.com/Bitspark/slang/pkg/api"
-	"github.com/Bitspark/slang/pkg/core"
 	"github.com/Bitspark/slang/pkg/log"
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 )
 
-var SupportedRunModes = []string{"process", "httpPost"}
-
-func main() {
-	runMode := flag.String("mode", SupportedRunModes[0], fmt.Sprintf("Choose run mode for operator: %s", SupportedRunModes))
-	bind := flag.String("bind", "localhost:0", "To which address httpPost should bind")
-	help := flag.Bool("h", false, "Show help")
-	flag.Parse()
-
-	if *help {
-		fmt.Println("slang OPTIONS SLANG_BUNDLE")
-		flag.PrintDefaults()
-	}
-
-	slangBundlePath := flag.Arg(0)
-
-	if slangBundlePath == "" {
-		log.Fatal("missing slang bundle file")
-	}
-
-	if !funk.ContainsString(SupportedRunModes, *runMode) {
-		log.Fatalf("invalid run mode: %s must be one of following %s", *runMode, SupportedRunModes)
-	}
-
-	slBundle, err := readSlangBundleJSON(slangBundlePath)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	blueprint, err := api.BuildOperator(slBundle)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.SetBlueprint(blueprint.Id(), blueprint.Name())
+// command is a single subcommand of the slang CLI such as `slang run` or `slang test`
+type command struct {
+	name  string
+	args  string
+	short string
+	flags *flag.FlagSet
+	run   func(args []string) error
+}
 
-	if err := run(blueprint, *runMode, *bind); err != nil {
-		log.Fatal(err)
-	}
+var commands []*command
 
+func newCommand(name string, args string, short string, run func(args []string) error) *command {
+	cmd := &command{name: name, args: args, short: short, run: run}
+	cmd.flags = flag.NewFlagSet(name, flag.ExitOnError)
+	cmd.flags.Usage = cmd.usage
+	return cmd
 }
 
-func readSlangBundleJSON(slBundlePath string) (*core.SlangBundle, error) {
-	slBundleContent, err := ioutil.ReadFile(slBundlePath)
+func (c *command) usage() {
+	fmt.Fprintf(os.Stderr, "Usage: slang %s [OPTIONS] %s\n\n%s\n\nOptions:\n", c.name, c.args, c.short)
+	c.flags.PrintDefaults()
+}
 
-	if err != nil {
-		return nil, err
+func (c *command) execute(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
 	}
-
-	var slFile core.SlangBundle
-	err = json.Unmarshal([]byte(slBundleContent), &slFile)
-	return &slFile, err
+	return c.run(c.flags.Args())
 }
 
-func run(operator *core.Operator, mode string, bind string) error {
-	switch mode {
-	case "process":
-		runProcess(operator)
-	case "httpPost":
-		runHttpPost(operator, bind)
-	default:
-		log.Fatal("Run mode not supported: %s", mode)
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: slang COMMAND [OPTIONS] [ARGS]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.short)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'slang COMMAND -h' for more information on a command.")
+}
 
-	// Handle SIGTERM (CTRL-C)
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-
-	for {
-		select {
-		case <-quit:
-			return nil
-		case <-time.After(5 * time.Second):
-			log.Ping()
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
 	}
+	return nil
 }
 
-func runProcess(operator *core.Operator) {
-	operator.Main().Out().Bufferize()
-	operator.Start()
-	log.Print("started as process mode")
-
-	if isQuasiTrigger(operator.Main().In()) {
-		operator.Main().In().Push(true)
+func main() {
+	commands = []*command{
+		runCommand(),
+		testCommand(),
+		bundleCommand(),
+		checkCommand(),
+		listCommand(),
+		showCommand(),
+		historyCommand(),
+		newBlueprintCommand(),
+		pkgCommand(),
+		keyCommand(),
 	}
-}
-
-func runHttpPost(operator *core.Operator, bind string) {
-	inDef := operator.Main().In().Define()
-
-	r := mux.NewRouter()
-	r.
-		Methods("POST").
-		HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-			var incoming interface{}
-
-			err := json.NewDecoder(req.Body).Decode(&incoming)
-			switch {
-			// We do not have a POST-Body but we could still serve a result
-			// for the case when the `In` is a trigger.
-			case err == io.EOF:
-				if isQuasiTrigger(operator.Main().In()) {
-					operator.Main().In().Push(true)
-					outgoing := operator.Main().Out().Pull()
-					responseWithOk(resp, outgoing)
-				} else {
-					responseWithError(resp, errors.New("Missing data"), http.StatusBadRequest)
-				}
-			// We have an error while decoding the response
-			case err != nil:
-				responseWithError(resp, err, http.StatusBadRequest)
-
-			// Everything is fine, validate the values and pass it to the running operator
-			default:
-				incoming = core.CleanValue(incoming)
-				if err := inDef.VerifyData(incoming); err != nil {
-					responseWithError(resp, err, http.StatusBadRequest)
-					return
-				}
-				operator.Main().In().Push(incoming)
-				outgoing := operator.Main().Out().Pull()
-				responseWithOk(resp, outgoing)
-			}
 
-		})
-
-	handler := cors.New(cors.Options{
-		AllowedMethods: []string{"POST"},
-	}).Handler(r)
-
-	operator.Main().Out().Bufferize()
-	operator.Start()
-	log.Print("started as httpPost")
-	go func() {
-		log.Fatal(http.ListenAndServe(bind, handler))
-	}()
-}
+	flag.Usage = usage
+	flag.Parse()
 
-func isQuasiTrigger(p *core.Port) bool {
-	// port is quasi a trigger,
-	// when it actually is a trigger port or
-	// it is a map with in total one sub-port of trigger type
-	return p.TriggerType() || p.MapType() && p.MapLength() == 1 && p.Map(p.MapEntryNames()[0]).TriggerType()
-}
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
 
-func responseWithError(w http.ResponseWriter, err error, status int) {
-	log.Error(err)
+	if flag.Arg(0) == "help" {
+		if cmd := findCommand(flag.Arg(1)); cmd != nil {
+			cmd.usage()
+		} else {
+			usage()
+		}
+		return
+	}
 
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(err.Error()); err != nil {
-		log.Fatal(err)
+	cmd := findCommand(flag.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
 	}
-}
 
-func responseWithOk(w http.ResponseWriter, m interface{}) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(m); err != nil {
+	if err := cmd.execute(flag.Args()[1:]); err != nil {
 		log.Fatal(err)
 	}
 }
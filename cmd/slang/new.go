@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/google/uuid"
+)
+
+func newBlueprintCommand() *command {
+	cmd := newCommand("new", "NAME", "Creates a new blueprint in the writable directory", nil)
+
+	shortDesc := cmd.flags.String("description", "", "Short description of the blueprint")
+	tags := cmd.flags.String("tags", "", "Comma separated list of tags")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("missing blueprint name")
+		}
+
+		blueprint := core.Blueprint{
+			Id: uuid.New(),
+			Meta: core.BlueprintMetaDef{
+				Name:             args[0],
+				ShortDescription: *shortDesc,
+			},
+			ServiceDefs: map[string]*core.ServiceDef{
+				core.MAIN_SERVICE: {
+					In:  core.TypeDef{Type: "trigger"},
+					Out: core.TypeDef{Type: "trigger"},
+				},
+			},
+			Connections: map[string][]string{
+				"(": {")"},
+			},
+		}
+
+		for _, tag := range strings.Split(*tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				blueprint.Meta.Tags = append(blueprint.Meta.Tags, tag)
+			}
+		}
+
+		if err := blueprint.Validate(); err != nil {
+			return err
+		}
+
+		id, err := stCfg.open().Save(blueprint)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(id)
+		return nil
+	}
+
+	return cmd
+}
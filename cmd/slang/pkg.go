@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Bitspark/slang/pkg/packages"
+)
+
+func pkgCommand() *command {
+	cmd := newCommand("pkg", "install|remove|list|pack [ARGS]", "Manages packages of blueprints:\n\n"+
+		"  install NAME[@CONSTRAINT]|ARCHIVE  Installs a package and its dependencies from the registry\n"+
+		"  remove NAME                        Removes an installed package\n"+
+		"  list                               Lists the installed packages, with -available the ones of the registry\n"+
+		"  pack DIR                           Creates a package archive in the registry from a package directory", nil)
+
+	registryDir := cmd.flags.String("registry", slangPath("SLANG_REGISTRY", "registry"), "Directory of package archives, $SLANG_REGISTRY if set")
+	packagesDir := cmd.flags.String("packages", slangPath("SLANG_PACKAGES", "packages"), "Directory of the installed packages, $SLANG_PACKAGES if set")
+	force := cmd.flags.Bool("force", false, "Remove packages even if installed packages depend on them")
+	available := cmd.flags.Bool("available", false, "List the packages of the registry")
+
+	cmd.run = func(args []string) error {
+		if len(args) == 0 {
+			return errors.New("missing subcommand")
+		}
+		reg := packages.NewRegistry(*registryDir)
+		lib := packages.NewLibrary(*packagesDir)
+
+		switch args[0] {
+		case "install":
+			if len(args) != 2 {
+				return errors.New("expecting a package name or archive")
+			}
+			var installed []*packages.Manifest
+			var err error
+			if strings.HasSuffix(args[1], ".zip") {
+				installed, err = lib.InstallArchive(reg, args[1])
+			} else {
+				name, constraint := splitPackageArg(args[1])
+				installed, err = lib.Install(reg, name, constraint)
+			}
+			for _, m := range installed {
+				fmt.Printf("installed %s\n", m)
+			}
+			return err
+		case "remove":
+			if len(args) != 2 {
+				return errors.New("expecting a package name")
+			}
+			return lib.Remove(args[1], *force)
+		case "list":
+			var manifests []*packages.Manifest
+			var err error
+			if *available {
+				manifests, err = reg.Packages()
+			} else {
+				manifests, err = lib.Installed()
+			}
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tBLUEPRINTS\tDESCRIPTION")
+			for _, m := range manifests {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", m.Name, m.Version, len(m.Blueprints), m.Description)
+			}
+			return w.Flush()
+		case "pack":
+			if len(args) != 2 {
+				return errors.New("expecting a package directory")
+			}
+			m, file, err := packages.Pack(args[1], *registryDir)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("packed %s into %s\n", m, file)
+			return nil
+		default:
+			return fmt.Errorf("unknown subcommand: %s", args[0])
+		}
+	}
+
+	return cmd
+}
+
+// splitPackageArg splits NAME@CONSTRAINT, the constraint is empty if not given
+func splitPackageArg(arg string) (string, string) {
+	if i := strings.Index(arg, "@"); i >= 0 {
+		return arg[:i], arg[i+1:]
+	}
+	return arg, ""
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/log"
+	"github.com/Bitspark/slang/pkg/queue"
+)
+
+// How many messages are processed at the same time in queue mode if no -max-concurrency is given
+const defaultQueuePrefetch = 16
+
+type queueJob struct {
+	msg    *queue.Message
+	result chan queueResult
+}
+
+type queueResult struct {
+	outgoing interface{}
+	err      error
+	// Invalid messages are dropped, other errors stop the worker without acknowledging the message
+	drop bool
+}
+
+// runQueue consumes input items from one queue and publishes the output items to another queue.
+// Messages are acknowledged in the order they have been received after their output item has been published,
+// messages which are no valid input items are logged and acknowledged.
+func runQueue(operator *core.Operator, inURL string, outURL string, limits callLimits) error {
+	if inURL == "" || outURL == "" {
+		return errors.New("queue mode requires -in and -out")
+	}
+
+	consumer, err := queue.OpenConsumer(inURL)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	producer, err := queue.OpenProducer(outURL)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	prefetch := limits.maxConcurrency
+	if prefetch <= 0 {
+		prefetch = defaultQueuePrefetch
+	}
+
+	// The size of the jobs channel limits the items in flight, at most prefetch items are processed at the same time.
+	// Together with the job being published up to prefetch+1 items wait for the correlator, which never rejects them.
+	ep := newServiceEndpoint(core.MAIN_SERVICE, operator.Main(), callLimits{maxConcurrency: prefetch, queueSize: prefetch})
+	operator.Start()
+	log.Printf("started as queue worker consuming %s", inURL)
+
+	jobs := make(chan *queueJob, prefetch)
+	stop := make(chan bool)
+	defer close(stop)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- receiveJobs(consumer, ep, jobs, stop)
+	}()
+	go func() {
+		errs <- publishResults(jobs, producer)
+	}()
+	return <-errs
+}
+
+func receiveJobs(consumer queue.Consumer, ep *serviceEndpoint, jobs chan *queueJob, stop chan bool) error {
+	defer close(jobs)
+	for {
+		msg, err := consumer.Receive()
+		if err != nil {
+			return err
+		}
+
+		job := &queueJob{msg, make(chan queueResult, 1)}
+		select {
+		case jobs <- job:
+		case <-stop:
+			return nil
+		}
+
+		go func() {
+			incoming, err := ep.decode(job.msg.Data)
+			if err != nil {
+				job.result <- queueResult{nil, err, true}
+				return
+			}
+			outgoing, err := ep.call(context.Background(), incoming)
+			job.result <- queueResult{outgoing, err, false}
+		}()
+	}
+}
+
+func publishResults(jobs chan *queueJob, producer queue.Producer) error {
+	for job := range jobs {
+		res := <-job.result
+		if res.err != nil && !res.drop {
+			return res.err
+		} else if res.err != nil {
+			log.Errorf("dropping message: %s", res.err)
+		} else {
+			data, err := json.Marshal(res.outgoing)
+			if err != nil {
+				return err
+			}
+			if err := producer.Publish(data); err != nil {
+				return err
+			}
+		}
+
+		if err := job.msg.Ack(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
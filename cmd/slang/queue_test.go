@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/queue"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueMode__PublishesOutputsInOrder(t *testing.T) {
+	a := assertions.New(t)
+
+	dir, err := ioutil.TempDir("", "slang-queue-mode")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in, err := queue.NewFileQueue(filepath.Join(dir, "in"))
+	require.NoError(t, err)
+	out, err := queue.NewFileQueue(filepath.Join(dir, "out"))
+	require.NoError(t, err)
+	defer out.Close()
+
+	for _, data := range []string{"1", `"invalid"`, "2", "3"} {
+		require.NoError(t, in.Publish([]byte(data)))
+	}
+
+	op := newPassOperator(t)
+	// Processes one item at a time like runQueue with -max-concurrency 1
+	ep := newServiceEndpoint(core.MAIN_SERVICE, op.Main(), callLimits{maxConcurrency: 1, queueSize: 1})
+	op.Start()
+
+	jobs := make(chan *queueJob, 1)
+	stop := make(chan bool)
+	defer close(stop)
+	received := make(chan error, 1)
+	published := make(chan error, 1)
+	go func() {
+		received <- receiveJobs(in, ep, jobs, stop)
+	}()
+	go func() {
+		published <- publishResults(jobs, out)
+	}()
+
+	// Invalid items are dropped
+	for _, data := range []string{"1", "2", "3"} {
+		msg, err := out.Receive()
+		require.NoError(t, err)
+		a.Equal(data, string(msg.Data))
+		a.NoError(msg.Ack())
+	}
+
+	// Closing the input queue ends the worker
+	in.Close()
+	a.Equal(queue.ErrClosed, <-received)
+	a.NoError(<-published)
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Bitspark/go-funk"
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/log"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+)
+
+var SupportedRunModes = []string{"process", "httpPost", "serve", "queue"}
+
+func runCommand() *command {
+	cmd := newCommand("run", "SLANG_BUNDLE|BLUEPRINT", "Runs a JSON slang bundle, a blueprint file or a blueprint from the storage.\n"+
+		"In process mode input items are read as JSON lines from stdin and output items are written as JSON lines to stdout.\n"+
+		"In serve mode each service is exposed as HTTP/JSON endpoint /services/SERVICE and optionally as JSON-over-gRPC method, "+
+		"the OpenAPI document is served at /openapi.json.\n"+
+		"In queue mode input items are consumed from the queue -in and output items are published to the queue -out, "+
+		"queues are given as file:///DIR, kafka://BROKERS/TOPIC?group=GROUP, redis://HOST:PORT/LIST or mqtt://HOST:PORT/TOPIC.", nil)
+
+	runMode := cmd.flags.String("mode", SupportedRunModes[0], fmt.Sprintf("Choose run mode for operator: %s", SupportedRunModes))
+	bind := cmd.flags.String("bind", "localhost:0", "To which address httpPost and serve should bind")
+	grpcBind := cmd.flags.String("grpc", "", "To which address serve should bind its JSON-over-gRPC server (JSON messages, no protocol buffers), no gRPC server if empty")
+	inQueue := cmd.flags.String("in", "", "Queue from which queue mode consumes input items")
+	outQueue := cmd.flags.String("out", "", "Queue to which queue mode publishes output items")
+	var limits callLimits
+	cmd.flags.IntVar(&limits.maxConcurrency, "max-concurrency", 0, "How many requests httpPost and serve process at the same time per service, 0 means unlimited. "+
+		"How many messages queue mode processes at the same time, defaults to 16")
+	cmd.flags.IntVar(&limits.queueSize, "queue", 100, "How many further requests wait before requests are rejected, only with -max-concurrency")
+	argsFile := cmd.flags.String("args", "", "YAML/JSON file containing generics and properties")
+	var gens, props stringList
+	cmd.flags.Var(&gens, "gen", "Generic as name=type, type is a type name or a JSON type definition, can be given multiple times")
+	cmd.flags.Var(&props, "prop", "Property as name=value, value is JSON or a plain string, can be given multiple times")
+	stCfg := addStorageFlags(cmd.flags)
+	requireSignature := cmd.flags.Bool("require-signature", false, "Only run slang bundles signed by a trusted key")
+	kr := addKeysFlag(cmd)
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("missing slang bundle file or blueprint")
+		}
+
+		var policy api.TrustPolicy
+		if *requireSignature {
+			if *argsFile != "" || len(gens) > 0 || len(props) > 0 {
+				return errors.New("-args, -gen and -prop cannot be used with -require-signature, the arguments of the bundle are signed")
+			}
+			trusted, err := kr.trustedKeys()
+			if err != nil {
+				return err
+			}
+			policy = api.TrustPolicy{RequireSignature: true, TrustedKeys: trusted}
+		}
+
+		if !funk.ContainsString(SupportedRunModes, *runMode) {
+			return fmt.Errorf("invalid run mode: %s must be one of following %s", *runMode, SupportedRunModes)
+		}
+
+		opArgs := &operatorArgs{core.Generics{}, core.Properties{}}
+		if *argsFile != "" {
+			if err := opArgs.readFile(*argsFile); err != nil {
+				return err
+			}
+		}
+		if err := opArgs.parseGenerics(gens); err != nil {
+			return err
+		}
+		if err := opArgs.parseProperties(props); err != nil {
+			return err
+		}
+
+		operator, err := buildRunOperator(stCfg, args[0], opArgs, policy)
+		if err != nil {
+			return err
+		}
+
+		log.SetBlueprint(operator.Id(), operator.Name())
+
+		if *runMode == "queue" {
+			return runQueueMode(operator, *inQueue, *outQueue, limits)
+		}
+		return run(operator, *runMode, *bind, *grpcBind, limits)
+	}
+
+	return cmd
+}
+
+// buildRunOperator builds the operator from a slang bundle file, a blueprint file or a blueprint of the storage
+func buildRunOperator(stCfg *storageConfig, arg string, opArgs *operatorArgs, policy api.TrustPolicy) (*core.Operator, error) {
+	st := stCfg.open()
+
+	if _, err := os.Stat(arg); err == nil && (utils.IsJSON(arg) || utils.IsYAML(arg)) {
+		if slBundle, err := readSlangBundleJSON(arg); err == nil {
+			gens, props := opArgs.mergedWith(slBundle)
+			return api.BuildOperatorWithArgs(slBundle, policy, gens, props)
+		}
+		if policy.RequireSignature {
+			return nil, errors.New("only signed slang bundles can be run when signatures are required")
+		}
+
+		blueprint, err := readBlueprintFile(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		// Dependencies lying next to the blueprint file take precedence
+		st = storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem(filepath.Dir(arg)))
+		for _, backend := range stCfg.backends() {
+			st.AddBackend(backend)
+		}
+
+		return api.BuildAndCompile(blueprint.Id, opArgs.Generics, opArgs.Properties, *st)
+	}
+
+	if policy.RequireSignature {
+		return nil, errors.New("only signed slang bundles can be run when signatures are required")
+	}
+
+	id, err := resolveBlueprintId(st, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.BuildAndCompile(id, opArgs.Generics, opArgs.Properties, *st)
+}
+
+func readSlangBundleJSON(slBundlePath string) (*core.SlangBundle, error) {
+	if !utils.IsJSON(slBundlePath) {
+		return nil, errors.New("slang bundles must be JSON files")
+	}
+
+	slBundleContent, err := ioutil.ReadFile(slBundlePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var slFile core.SlangBundle
+	if err = json.Unmarshal([]byte(slBundleContent), &slFile); err != nil {
+		return nil, err
+	}
+	if slFile.Main == uuid.Nil || len(slFile.Blueprints) == 0 {
+		return nil, errors.New("not a slang bundle")
+	}
+	return &slFile, nil
+}
+
+func readBlueprintFile(blueprintPath string) (*core.Blueprint, error) {
+	b, err := ioutil.ReadFile(blueprintPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var blueprint core.Blueprint
+	if utils.IsYAML(blueprintPath) {
+		blueprint, err = core.ParseYAMLOperatorDef(string(b))
+	} else {
+		blueprint, err = core.ParseJSONOperatorDef(string(b))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &blueprint, blueprint.Validate()
+}
+
+// callLimits restrict how many requests are processed by an operator service resp. wait for being processed
+type callLimits struct {
+	maxConcurrency int
+	queueSize      int
+}
+
+func run(operator *core.Operator, mode string, bind string, grpcBind string, limits callLimits) error {
+	// Handle SIGTERM (CTRL-C)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	switch mode {
+	case "process":
+		done := make(chan error, 1)
+		go func() {
+			done <- runProcess(operator, os.Stdin, os.Stdout)
+		}()
+		return waitForQuit(quit, done)
+	case "httpPost":
+		runHttpPost(operator, bind, limits)
+	case "serve":
+		if err := runServe(operator, bind, grpcBind, limits); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("run mode not supported: %s", mode)
+	}
+
+	return waitForQuit(quit, nil)
+}
+
+func runQueueMode(operator *core.Operator, inURL string, outURL string, limits callLimits) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runQueue(operator, inURL, outURL, limits)
+	}()
+	return waitForQuit(quit, done)
+}
+
+func waitForQuit(quit chan os.Signal, done chan error) error {
+	for {
+		select {
+		case <-quit:
+			return nil
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			log.Ping()
+		}
+	}
+}
+
+// runProcess reads input items as JSON lines from the reader and writes each output item as JSON line to the writer.
+// Output items are written as soon as they are emitted, so items can be streamed through the operator.
+// It returns after all input items have been processed and their output items have been written.
+// If the operator has a trigger as input and the reader is a terminal it is triggered once and runs until it is quit,
+// if the reader gives no items it is triggered once and runs until it emits its output item.
+func runProcess(operator *core.Operator, r io.Reader, w io.Writer) error {
+	in := operator.Main().In()
+	inDef := in.Define()
+
+	operator.Main().Out().Bufferize()
+	operator.Start()
+	log.Print("started as process mode")
+
+	written := newOutputCounter()
+	writerDone := make(chan bool)
+	go func() {
+		writeOutputs(operator.Main().Out(), w, written)
+		close(writerDone)
+	}()
+	defer func() {
+		operator.Stop()
+		<-writerDone
+	}()
+
+	if isQuasiTrigger(in) && isTerminal(r) {
+		in.Push(true)
+		select {}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	pushed := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var incoming interface{}
+		if err := json.Unmarshal(data, &incoming); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+
+		incoming = core.CleanValue(incoming)
+		if err := inDef.VerifyData(incoming); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+
+		in.Push(incoming)
+		pushed++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if pushed == 0 && isQuasiTrigger(in) {
+		in.Push(true)
+		pushed++
+	}
+
+	// The main service emits exactly one output item per input item
+	written.waitFor(pushed)
+	return nil
+}
+
+// outputCounter counts the output items which have been written
+type outputCounter struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	written int
+}
+
+func newOutputCounter() *outputCounter {
+	c := &outputCounter{}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+func (c *outputCounter) inc() {
+	c.mutex.Lock()
+	c.written++
+	c.mutex.Unlock()
+	c.cond.Broadcast()
+}
+
+// waitFor blocks until n output items have been written
+func (c *outputCounter) waitFor(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.written < n {
+		c.cond.Wait()
+	}
+}
+
+// writeOutputs writes the output items until the port is closed when the operator is stopped
+func writeOutputs(out *core.Port, w io.Writer, written *outputCounter) {
+	enc := json.NewEncoder(w)
+	for {
+		outgoing := out.Pull()
+		if out.Closed() {
+			return
+		}
+		if err := enc.Encode(outgoing); err != nil {
+			log.Error(err)
+		}
+		written.inc()
+	}
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func runHttpPost(operator *core.Operator, bind string, limits callLimits) {
+	r := mux.NewRouter()
+	r.
+		Methods("POST").
+		Handler(newServiceEndpoint(core.MAIN_SERVICE, operator.Main(), limits))
+
+	handler := cors.New(cors.Options{
+		AllowedMethods: []string{"POST"},
+	}).Handler(r)
+
+	operator.Start()
+	log.Print("started as httpPost")
+	go func() {
+		log.Fatal(http.ListenAndServe(bind, handler))
+	}()
+}
+
+func isQuasiTrigger(p *core.Port) bool {
+	// port is quasi a trigger,
+	// when it actually is a trigger port or
+	// it is a map with in total one sub-port of trigger type
+	return p.TriggerType() || p.MapType() && p.MapLength() == 1 && p.Map(p.MapEntryNames()[0]).TriggerType()
+}
+
+func responseWithError(w http.ResponseWriter, err error, status int) {
+	log.Error(err)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(err.Error()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func responseWithOk(w http.ResponseWriter, m interface{}) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		log.Fatal(err)
+	}
+}
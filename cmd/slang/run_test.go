@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// newPassOperator builds an operator passing numbers from its input to its output
+func newPassOperator(t *testing.T) *core.Operator {
+	bp := core.Blueprint{
+		Id:   uuid.New(),
+		Meta: core.BlueprintMetaDef{Name: "pass"},
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {
+				In:  core.TypeDef{Type: "number"},
+				Out: core.TypeDef{Type: "number"},
+			},
+		},
+		Connections: map[string][]string{"(": {")"}},
+	}
+	op, err := api.BuildOperator(&core.SlangBundle{Main: bp.Id, Blueprints: map[uuid.UUID]core.Blueprint{bp.Id: bp}}, api.TrustPolicy{})
+	require.NoError(t, err)
+	return op
+}
+
+func TestRunProcess__AllItems(t *testing.T) {
+	a := assertions.New(t)
+
+	var out bytes.Buffer
+	err := runProcess(newPassOperator(t), strings.NewReader("1\n\n2\n3\n"), &out)
+	a.NoError(err)
+	a.Equal("1\n2\n3\n", out.String())
+}
+
+func TestRunProcess__TriggerWithoutInput(t *testing.T) {
+	a := assertions.New(t)
+
+	bp := core.Blueprint{
+		Id:   uuid.New(),
+		Meta: core.BlueprintMetaDef{Name: "trigger"},
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {
+				In:  core.TypeDef{Type: "trigger"},
+				Out: core.TypeDef{Type: "trigger"},
+			},
+		},
+		Connections: map[string][]string{"(": {")"}},
+	}
+	op, err := api.BuildOperator(&core.SlangBundle{Main: bp.Id, Blueprints: map[uuid.UUID]core.Blueprint{bp.Id: bp}}, api.TrustPolicy{})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	a.NoError(runProcess(op, strings.NewReader(""), &out))
+	a.Equal(1, strings.Count(out.String(), "\n"))
+}
+
+func TestRunProcess__InvalidItem(t *testing.T) {
+	a := assertions.New(t)
+
+	err := runProcess(newPassOperator(t), strings.NewReader("1\n\"a\"\n"), &bytes.Buffer{})
+	a.Error(err)
+	a.Contains(err.Error(), "line 2")
+}
+
+func TestRunProcess__Streaming(t *testing.T) {
+	a := assertions.New(t)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- runProcess(newPassOperator(t), inR, outW)
+	}()
+
+	// Each output item is expected before the next input item is written, like with `tail -f`
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	for _, item := range []string{"1", "2", "3"} {
+		_, err := io.WriteString(inW, item+"\n")
+		require.NoError(t, err)
+		select {
+		case line := <-lines:
+			a.Equal(item, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no output for item %s", item)
+		}
+	}
+
+	inW.Close()
+	select {
+	case err := <-done:
+		a.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("process mode did not return")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/log"
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the gRPC service, each slang service is a method of it e.g. /slang.Operator/main
+const grpcServiceName = "slang.Operator"
+
+// serviceEndpoint makes a service of the running operator callable by concurrent requests.
+// Items are pushed and pulled through a correlator, so every caller receives the item resulting from its own input.
+type serviceEndpoint struct {
+	name       string
+	service    *core.Service
+	def        core.ServiceDef
+	correlator *api.Correlator
+}
+
+func newServiceEndpoint(name string, srv *core.Service, limits callLimits) *serviceEndpoint {
+	ep := &serviceEndpoint{name: name, service: srv, def: srv.Define()}
+	ep.correlator = api.NewCorrelator(srv, limits.maxConcurrency, limits.queueSize)
+	ep.correlator.Start()
+	return ep
+}
+
+// decode parses and validates an incoming JSON item, an empty item is a trigger
+func (ep *serviceEndpoint) decode(data []byte) (interface{}, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		if !isQuasiTrigger(ep.service.In()) {
+			return nil, errors.New("missing data")
+		}
+		return true, nil
+	}
+
+	var incoming interface{}
+	if err := json.Unmarshal(data, &incoming); err != nil {
+		return nil, err
+	}
+
+	incoming = core.CleanValue(incoming)
+	if err := ep.def.In.VerifyData(incoming); err != nil {
+		return nil, err
+	}
+	return incoming, nil
+}
+
+func (ep *serviceEndpoint) call(ctx context.Context, incoming interface{}) (interface{}, error) {
+	return ep.correlator.Call(ctx, incoming)
+}
+
+func servicePath(srvName string) string {
+	return "/services/" + srvName
+}
+
+// runServe exposes every service of the operator as its own HTTP/JSON endpoint and, if an address is given, as JSON-over-gRPC method.
+// The OpenAPI document describing the endpoints is served at /openapi.json.
+func runServe(operator *core.Operator, bind string, grpcBind string, limits callLimits) error {
+	endpoints := make(map[string]*serviceEndpoint)
+	srvDefs := make(map[string]*core.ServiceDef)
+	for srvName, srv := range operator.Services() {
+		ep := newServiceEndpoint(srvName, srv, limits)
+		endpoints[srvName] = ep
+		srvDefs[srvName] = &ep.def
+	}
+
+	openAPI := api.NewOpenAPIDocument(operator.Meta(), operator.Id().String(), srvDefs, servicePath)
+
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/openapi.json").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		responseWithOk(resp, openAPI)
+	})
+	for _, ep := range endpoints {
+		r.Methods("POST").Path(servicePath(ep.name)).Handler(ep)
+	}
+	// Keep the main service reachable the same way as in httpPost mode
+	r.Methods("POST").Path("/").Handler(endpoints[core.MAIN_SERVICE])
+
+	handler := cors.New(cors.Options{
+		AllowedMethods: []string{"GET", "POST"},
+	}).Handler(r)
+
+	var err error
+	var grpcServer *grpc.Server
+	var grpcLis net.Listener
+	if grpcBind != "" {
+		grpcServer = newGRPCServer(endpoints)
+		if grpcLis, err = net.Listen("tcp", grpcBind); err != nil {
+			return err
+		}
+	}
+
+	httpLis, err := net.Listen("tcp", bind)
+	if err != nil {
+		return err
+	}
+
+	operator.Start()
+
+	log.Printf("started as service on %s", httpLis.Addr())
+	go func() {
+		log.Fatal(http.Serve(httpLis, handler))
+	}()
+
+	if grpcServer != nil {
+		log.Printf("serving gRPC on %s", grpcLis.Addr())
+		go func() {
+			log.Fatal(grpcServer.Serve(grpcLis))
+		}()
+	}
+
+	return nil
+}
+
+func (ep *serviceEndpoint) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if ep == nil {
+		responseWithError(resp, errors.New("operator has no main service"), http.StatusNotFound)
+		return
+	}
+
+	body, err := readBody(req.Body)
+	if err != nil {
+		responseWithError(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	incoming, err := ep.decode(body)
+	if err != nil {
+		responseWithError(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	outgoing, err := ep.call(req.Context(), incoming)
+	if err == api.ErrQueueFull {
+		responseWithError(resp, err, http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		responseWithError(resp, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	responseWithOk(resp, outgoing)
+}
+
+func readBody(r io.Reader) ([]byte, error) {
+	var body json.RawMessage
+	err := json.NewDecoder(r).Decode(&body)
+	if err == io.EOF {
+		return nil, nil
+	}
+	return body, err
+}
+
+// jsonCodec lets gRPC clients exchange the items as JSON documents instead of protocol buffers
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	raw, ok := v.(*json.RawMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	*raw = append((*raw)[:0], data...)
+	return nil
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// newGRPCServer serves every service as bidirectional streaming method of the service slang.Operator.
+// Each message received results into exactly one message sent back.
+// Messages are JSON documents, not protocol buffers: there is no .proto file, clients have to call the methods
+// with the content-subtype "json" instead of using generated stubs.
+func newGRPCServer(endpoints map[string]*serviceEndpoint) *grpc.Server {
+	return grpc.NewServer(
+		grpc.ForceServerCodec(jsonCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			method = strings.TrimPrefix(method, "/")
+
+			parts := strings.SplitN(method, "/", 2)
+			if len(parts) != 2 || parts[0] != grpcServiceName {
+				return status.Errorf(codes.Unimplemented, "unknown service %s", method)
+			}
+
+			ep, ok := endpoints[parts[1]]
+			if !ok {
+				return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+			}
+
+			for {
+				var body json.RawMessage
+				if err := stream.RecvMsg(&body); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				incoming, err := ep.decode(body)
+				if err != nil {
+					return status.Error(codes.InvalidArgument, err.Error())
+				}
+
+				outgoing, err := ep.call(stream.Context(), incoming)
+				if err == api.ErrQueueFull {
+					return status.Error(codes.ResourceExhausted, err.Error())
+				} else if err != nil {
+					return status.Error(codes.Unavailable, err.Error())
+				}
+
+				if err := stream.SendMsg(outgoing); err != nil {
+					return err
+				}
+			}
+		}),
+	)
+}
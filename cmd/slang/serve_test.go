@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+)
+
+func TestServiceEndpoint__ConcurrentRequests(t *testing.T) {
+	a := assertions.New(t)
+
+	op := newPassOperator(t)
+	ep := newServiceEndpoint(core.MAIN_SERVICE, op.Main(), callLimits{})
+	op.Start()
+	server := httptest.NewServer(ep)
+	defer server.Close()
+
+	const requests = 20
+	results := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func(i int) {
+			resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(fmt.Sprint(i)))
+			if err != nil {
+				results <- err
+				return
+			}
+			defer resp.Body.Close()
+			var outgoing float64
+			if err := json.NewDecoder(resp.Body).Decode(&outgoing); err != nil {
+				results <- err
+			} else if resp.StatusCode != http.StatusOK || outgoing != float64(i) {
+				results <- fmt.Errorf("request %d: %s %v", i, resp.Status, outgoing)
+			} else {
+				results <- nil
+			}
+		}(i)
+	}
+	for i := 0; i < requests; i++ {
+		a.NoError(<-results)
+	}
+}
+
+func TestServiceEndpoint__InvalidItem(t *testing.T) {
+	a := assertions.New(t)
+
+	op := newPassOperator(t)
+	ep := newServiceEndpoint(core.MAIN_SERVICE, op.Main(), callLimits{})
+	op.Start()
+	server := httptest.NewServer(ep)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(`"text"`))
+	a.NoError(err)
+	a.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Post(server.URL, "application/json", nil)
+	a.NoError(err)
+	a.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"gopkg.in/yaml.v2"
+)
+
+func showCommand() *command {
+	cmd := newCommand("show", "BLUEPRINT", "Prints a blueprint of the storage", nil)
+
+	asJSON := cmd.flags.Bool("json", false, "Print as JSON instead of YAML")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("missing blueprint")
+		}
+
+		st := stCfg.open()
+		id, err := resolveBlueprintId(st, args[0])
+		if err != nil {
+			return err
+		}
+
+		blueprint, err := st.Load(id)
+		if err != nil {
+			return err
+		}
+		return printBlueprint(blueprint, *asJSON)
+	}
+
+	return cmd
+}
+
+func printBlueprint(blueprint *core.Blueprint, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(blueprint)
+	}
+
+	blueprintYaml, err := yaml.Marshal(blueprint)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(blueprintYaml)
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/elem"
+	"github.com/Bitspark/slang/pkg/packages"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// stringList is a flag which can be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, string(filepath.ListSeparator))
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// storageConfig describes the storage the subcommands are operating on.
+// Like the daemon it consists of one writable project directory, any number of read-only library directories
+// and the installed packages.
+type storageConfig struct {
+	dir      string
+	libs     stringList
+	packages string
+}
+
+// slangPath returns the value of the environment variable or, if it is not set, the directory in ~/slang
+func slangPath(key string, name string) string {
+	if dir := os.Getenv(key); dir != "" {
+		return dir
+	}
+	currUser, err := user.Current()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(currUser.HomeDir, "slang", name)
+}
+
+func addStorageFlags(fs *flag.FlagSet) *storageConfig {
+	cfg := &storageConfig{}
+
+	dfltDir := os.Getenv("SLANG_DIR")
+	if dfltDir == "" {
+		dfltDir = "."
+	}
+	if lib := os.Getenv("SLANG_LIB"); lib != "" {
+		cfg.libs = append(cfg.libs, filepath.SplitList(lib)...)
+	}
+
+	fs.StringVar(&cfg.dir, "dir", dfltDir, "Writable directory containing the YAML/JSON blueprints, $SLANG_DIR if set")
+	fs.Var(&cfg.libs, "lib", "Read-only library directory, can be given multiple times, $SLANG_LIB if set")
+	fs.StringVar(&cfg.packages, "packages", slangPath("SLANG_PACKAGES", "packages"), "Directory of the installed packages, $SLANG_PACKAGES if set")
+	return cfg
+}
+
+func (cfg *storageConfig) backends() []storage.Backend {
+	backends := []storage.Backend{storage.NewWritableFileSystem(cfg.dir)}
+	for _, lib := range cfg.libs {
+		backends = append(backends, storage.NewReadOnlyFileSystem(lib))
+	}
+	if pkgs, err := packages.NewLibrary(cfg.packages).Backends(); err != nil {
+		log.Printf("Could not load packages (%s)\n", err.Error())
+	} else {
+		backends = append(backends, pkgs...)
+	}
+	return backends
+}
+
+func (cfg *storageConfig) open() *storage.Storage {
+	st := storage.NewStorage()
+	for _, backend := range cfg.backends() {
+		st.AddBackend(backend)
+	}
+	return st
+}
+
+// resolveBlueprintIds turns the given arguments into blueprint ids.
+// Each argument is either a blueprint id or the name of a blueprint within the storage.
+func resolveBlueprintIds(st *storage.Storage, args []string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, arg := range args {
+		id, err := resolveBlueprintId(st, arg)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func resolveBlueprintId(st *storage.Storage, arg string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(arg); err == nil {
+		return id, nil
+	}
+
+	ids, err := st.List()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var found []uuid.UUID
+	for _, id := range ids {
+		blueprint, err := st.Load(id)
+		if err != nil {
+			continue
+		}
+		if blueprint.Meta.Name == arg {
+			found = append(found, id)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return uuid.Nil, fmt.Errorf("unknown blueprint: %s", arg)
+	case 1:
+		return found[0], nil
+	default:
+		return uuid.Nil, fmt.Errorf("blueprint name is ambiguous, use the id instead: %s", arg)
+	}
+}
+
+// blueprintEntry is a blueprint together with the kind of storage it was found in
+type blueprintEntry struct {
+	blueprint *core.Blueprint
+	kind      string
+}
+
+// listBlueprints loads all blueprints of the storage sorted by their names.
+// Elementary blueprints are only included if requested.
+func listBlueprints(st *storage.Storage, withElementaries bool) ([]blueprintEntry, error) {
+	var entries []blueprintEntry
+
+	if withElementaries {
+		for _, id := range elem.GetBuiltinIds() {
+			blueprint, err := elem.GetBlueprint(id)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, blueprintEntry{blueprint, "elementary"})
+		}
+	}
+
+	ids, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		blueprint, err := st.Load(id)
+		if err != nil {
+			return nil, err
+		}
+
+		kind := "library"
+		if st.IsSavedInWritableBackend(id) {
+			kind = "local"
+		}
+		entries = append(entries, blueprintEntry{blueprint, kind})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].blueprint.Meta.Name == entries[j].blueprint.Meta.Name {
+			return entries[i].blueprint.Id.String() < entries[j].blueprint.Id.String()
+		}
+		return entries[i].blueprint.Meta.Name < entries[j].blueprint.Meta.Name
+	})
+
+	return entries, nil
+}
+
+// localBlueprintIds returns the ids of all blueprints stored in the writable directory
+func localBlueprintIds(st *storage.Storage) ([]uuid.UUID, error) {
+	ids, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var local []uuid.UUID
+	for _, id := range ids {
+		if st.IsSavedInWritableBackend(id) {
+			local = append(local, id)
+		}
+	}
+
+	if len(local) == 0 {
+		return nil, errors.New("no blueprints found")
+	}
+
+	return local, nil
+}
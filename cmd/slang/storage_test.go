@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBlueprint(name string) core.Blueprint {
+	return core.Blueprint{
+		Id:   uuid.New(),
+		Meta: core.BlueprintMetaDef{Name: name},
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {
+				In:  core.TypeDef{Type: "trigger"},
+				Out: core.TypeDef{Type: "trigger"},
+			},
+		},
+		Connections: map[string][]string{"(": {")"}},
+	}
+}
+
+// newTestStorageConfig returns a storage config with a project and a library directory holding the blueprints,
+// both are placed in the returned temporary directory
+func newTestStorageConfig(t *testing.T, local []core.Blueprint, library []core.Blueprint) (*storageConfig, string) {
+	tmp, err := ioutil.TempDir("", "slang-cli")
+	require.NoError(t, err)
+	dir := filepath.Join(tmp, "projects")
+	lib := filepath.Join(tmp, "lib")
+
+	for _, bp := range library {
+		_, err := storage.NewWritableFileSystem(lib).Save(bp)
+		require.NoError(t, err)
+	}
+	for _, bp := range local {
+		_, err := storage.NewWritableFileSystem(dir).Save(bp)
+		require.NoError(t, err)
+	}
+	return &storageConfig{dir: dir, libs: stringList{lib}, packages: filepath.Join(tmp, "packages")}, tmp
+}
+
+func TestResolveBlueprintId(t *testing.T) {
+	a := assertions.New(t)
+
+	first := newTestBlueprint("first")
+	second := newTestBlueprint("second")
+	twin1 := newTestBlueprint("twin")
+	twin2 := newTestBlueprint("twin")
+	cfg, tmp := newTestStorageConfig(t, []core.Blueprint{first, twin1}, []core.Blueprint{second, twin2})
+	defer os.RemoveAll(tmp)
+	st := cfg.open()
+
+	id, err := resolveBlueprintId(st, "first")
+	a.NoError(err)
+	a.Equal(first.Id, id)
+
+	id, err = resolveBlueprintId(st, "second")
+	a.NoError(err)
+	a.Equal(second.Id, id)
+
+	id, err = resolveBlueprintId(st, twin2.Id.String())
+	a.NoError(err)
+	a.Equal(twin2.Id, id)
+
+	_, err = resolveBlueprintId(st, "twin")
+	a.Error(err)
+	_, err = resolveBlueprintId(st, "unknown")
+	a.Error(err)
+
+	ids, err := resolveBlueprintIds(st, []string{"second", "first"})
+	a.NoError(err)
+	a.Equal([]uuid.UUID{second.Id, first.Id}, ids)
+}
+
+func TestListBlueprints(t *testing.T) {
+	a := assertions.New(t)
+
+	local := newTestBlueprint("b")
+	library := newTestBlueprint("a")
+	cfg, tmp := newTestStorageConfig(t, []core.Blueprint{local}, []core.Blueprint{library})
+	defer os.RemoveAll(tmp)
+	st := cfg.open()
+
+	entries, err := listBlueprints(st, false)
+	a.NoError(err)
+	a.Len(entries, 2)
+	a.Equal(library.Id, entries[0].blueprint.Id)
+	a.Equal("library", entries[0].kind)
+	a.Equal(local.Id, entries[1].blueprint.Id)
+	a.Equal("local", entries[1].kind)
+
+	withElementaries, err := listBlueprints(st, true)
+	a.NoError(err)
+	a.True(len(withElementaries) > len(entries))
+
+	ids, err := localBlueprintIds(st)
+	a.NoError(err)
+	a.Equal([]uuid.UUID{local.Id}, ids)
+}
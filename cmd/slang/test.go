@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/google/uuid"
+)
+
+func testCommand() *command {
+	cmd := newCommand("test", "[BLUEPRINT...]", "Runs the test cases of blueprints, all local blueprints if none are given", nil)
+
+	failFast := cmd.flags.Bool("failfast", false, "Stop at the first failing test case")
+	stCfg := addStorageFlags(cmd.flags)
+
+	cmd.run = func(args []string) error {
+		st := stCfg.open()
+
+		var ids []uuid.UUID
+		var err error
+		if len(args) == 0 {
+			ids, err = localBlueprintIds(st)
+		} else {
+			ids, err = resolveBlueprintIds(st, args)
+		}
+		if err != nil {
+			return err
+		}
+
+		tb := api.NewTestBench(st)
+
+		succs := 0
+		fails := 0
+		for _, id := range ids {
+			blueprint, err := st.Load(id)
+			if err != nil {
+				return err
+			}
+			if len(blueprint.TestCases) == 0 {
+				continue
+			}
+
+			fmt.Printf("%s (%s)\n", blueprint.Meta.Name, id)
+			s, f, err := tb.Run(id, os.Stdout, *failFast)
+			if err != nil {
+				return fmt.Errorf("%s: %s", id, err)
+			}
+			succs += s
+			fails += f
+
+			if *failFast && f > 0 {
+				break
+			}
+		}
+
+		fmt.Printf("Test result: %d succeeded, %d failed\n", succs, fails)
+
+		if fails > 0 {
+			return fmt.Errorf("%d test cases failed", fails)
+		}
+		return nil
+	}
+
+	return cmd
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/packages"
 	"github.com/Bitspark/slang/pkg/storage"
 
 	"strconv"
@@ -31,13 +36,50 @@ var (
 var onlyDaemon bool
 var skipChecks bool
 var withoutUI bool
+var usersFile string
+var hashPassword bool
+var newToken bool
+var runRetention time.Duration
+var maxRuns int
+var useGit bool
+var gitRemote string
+var dbDriver string
+var dbSource string
+var precedence string
+var remoteURL string
+var remoteToken string
+var remoteWritable bool
+var libSource string
+var uiSource string
+var requireChecksum bool
 
 func main() {
 	flag.BoolVar(&onlyDaemon, "only-daemon", false, "Don't automatically open UI")
 	flag.BoolVar(&skipChecks, "skip-checks", false, "Skip checking and updating UI and Lib")
 	flag.BoolVar(&withoutUI, "without-ui", false, "Do not serve the UI found in SLANG_UI")
+	flag.StringVar(&usersFile, "users", "", "User file enabling authentication (default SLANG_PATH/users.yaml if it exists)")
+	flag.BoolVar(&hashPassword, "hash-password", false, "Read a password from stdin and print its hash for the user file")
+	flag.BoolVar(&newToken, "new-token", false, "Print a new API token and its hash for the user file")
+	flag.DurationVar(&runRetention, "run-retention", daemon.DefaultRunRetention.MaxAge, "How long finished runs of instances are kept, 0 keeps them forever")
+	flag.BoolVar(&useGit, "git", false, "Commit every change of the blueprints in SLANG_DIR to a git repository")
+	flag.StringVar(&gitRemote, "git-remote", "", "Clone SLANG_DIR from this git repository and push changes to it, implies -git")
+	flag.StringVar(&dbDriver, "db-driver", "sqlite3", "Database driver for -db: sqlite3, mysql or postgres")
+	flag.StringVar(&dbSource, "db", "", "Keep blueprints in this database instead of SLANG_DIR, e.g. a SQLite file")
+	flag.StringVar(&precedence, "precedence", string(storage.PrecedenceOrder), "Where blueprints found in several places are loaded from: order (SLANG_DIR before SLANG_LIB), local or library")
+	flag.StringVar(&remoteURL, "remote", "", "Also load blueprints from the slangd at this URL, e.g. a central library daemon")
+	flag.StringVar(&remoteToken, "remote-token", "", "API token for -remote")
+	flag.BoolVar(&remoteWritable, "remote-writable", false, "Also save blueprints to the slangd given by -remote")
+	flag.StringVar(&libSource, "lib-source", "", "Where slang-lib is loaded from: GitHub if empty, an HTTP mirror, a directory or a zip archive")
+	flag.StringVar(&uiSource, "ui-source", "", "Where slang-ui is loaded from, see -lib-source")
+	flag.BoolVar(&requireChecksum, "require-checksum", false, "Do not install slang-lib and slang-ui archives without a checksum")
+	flag.IntVar(&maxRuns, "max-runs", daemon.DefaultRunRetention.MaxRuns, "Number of finished runs of instances which are kept, 0 keeps all")
 	flag.Parse()
 
+	if hashPassword || newToken {
+		printCredentials()
+		return
+	}
+
 	buildTime, _ := strconv.ParseInt(BuildTime, 10, 64)
 	if buildTime != 0 {
 		log.Printf("Starting slangd %s built %s...\n", Version, time.Unix(buildTime, 0).Format(time.RFC3339))
@@ -54,13 +96,62 @@ func main() {
 		loadLocalComponents(env)
 	}
 
+	projects, err := projectsBackend(env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, err := storage.ParsePrecedence(precedence)
+	if err != nil {
+		log.Fatal(err)
+	}
 	st := storage.NewStorage().
-		AddBackend(storage.NewWritableFileSystem(env.SLANG_DIR)).
+		SetPrecedence(p).
+		AddBackend(projects).
 		AddBackend(storage.NewReadOnlyFileSystem(env.SLANG_LIB))
+	if pkgs, err := packages.NewLibrary(env.SLANG_PACKAGES).Backends(); err != nil {
+		log.Printf("Could not load packages (%s)\n", err.Error())
+	} else {
+		for _, backend := range pkgs {
+			st.AddBackend(backend)
+		}
+	}
+	if remoteWritable && remoteURL != "" {
+		st.AddBackend(storage.NewWritableRemote(remoteURL, remoteToken))
+	} else if remoteURL != "" {
+		st.AddBackend(storage.NewReadOnlyRemote(remoteURL, remoteToken))
+	}
+	for _, c := range st.Conflicts() {
+		log.Printf("Blueprint %s differs in %d places, see /operator/conflicts/\n", c.Id, len(c.Versions))
+	}
 
 	ctx := daemon.SetStorage(context.Background(), st)
 	srv := daemon.NewServer(&ctx, env)
 
+	if err := enableAuth(srv, env); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := srv.LoadWorkspaces(filepath.Join(env.SLANG_PATH, "workspaces")); err != nil {
+		log.Printf("Could not load workspaces (%s)\n", err.Error())
+	}
+
+	if err := srv.WatchBlueprints(); err != nil {
+		log.Printf("Could not watch blueprints (%s)\n", err.Error())
+	}
+
+	retention := daemon.RunRetention{MaxAge: runRetention, MaxRuns: maxRuns}
+	if err := srv.LoadRuns(filepath.Join(env.SLANG_PATH, "runs"), retention); err != nil {
+		log.Printf("Could not load runs (%s)\n", err.Error())
+	}
+
+	if err := srv.LoadInstances(filepath.Join(env.SLANG_PATH, "instances.json")); err != nil {
+		log.Printf("Could not restore instances (%s)\n", err.Error())
+	}
+
+	if err := srv.LoadSchedules(filepath.Join(env.SLANG_PATH, "schedules.json")); err != nil {
+		log.Printf("Could not restore schedules (%s)\n", err.Error())
+	}
+
 	if !withoutUI {
 		srv.AddRedirect("/", "/app/")
 		srv.AddStaticServer("/app", http.Dir(env.SLANG_UI))
@@ -69,6 +160,59 @@ func main() {
 	startDaemonServer(srv)
 }
 
+// projectsBackend is where blueprints are saved, a plain directory unless a database or a git repository is requested
+func projectsBackend(e *env.Environment) (storage.WriteableBackend, error) {
+	if dbSource != "" {
+		return storage.OpenDatabase(dbDriver, dbSource)
+	}
+	if gitRemote != "" {
+		return storage.CloneGitRepository(gitRemote, e.SLANG_DIR, storage.DefaultGitAuthor)
+	}
+	if useGit {
+		return storage.NewGitRepository(e.SLANG_DIR, storage.DefaultGitAuthor)
+	}
+	return storage.NewWritableFileSystem(e.SLANG_DIR), nil
+}
+
+func enableAuth(srv *daemon.Server, e *env.Environment) error {
+	file := usersFile
+	if file == "" {
+		file = filepath.Join(e.SLANG_PATH, "users.yaml")
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			log.Println("No user file found, authentication is disabled")
+			return nil
+		}
+	}
+
+	users, err := daemon.LoadUserFile(file)
+	if err != nil {
+		return err
+	}
+	log.Printf("Authentication enabled for %d users\n", users.Users())
+	return srv.EnableAuth(users, filepath.Join(e.SLANG_PATH, "owners.json"))
+}
+
+func printCredentials() {
+	if newToken {
+		token, err := daemon.NewToken()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("token: %s\nhash:  %s\n", token, daemon.HashToken(token))
+		return
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatal(err)
+	}
+	hash, err := daemon.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(hash)
+}
+
 func checkNewestVersion() {
 	isNewest, newestVer, err := daemon.IsNewestSlangVersion(Version)
 	if err != nil {
@@ -90,11 +234,28 @@ func checkNewestVersion() {
 	}
 }
 
+// loadLocalComponents updates slang-lib and slang-ui. If that fails, e.g. without network, the daemon
+// starts with the versions it has.
 func loadLocalComponents(e *env.Environment) {
-	for repoName, dirPath := range map[string]string{"slang-lib": e.SLANG_LIB_REPO_PATH, "slang-ui": e.SLANG_UI} {
-		dl := daemon.NewComponentLoaderLatestRelease(repoName, dirPath)
+	for repoName, cfg := range map[string][2]string{"slang-lib": {e.SLANG_LIB_REPO_PATH, libSource}, "slang-ui": {e.SLANG_UI, uiSource}} {
+		dirPath, sourceName := cfg[0], cfg[1]
+		source, err := daemon.ParseComponentSource(sourceName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		dl := daemon.NewComponentLoader(repoName, dirPath, source).SetRequireChecksum(requireChecksum)
+		localVer := dl.GetLocalReleaseVersion()
+		if err := dl.Err(); err != nil {
+			if localVer != nil {
+				log.Printf("Could not check for a newer %v (%v), using local version %v.", repoName, err, localVer.String())
+			} else {
+				log.Printf("Could not load %v (%v), starting without it.", repoName, err)
+			}
+			continue
+		}
+
 		if dl.NewerVersionExists() {
-			localVer := dl.GetLocalReleaseVersion()
 			latestVer := dl.GetLatestReleaseVersion()
 			if localVer != nil {
 				log.Printf("Your local %v has version %v but latest is %v.", repoName, localVer.String(), latestVer.String())
@@ -102,12 +263,12 @@ func loadLocalComponents(e *env.Environment) {
 			log.Printf("Downloading %v latest version (%v).", repoName, latestVer.String())
 
 			if err := dl.Load(); err != nil {
-				log.Fatal(err)
+				log.Printf("Could not load %v (%v), keeping the local version.", repoName, err)
+				continue
 			}
 
 			log.Printf("Done.")
 		} else {
-			localVer := dl.GetLocalReleaseVersion()
 			log.Printf("Your local %v is up-to-date (%v).", repoName, localVer.String())
 		}
 	}
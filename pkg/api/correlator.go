@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/log"
+)
+
+var ErrQueueFull = errors.New("too many pending requests")
+var ErrCorrelatorStopped = errors.New("operator has been stopped")
+
+// Correlator lets concurrent callers push items into a service of a running operator and guarantees that
+// each caller receives the output item belonging to its input item. Like core.Synchronizer it relies on
+// operators emitting exactly one output item per input item in the same order.
+//
+// At most maxConcurrency items are processed by the operator at the same time, at most queueSize further
+// callers wait for being admitted. All other callers are rejected with ErrQueueFull.
+type Correlator struct {
+	service *core.Service
+
+	// Admission: slots limits the items in flight, admitted limits in flight plus waiting callers
+	slots    chan bool
+	admitted chan bool
+
+	mutex   *sync.Mutex
+	pending []chan correlatorResult
+	stopped bool
+	done    chan bool
+}
+
+type correlatorResult struct {
+	item interface{}
+	err  error
+}
+
+// NewCorrelator creates a correlator for the given service.
+// A maxConcurrency less or equal to zero means there is no limit and callers never have to wait.
+func NewCorrelator(srv *core.Service, maxConcurrency int, queueSize int) *Correlator {
+	c := &Correlator{service: srv, mutex: &sync.Mutex{}, done: make(chan bool)}
+	if maxConcurrency > 0 {
+		if queueSize < 0 {
+			queueSize = 0
+		}
+		c.slots = make(chan bool, maxConcurrency)
+		c.admitted = make(chan bool, maxConcurrency+queueSize)
+	}
+	srv.Out().Bufferize()
+	return c
+}
+
+// Start begins pulling output items and handing them to the waiting callers.
+// The operator has to be started separately.
+func (c *Correlator) Start() {
+	go c.dispatch()
+}
+
+// Stop fails all pending and future calls
+func (c *Correlator) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped {
+		return
+	}
+	c.stopped = true
+	close(c.done)
+
+	for _, res := range c.pending {
+		res <- correlatorResult{nil, ErrCorrelatorStopped}
+		c.release()
+	}
+	c.pending = nil
+}
+
+// Done is closed when the correlator has been stopped, either by calling Stop or because the operator has been stopped
+func (c *Correlator) Done() <-chan bool {
+	return c.done
+}
+
+// Pending returns the number of items pushed into the operator and not answered yet
+func (c *Correlator) Pending() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pending)
+}
+
+// Call pushes the item into the service and waits for the corresponding output item.
+// If the context is done before, the call returns with the context's error. In case the item
+// has already been pushed, its output item is discarded once it arrives.
+func (c *Correlator) Call(ctx context.Context, item interface{}) (interface{}, error) {
+	call, err := c.Submit(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return call.Wait(ctx)
+}
+
+// CorrelatorCall is an item which has been pushed into the service and whose output item may still be pending
+type CorrelatorCall struct {
+	res chan correlatorResult
+}
+
+// Submit pushes the item into the service as soon as it is admitted, without waiting for the corresponding
+// output item. Like Call it fails with ErrQueueFull if too many callers are waiting already.
+func (c *Correlator) Submit(ctx context.Context, item interface{}) (*CorrelatorCall, error) {
+	if err := c.admit(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopped {
+		c.release()
+		return nil, ErrCorrelatorStopped
+	}
+	res := make(chan correlatorResult, 1)
+	c.pending = append(c.pending, res)
+	// Pushing while holding the lock keeps the order of c.pending and the items inside the operator the same
+	c.service.In().Push(item)
+	return &CorrelatorCall{res}, nil
+}
+
+// Wait waits for the output item of the submitted item
+func (cc *CorrelatorCall) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case r := <-cc.res:
+		return r.item, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Correlator) admit(ctx context.Context) error {
+	if c.slots == nil {
+		return nil
+	}
+
+	select {
+	case c.admitted <- true:
+	default:
+		return ErrQueueFull
+	}
+
+	select {
+	case c.slots <- true:
+		return nil
+	case <-ctx.Done():
+		<-c.admitted
+		return ctx.Err()
+	}
+}
+
+func (c *Correlator) release() {
+	if c.slots == nil {
+		return
+	}
+	<-c.slots
+	<-c.admitted
+}
+
+func (c *Correlator) dispatch() {
+	out := c.service.Out()
+	for {
+		item := out.Pull()
+
+		if out.Closed() {
+			// Operator has been stopped, nobody will receive an output item anymore
+			c.Stop()
+			return
+		}
+
+		c.mutex.Lock()
+		if c.stopped {
+			c.mutex.Unlock()
+			return
+		}
+
+		if len(c.pending) == 0 {
+			c.mutex.Unlock()
+			log.Warnf("%s: discarding output item without corresponding input item", c.service.Name())
+			continue
+		}
+
+		res := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mutex.Unlock()
+
+		res <- correlatorResult{item, nil}
+		c.release()
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOperator(t *testing.T, f core.OFunc) *core.Operator {
+	op, err := core.NewOperator("test", f, nil, nil, nil, core.Blueprint{
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {
+				In:  core.TypeDef{Type: "number"},
+				Out: core.TypeDef{Type: "number"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	op.Main().In().Bufferize()
+	return op
+}
+
+func TestCorrelator_Call__MatchingOutputs(t *testing.T) {
+	a := assertions.New(t)
+	op := newTestOperator(t, func(op *core.Operator) {
+		in := op.Main().In()
+		out := op.Main().Out()
+		for !op.CheckStop() {
+			i := in.Pull()
+			if n, ok := i.(float64); ok {
+				time.Sleep(time.Duration(int(n)%3) * time.Millisecond)
+				out.Push(n * 2)
+			} else {
+				out.Push(i)
+			}
+		}
+	})
+
+	c := NewCorrelator(op.Main(), 4, 100)
+	c.Start()
+	op.Start()
+	defer op.Stop()
+
+	wg := &sync.WaitGroup{}
+	results := make([]interface{}, 50)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.Call(context.Background(), float64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, res := range results {
+		a.Equal(float64(i*2), res)
+	}
+	a.Equal(0, c.Pending())
+}
+
+func TestCorrelator_Call__QueueFull(t *testing.T) {
+	a := assertions.New(t)
+	release := make(chan bool)
+	op := newTestOperator(t, func(op *core.Operator) {
+		in := op.Main().In()
+		out := op.Main().Out()
+		for !op.CheckStop() {
+			i := in.Pull()
+			<-release
+			out.Push(i)
+		}
+	})
+
+	c := NewCorrelator(op.Main(), 1, 1)
+	c.Start()
+	op.Start()
+	defer op.Stop()
+
+	results := make(chan interface{}, 2)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			res, _ := c.Call(context.Background(), float64(i))
+			results <- res
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// One item in flight, one caller waiting
+	_, err := c.Call(context.Background(), 3.0)
+	a.Equal(ErrQueueFull, err)
+
+	release <- true
+	a.Equal(1.0, <-results)
+	release <- true
+	a.Equal(2.0, <-results)
+}
+
+func TestCorrelator_Call__ContextDone(t *testing.T) {
+	a := assertions.New(t)
+	op := newTestOperator(t, func(op *core.Operator) {
+		in := op.Main().In()
+		for !op.CheckStop() {
+			in.Pull()
+		}
+	})
+
+	c := NewCorrelator(op.Main(), 1, 0)
+	c.Start()
+	op.Start()
+	defer op.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Call(ctx, 1.0)
+	a.Equal(context.DeadlineExceeded, err)
+	a.Equal(1, c.Pending())
+
+	c.Stop()
+	_, err = c.Call(context.Background(), 2.0)
+	a.Equal(ErrCorrelatorStopped, err)
+}
+
+func TestCorrelator_Submit__Admission(t *testing.T) {
+	a := assertions.New(t)
+	release := make(chan bool)
+	op := newTestOperator(t, func(op *core.Operator) {
+		in := op.Main().In()
+		out := op.Main().Out()
+		for !op.CheckStop() {
+			i := in.Pull()
+			<-release
+			out.Push(i)
+		}
+	})
+
+	c := NewCorrelator(op.Main(), 1, 0)
+	c.Start()
+	op.Start()
+	defer op.Stop()
+
+	// Submit returns once the item is pushed, without waiting for its output item
+	call, err := c.Submit(context.Background(), 1.0)
+	a.NoError(err)
+	a.Equal(1, c.Pending())
+
+	_, err = c.Submit(context.Background(), 2.0)
+	a.Equal(ErrQueueFull, err)
+
+	release <- true
+	res, err := call.Wait(context.Background())
+	a.NoError(err)
+	a.Equal(1.0, res)
+
+	call, err = c.Submit(context.Background(), 3.0)
+	a.NoError(err)
+	release <- true
+	res, _ = call.Wait(context.Background())
+	a.Equal(3.0, res)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/Bitspark/slang/pkg/core"
+)
+
+const OpenAPIVersion = "3.0.2"
+
+type OpenAPIDocument struct {
+	OpenAPI string                  `json:"openapi"`
+	Info    OpenAPIInfo             `json:"info"`
+	Paths   map[string]*OpenAPIPath `json:"paths"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIPath struct {
+	Post *OpenAPIOperation `json:"post,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationId string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPISchema struct {
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Nullable   bool                      `json:"nullable,omitempty"`
+	Items      *OpenAPISchema            `json:"items,omitempty"`
+	Properties map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+}
+
+// NewOpenAPIDocument describes the services of an operator as HTTP/JSON API.
+// Each service is reachable with a POST request to the path returned by servicePath.
+func NewOpenAPIDocument(meta core.BlueprintMetaDef, version string, services map[string]*core.ServiceDef, servicePath func(srvName string) string) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info: OpenAPIInfo{
+			Title:       meta.Name,
+			Description: meta.ShortDescription,
+			Version:     version,
+		},
+		Paths: make(map[string]*OpenAPIPath),
+	}
+
+	if doc.Info.Title == "" {
+		doc.Info.Title = "slang operator"
+	}
+
+	for srvName, srv := range services {
+		doc.Paths[servicePath(srvName)] = &OpenAPIPath{
+			Post: &OpenAPIOperation{
+				OperationId: srvName,
+				Summary:     "Pushes an item into service " + srvName + " and responds with the resulting item",
+				RequestBody: &OpenAPIBody{
+					Required: srv.In.Type != "trigger",
+					Content:  jsonContent(TypeDefSchema(srv.In)),
+				},
+				Responses: map[string]*OpenAPIResponse{
+					"200": {
+						Description: "item emitted by the operator",
+						Content:     jsonContent(TypeDefSchema(srv.Out)),
+					},
+					"400": {
+						Description: "item does not match the type of the service",
+						Content:     jsonContent(&OpenAPISchema{Type: "string"}),
+					},
+				},
+			},
+		}
+	}
+
+	return doc
+}
+
+// TypeDefSchema translates a slang type into a JSON schema as used by OpenAPI
+func TypeDefSchema(def core.TypeDef) *OpenAPISchema {
+	switch def.Type {
+	case "number", "string", "boolean":
+		return &OpenAPISchema{Type: def.Type}
+	case "binary":
+		// Binaries are encoded as base64 string prefixed by "base64:"
+		return &OpenAPISchema{Type: "string", Format: "byte"}
+	case "stream":
+		return &OpenAPISchema{Type: "array", Items: TypeDefSchema(*def.Stream)}
+	case "map":
+		schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+		for k, e := range def.Map {
+			schema.Properties[k] = TypeDefSchema(*e)
+			schema.Required = append(schema.Required, k)
+		}
+		sort.Strings(schema.Required)
+		return schema
+	case "trigger":
+		// Triggers carry no value, they are sent and received as null or true
+		return &OpenAPISchema{Type: "boolean", Nullable: true}
+	default:
+		// Primitives and unspecified generics accept any value
+		return &OpenAPISchema{}
+	}
+}
+
+func jsonContent(schema *OpenAPISchema) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+)
+
+func TestTypeDefSchema__Primitives(t *testing.T) {
+	a := assertions.New(t)
+	a.Equal(&OpenAPISchema{Type: "number"}, TypeDefSchema(core.TypeDef{Type: "number"}))
+	a.Equal(&OpenAPISchema{Type: "string"}, TypeDefSchema(core.TypeDef{Type: "string"}))
+	a.Equal(&OpenAPISchema{Type: "boolean"}, TypeDefSchema(core.TypeDef{Type: "boolean"}))
+	a.Equal(&OpenAPISchema{Type: "string", Format: "byte"}, TypeDefSchema(core.TypeDef{Type: "binary"}))
+	a.Equal(&OpenAPISchema{Type: "boolean", Nullable: true}, TypeDefSchema(core.TypeDef{Type: "trigger"}))
+	a.Equal(&OpenAPISchema{}, TypeDefSchema(core.TypeDef{Type: "primitive"}))
+}
+
+func TestTypeDefSchema__Nested(t *testing.T) {
+	a := assertions.New(t)
+	schema := TypeDefSchema(core.TypeDef{
+		Type: "map",
+		Map: map[string]*core.TypeDef{
+			"b": {Type: "string"},
+			"a": {Type: "stream", Stream: &core.TypeDef{Type: "number"}},
+		},
+	})
+
+	a.Equal("object", schema.Type)
+	a.Equal([]string{"a", "b"}, schema.Required)
+	a.Equal(&OpenAPISchema{Type: "array", Items: &OpenAPISchema{Type: "number"}}, schema.Properties["a"])
+	a.Equal(&OpenAPISchema{Type: "string"}, schema.Properties["b"])
+}
+
+func TestNewOpenAPIDocument__PathPerService(t *testing.T) {
+	a := assertions.New(t)
+	services := map[string]*core.ServiceDef{
+		"main":  {In: core.TypeDef{Type: "string"}, Out: core.TypeDef{Type: "number"}},
+		"reset": {In: core.TypeDef{Type: "trigger"}, Out: core.TypeDef{Type: "trigger"}},
+	}
+
+	doc := NewOpenAPIDocument(core.BlueprintMetaDef{Name: "Counter"}, "1.0", services, func(srvName string) string {
+		return "/" + srvName
+	})
+
+	a.Equal(OpenAPIVersion, doc.OpenAPI)
+	a.Equal("Counter", doc.Info.Title)
+	a.Len(doc.Paths, 2)
+
+	main := doc.Paths["/main"].Post
+	a.Equal("main", main.OperationId)
+	a.True(main.RequestBody.Required)
+	a.Equal("string", main.RequestBody.Content["application/json"].Schema.Type)
+	a.Equal("number", main.Responses["200"].Content["application/json"].Schema.Type)
+
+	a.False(doc.Paths["/reset"].Post.RequestBody.Required)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// BlueprintFilter selects blueprints by their meta information. Empty fields match every blueprint,
+// strings match case-insensitively as substrings and all tags have to be present.
+type BlueprintFilter struct {
+	// Text is searched in name, descriptions and tags
+	Text             string
+	Name             string
+	ShortDescription string
+	Description      string
+	Icon             string
+	DocURL           string
+	Tags             []string
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (f BlueprintFilter) Matches(bp *core.Blueprint) bool {
+	m := bp.Meta
+	fields := []struct{ value, filter string }{
+		{m.Name, f.Name},
+		{m.ShortDescription, f.ShortDescription},
+		{m.Description, f.Description},
+		{m.Icon, f.Icon},
+		{m.DocURL, f.DocURL},
+	}
+	for _, field := range fields {
+		if !containsFold(field.value, field.filter) {
+			return false
+		}
+	}
+
+	for _, tag := range f.Tags {
+		found := false
+		for _, t := range m.Tags {
+			if strings.EqualFold(t, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.Text != "" {
+		text := strings.Join(append([]string{m.Name, m.ShortDescription, m.Description}, m.Tags...), "\n")
+		if !containsFold(text, f.Text) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Diagnose checks the blueprint without saving it. Errors make the blueprint unusable,
+// warnings concern its meta information.
+func Diagnose(bp core.Blueprint, st *storage.Storage) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	fail := func(severity Severity, err error) {
+		diagnostics = append(diagnostics, Diagnostic{severity, err.Error()})
+	}
+
+	if err := bp.Meta.Validate(); err != nil {
+		fail(SeverityWarning, err)
+	}
+
+	if err := bp.Validate(); err != nil {
+		fail(SeverityError, err)
+		return diagnostics
+	}
+
+	missing := false
+	for _, ins := range bp.InstanceDefs {
+		if _, err := st.Load(ins.Operator); err != nil {
+			fail(SeverityError, err)
+			missing = true
+		}
+	}
+	if missing {
+		return diagnostics
+	}
+
+	// Creating a bundle loads and validates all dependencies
+	bundle, err := CreateBundle(&bp, st)
+	if err != nil {
+		fail(SeverityError, err)
+		return diagnostics
+	}
+
+	// Blueprints without generics and properties must also compile
+	if len(bp.PropertyDefs) == 0 && bp.GenericsSpecified() == nil {
+		blueprints := make([]core.Blueprint, 0, len(bundle.Blueprints))
+		for _, dep := range bundle.Blueprints {
+			blueprints = append(blueprints, dep)
+		}
+		if _, err := BuildAndCompile(bp.Id, core.Generics{}, core.Properties{}, *newSlangBundleStorage(blueprints)); err != nil {
+			fail(SeverityError, err)
+		}
+	}
+
+	return diagnostics
+}
+
+// Dependencies returns the ids of the blueprints used by the blueprint, with transitive also the blueprints
+// used by them. Ids are sorted.
+func Dependencies(bp *core.Blueprint, st *storage.Storage, transitive bool) ([]uuid.UUID, error) {
+	deps := make(map[uuid.UUID]bool)
+	if transitive {
+		bundle, err := CreateBundle(bp, st)
+		if err != nil {
+			return nil, err
+		}
+		for id := range bundle.Blueprints {
+			if id != bp.Id {
+				deps[id] = true
+			}
+		}
+	} else {
+		for _, ins := range bp.InstanceDefs {
+			deps[ins.Operator] = true
+		}
+	}
+	return sortedIds(deps), nil
+}
+
+// Dependents returns the ids of the blueprints of the storage using the blueprint, with transitive also
+// the blueprints using them. Blueprints which cannot be loaded are ignored. Ids are sorted.
+func Dependents(id uuid.UUID, st *storage.Storage, transitive bool) ([]uuid.UUID, error) {
+	dependents := make(map[uuid.UUID]bool)
+	queue := []uuid.UUID{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, userId := range st.Dependents(current) {
+			if dependents[userId] || userId == id {
+				continue
+			}
+			dependents[userId] = true
+			if transitive {
+				queue = append(queue, userId)
+			}
+		}
+	}
+	return sortedIds(dependents), nil
+}
+
+func sortedIds(set map[uuid.UUID]bool) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	return ids
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlueprintFilter_Matches(t *testing.T) {
+	a := assertions.New(t)
+	bp := &core.Blueprint{Meta: core.BlueprintMetaDef{
+		Name:             "Sum Numbers",
+		ShortDescription: "adds up a stream",
+		Tags:             []string{"math", "stream"},
+	}}
+
+	a.True(BlueprintFilter{}.Matches(bp))
+	a.True(BlueprintFilter{Name: "sum"}.Matches(bp))
+	a.False(BlueprintFilter{Name: "product"}.Matches(bp))
+	a.True(BlueprintFilter{Tags: []string{"Math", "stream"}}.Matches(bp))
+	a.False(BlueprintFilter{Tags: []string{"math", "string"}}.Matches(bp))
+	a.True(BlueprintFilter{Text: "adds"}.Matches(bp))
+	a.True(BlueprintFilter{Text: "math"}.Matches(bp))
+	a.False(BlueprintFilter{Text: "adds", ShortDescription: "subtracts"}.Matches(bp))
+}
+
+func TestDependencies_Dependents(t *testing.T) {
+	a := assertions.New(t)
+	st, dir := newTestStorage(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestBlueprint("c", valueId)
+	b := newTestBlueprint("b", c.Id)
+	main := newTestBlueprint("main", b.Id)
+	for _, bp := range []core.Blueprint{c, b, main} {
+		_, err := st.Save(bp)
+		require.NoError(t, err)
+	}
+
+	deps, err := Dependencies(&main, st, false)
+	a.NoError(err)
+	a.Equal([]uuid.UUID{b.Id}, deps)
+
+	deps, err = Dependencies(&main, st, true)
+	a.NoError(err)
+	a.Len(deps, 3)
+
+	dependents, err := Dependents(c.Id, st, false)
+	a.NoError(err)
+	a.Equal([]uuid.UUID{b.Id}, dependents)
+
+	dependents, err = Dependents(c.Id, st, true)
+	a.NoError(err)
+	a.ElementsMatch([]uuid.UUID{b.Id, main.Id}, dependents)
+}
+
+func TestDiagnose(t *testing.T) {
+	a := assertions.New(t)
+	st, dir := newTestStorage(t)
+	defer os.RemoveAll(dir)
+
+	valid := newTestBlueprint("Valid")
+	for _, d := range Diagnose(valid, st) {
+		a.NotEqual(SeverityError, d.Severity, d.Message)
+	}
+
+	missing := newTestBlueprint("Missing", uuid.New())
+	diagnostics := Diagnose(missing, st)
+	a.Len(diagnostics, 2)
+	a.Equal(SeverityWarning, diagnostics[0].Severity)
+	a.Equal(SeverityError, diagnostics[1].Severity)
+	a.False(st.IsSavedInWritableBackend(missing.Id))
+}
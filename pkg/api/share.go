@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/elem"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// ConflictPolicy decides what happens when an imported blueprint has the same id as a blueprint of the writable backend
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s", s)
+}
+
+type ImportResult struct {
+	Imported    []uuid.UUID             `json:"imported"`
+	Skipped     []uuid.UUID             `json:"skipped"`
+	Overwritten []uuid.UUID             `json:"overwritten"`
+	Renamed     map[uuid.UUID]uuid.UUID `json:"renamed"`
+}
+
+// GatherBlueprints returns the blueprint followed by all blueprints it depends on directly or indirectly.
+// Elementary blueprints are left out as they are part of every slang installation.
+func GatherBlueprints(bp *core.Blueprint, st *storage.Storage) ([]core.Blueprint, error) {
+	bundle := &core.SlangBundle{
+		Main:       bp.Id,
+		Blueprints: make(map[uuid.UUID]core.Blueprint),
+	}
+
+	if err := gatherDependencies(bp, bundle, st); err != nil {
+		return nil, err
+	}
+
+	blueprints := []core.Blueprint{*bp}
+	deps := make([]core.Blueprint, 0)
+	for id, dep := range bundle.Blueprints {
+		if id == bp.Id || elem.IsRegistered(id) {
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Id.String() < deps[j].Id.String()
+	})
+
+	return append(blueprints, deps...), nil
+}
+
+// ImportBlueprints saves the blueprints in the writable backend of the storage. Blueprints having the same id
+// as a blueprint already saved in the writable backend are handled according to the policy, with ConflictRename
+// they get a new id and references to them are adjusted. Nothing is saved if any blueprint is invalid or has
+// dependencies which are neither imported nor available in the storage.
+func ImportBlueprints(blueprints []core.Blueprint, st *storage.Storage, policy ConflictPolicy) (*ImportResult, error) {
+	result := &ImportResult{
+		Imported:    make([]uuid.UUID, 0),
+		Skipped:     make([]uuid.UUID, 0),
+		Overwritten: make([]uuid.UUID, 0),
+		Renamed:     make(map[uuid.UUID]uuid.UUID),
+	}
+
+	imported := make(map[uuid.UUID]bool)
+	toSave := make([]core.Blueprint, 0)
+	for _, bp := range blueprints {
+		if elem.IsRegistered(bp.Id) {
+			result.Skipped = append(result.Skipped, bp.Id)
+			continue
+		}
+		imported[bp.Id] = true
+
+		if !st.IsSavedInWritableBackend(bp.Id) {
+			toSave = append(toSave, bp.Copy(true))
+			continue
+		}
+
+		switch policy {
+		case ConflictSkip:
+			result.Skipped = append(result.Skipped, bp.Id)
+		case ConflictOverwrite:
+			result.Overwritten = append(result.Overwritten, bp.Id)
+			toSave = append(toSave, bp.Copy(true))
+		case ConflictRename:
+			result.Renamed[bp.Id] = uuid.New()
+			toSave = append(toSave, bp.Copy(true))
+		default:
+			return nil, fmt.Errorf("unknown conflict policy: %s", policy)
+		}
+	}
+
+	for i := range toSave {
+		bp := &toSave[i]
+		if newId, ok := result.Renamed[bp.Id]; ok {
+			bp.Id = newId
+		}
+		for _, ins := range bp.InstanceDefs {
+			if newId, ok := result.Renamed[ins.Operator]; ok {
+				ins.Operator = newId
+			}
+		}
+	}
+
+	for _, bp := range toSave {
+		if err := bp.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", bp.Id, err)
+		}
+		for _, ins := range bp.InstanceDefs {
+			if imported[ins.Operator] || isRenamed(result, ins.Operator) {
+				continue
+			}
+			if _, err := st.Load(ins.Operator); err != nil {
+				return nil, fmt.Errorf("%s: missing dependency %s", bp.Id, ins.Operator)
+			}
+		}
+	}
+
+	for _, bp := range toSave {
+		if _, err := st.Save(bp); err != nil {
+			return result, err
+		}
+		result.Imported = append(result.Imported, bp.Id)
+	}
+
+	return result, nil
+}
+
+func isRenamed(result *ImportResult, id uuid.UUID) bool {
+	for _, newId := range result.Renamed {
+		if newId == id {
+			return true
+		}
+	}
+	return false
+}
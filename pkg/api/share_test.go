@@ -0,0 +1,123 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// valueId is the elementary value operator
+var valueId = uuid.MustParse("8b62495a-e482-4a3e-8020-0ab8a350ad2d")
+
+func newTestBlueprint(name string, deps ...uuid.UUID) core.Blueprint {
+	bp := core.Blueprint{
+		Id:   uuid.New(),
+		Meta: core.BlueprintMetaDef{Name: name},
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {
+				In:  core.TypeDef{Type: "trigger"},
+				Out: core.TypeDef{Type: "trigger"},
+			},
+		},
+		Connections: map[string][]string{"(": {")"}},
+	}
+	for i, dep := range deps {
+		bp.InstanceDefs = append(bp.InstanceDefs, &core.InstanceDef{
+			Name:       string(rune('a' + i)),
+			Operator:   dep,
+			Generics:   core.Generics{"valueType": {Type: "trigger"}},
+			Properties: core.Properties{"value": nil},
+		})
+	}
+	return bp
+}
+
+func newTestStorage(t *testing.T) (*storage.Storage, string) {
+	dir, err := ioutil.TempDir("", "slang-share")
+	require.NoError(t, err)
+	return storage.NewStorage().AddBackend(storage.NewWritableFileSystem(dir)), dir
+}
+
+func TestGatherBlueprints__WithoutElementaries(t *testing.T) {
+	a := assertions.New(t)
+	st, dir := newTestStorage(t)
+	defer os.RemoveAll(dir)
+
+	c := newTestBlueprint("c", valueId)
+	b := newTestBlueprint("b", c.Id)
+	main := newTestBlueprint("main", b.Id, c.Id)
+	for _, bp := range []core.Blueprint{c, b, main} {
+		_, err := st.Save(bp)
+		require.NoError(t, err)
+	}
+
+	blueprints, err := GatherBlueprints(&main, st)
+	a.NoError(err)
+	a.Len(blueprints, 3)
+	a.Equal(main.Id, blueprints[0].Id)
+	for _, bp := range blueprints {
+		a.NotEqual(valueId, bp.Id)
+	}
+}
+
+func TestImportBlueprints__ConflictPolicies(t *testing.T) {
+	a := assertions.New(t)
+
+	dep := newTestBlueprint("dep")
+	main := newTestBlueprint("main", dep.Id)
+
+	existing := dep
+	existing.Meta.Name = "existing"
+
+	for _, policy := range []ConflictPolicy{ConflictSkip, ConflictOverwrite, ConflictRename} {
+		st, dir := newTestStorage(t)
+		_, err := st.Save(existing)
+		require.NoError(t, err)
+
+		result, err := ImportBlueprints([]core.Blueprint{main, dep}, st, policy)
+		a.NoError(err)
+
+		saved, _ := st.Load(dep.Id)
+		switch policy {
+		case ConflictSkip:
+			a.Equal([]uuid.UUID{dep.Id}, result.Skipped)
+			a.Equal([]uuid.UUID{main.Id}, result.Imported)
+			a.Equal("existing", saved.Meta.Name)
+		case ConflictOverwrite:
+			a.Equal([]uuid.UUID{dep.Id}, result.Overwritten)
+			a.Len(result.Imported, 2)
+			a.Equal("dep", saved.Meta.Name)
+		case ConflictRename:
+			newId := result.Renamed[dep.Id]
+			a.NotEqual(uuid.Nil, newId)
+			a.Equal("existing", saved.Meta.Name)
+
+			renamed, err := st.Load(newId)
+			a.NoError(err)
+			a.Equal("dep", renamed.Meta.Name)
+
+			importedMain, err := st.Load(main.Id)
+			a.NoError(err)
+			a.Equal(newId, importedMain.InstanceDefs[0].Operator)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestImportBlueprints__MissingDependency(t *testing.T) {
+	a := assertions.New(t)
+	st, dir := newTestStorage(t)
+	defer os.RemoveAll(dir)
+
+	main := newTestBlueprint("main", uuid.New())
+	_, err := ImportBlueprints([]core.Blueprint{main}, st, ConflictSkip)
+	a.Error(err)
+	a.False(st.IsSavedInWritableBackend(main.Id))
+}
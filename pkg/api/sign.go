@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	privateKeyBlock = "SLANG PRIVATE KEY"
+	publicKeyBlock  = "SLANG PUBLIC KEY"
+)
+
+// TrustPolicy decides which slang bundles BuildOperator accepts.
+// Bundles with an invalid signature are always refused. If signatures are required a bundle needs a valid
+// signature of one of the trusted keys.
+type TrustPolicy struct {
+	RequireSignature bool
+	TrustedKeys      []ed25519.PublicKey
+}
+
+// Check verifies the signatures of the bundle against the policy
+func (p TrustPolicy) Check(bundle *core.SlangBundle) error {
+	signatures, err := VerifyBundle(bundle)
+	if err != nil {
+		return err
+	}
+	if !p.RequireSignature {
+		return nil
+	}
+	if len(signatures) == 0 {
+		return errors.New("bundle is not signed")
+	}
+	for _, sig := range signatures {
+		if p.trusts(sig.PublicKey) {
+			return nil
+		}
+	}
+	return fmt.Errorf("bundle is not signed by a trusted key, signed by %s", strings.Join(keyIds(signatures), ", "))
+}
+
+func (p TrustPolicy) trusts(pub ed25519.PublicKey) bool {
+	for _, key := range p.TrustedKeys {
+		if bytes.Equal(key, pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyId is the short fingerprint of a public key
+func KeyId(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignBundle adds the signature of the key to the bundle, replacing an earlier signature of the same key
+func SignBundle(bundle *core.SlangBundle, priv ed25519.PrivateKey) error {
+	content, err := canonicalBundle(bundle)
+	if err != nil {
+		return err
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	sig := core.BundleSignature{
+		KeyId:     KeyId(pub),
+		PublicKey: pub,
+		Signature: ed25519.Sign(priv, content),
+	}
+
+	signatures := []core.BundleSignature{sig}
+	for _, s := range bundle.Signatures {
+		if s.KeyId != sig.KeyId {
+			signatures = append(signatures, s)
+		}
+	}
+	bundle.Signatures = signatures
+	return nil
+}
+
+// VerifyBundle returns the signatures of the bundle, it fails if one of them does not match its content
+func VerifyBundle(bundle *core.SlangBundle) ([]core.BundleSignature, error) {
+	if len(bundle.Signatures) == 0 {
+		return nil, nil
+	}
+	content, err := canonicalBundle(bundle)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range bundle.Signatures {
+		if len(sig.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("signature %s: invalid public key", sig.KeyId)
+		}
+		pub := ed25519.PublicKey(sig.PublicKey)
+		if sig.KeyId != KeyId(pub) {
+			return nil, fmt.Errorf("signature %s: key id does not match public key", sig.KeyId)
+		}
+		if !ed25519.Verify(pub, content, sig.Signature) {
+			return nil, fmt.Errorf("signature %s does not match the bundle, it has been modified", sig.KeyId)
+		}
+	}
+	return bundle.Signatures, nil
+}
+
+// canonicalBundle is the signed content of the bundle: main, blueprints and arguments as JSON with sorted keys
+func canonicalBundle(bundle *core.SlangBundle) ([]byte, error) {
+	b, err := json.Marshal(struct {
+		Main       uuid.UUID                    `json:"main"`
+		Blueprints map[uuid.UUID]core.Blueprint `json:"blueprints"`
+		Args       interface{}                  `json:"args"`
+	}{bundle.Main, bundle.Blueprints, bundle.Args})
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoding and encoding again makes the content independent of how the blueprints have been read
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// hasSignedArgs tells whether the arguments are the ones of the bundle, which are covered by its signatures
+func hasSignedArgs(bundle *core.SlangBundle, gens core.Generics, props core.Properties) bool {
+	type args struct {
+		Generics   core.Generics   `json:"generics,omitempty"`
+		Properties core.Properties `json:"properties,omitempty"`
+	}
+	given, err := json.Marshal(args{gens, props})
+	if err != nil {
+		return false
+	}
+	signed, err := json.Marshal(args{bundle.Args.Generics, bundle.Args.Properties})
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(given, signed)
+}
+
+func keyIds(signatures []core.BundleSignature) []string {
+	ids := make([]string, 0, len(signatures))
+	for _, sig := range signatures {
+		ids = append(ids, sig.KeyId)
+	}
+	return ids
+}
+
+// EncodePrivateKey encodes the private key as PEM
+func EncodePrivateKey(priv ed25519.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: privateKeyBlock, Bytes: priv.Seed()})
+}
+
+// EncodePublicKey encodes the public key as PEM
+func EncodePublicKey(pub ed25519.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyBlock, Bytes: pub})
+}
+
+func ParsePrivateKey(b []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != privateKeyBlock || len(block.Bytes) != ed25519.SeedSize {
+		return nil, errors.New("not a slang private key")
+	}
+	return ed25519.NewKeyFromSeed(block.Bytes), nil
+}
+
+func ParsePublicKey(b []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != publicKeyBlock || len(block.Bytes) != ed25519.PublicKeySize {
+		return nil, errors.New("not a slang public key")
+	}
+	return ed25519.PublicKey(block.Bytes), nil
+}
+
+// ReadTrustedKeys reads the public keys *.pub of the directory sorted by file name, a missing directory has none
+func ReadTrustedKeys(dir string) ([]ed25519.PublicKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	keys := make([]ed25519.PublicKey, 0, len(files))
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := ParsePublicKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		keys = append(keys, pub)
+	}
+	return keys, nil
+}
+
+// ReadPrivateKey reads a private key written with EncodePrivateKey
+func ReadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("key %s does not exist", file)
+	} else if err != nil {
+		return nil, err
+	}
+	priv, err := ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return priv, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+)
+
+func newSignedTestBundle(t *testing.T, priv ed25519.PrivateKey) *core.SlangBundle {
+	st, dir := newTestStorage(t)
+	defer os.RemoveAll(dir)
+
+	dep := newTestBlueprint("dep")
+	main := newTestBlueprint("main", dep.Id)
+	for _, bp := range []core.Blueprint{dep, main} {
+		_, err := st.Save(bp)
+		require.NoError(t, err)
+	}
+	loaded, err := st.Load(main.Id)
+	require.NoError(t, err)
+	bundle, err := CreateBundle(loaded, st)
+	require.NoError(t, err)
+	require.NoError(t, SignBundle(bundle, priv))
+
+	// Verification happens on the bundle as read from its file
+	b, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	var read core.SlangBundle
+	require.NoError(t, json.Unmarshal(b, &read))
+	return &read
+}
+
+func TestTrustPolicy_Check(t *testing.T) {
+	a := assertions.New(t)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	bundle := newSignedTestBundle(t, priv)
+	a.Len(bundle.Signatures, 1)
+	a.Equal(KeyId(pub), bundle.Signatures[0].KeyId)
+
+	a.NoError(TrustPolicy{}.Check(bundle))
+	a.NoError(TrustPolicy{RequireSignature: true, TrustedKeys: []ed25519.PublicKey{otherPub, pub}}.Check(bundle))
+	a.Error(TrustPolicy{RequireSignature: true, TrustedKeys: []ed25519.PublicKey{otherPub}}.Check(bundle))
+
+	// Arguments stored in the bundle are signed
+	bundle.Args.Properties = core.Properties{"value": 1}
+	a.Error(TrustPolicy{}.Check(bundle))
+
+	// Signing again replaces the signature of the key
+	a.NoError(SignBundle(bundle, priv))
+	a.Len(bundle.Signatures, 1)
+
+	unsigned := *bundle
+	unsigned.Signatures = nil
+	a.NoError(TrustPolicy{}.Check(&unsigned))
+	a.Error(TrustPolicy{RequireSignature: true, TrustedKeys: []ed25519.PublicKey{pub}}.Check(&unsigned))
+
+	// Modified bundles are refused even if signatures are not required
+	for id, bp := range bundle.Blueprints {
+		bp.Meta.Name = "modified"
+		bundle.Blueprints[id] = bp
+		break
+	}
+	a.Error(TrustPolicy{}.Check(bundle))
+}
+
+func TestBuildOperator__TrustPolicy(t *testing.T) {
+	a := assertions.New(t)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	bundle := newSignedTestBundle(t, priv)
+	// The main blueprint outputs its property value
+	main := bundle.Blueprints[bundle.Main]
+	main.PropertyDefs = core.TypeDefMap{"value": {Type: "string"}}
+	main.ServiceDefs[core.MAIN_SERVICE].Out = core.TypeDef{Type: "string"}
+	main.InstanceDefs = core.InstanceDefList{{
+		Name:       "a",
+		Operator:   valueId,
+		Generics:   core.Generics{"valueType": {Type: "string"}},
+		Properties: core.Properties{"value": "$value"},
+	}}
+	main.Connections = map[string][]string{"(": {"(a"}, "a)": {")"}}
+	bundle.Blueprints[bundle.Main] = main
+	bundle.Args.Properties = core.Properties{"value": "signed"}
+	require.NoError(t, SignBundle(bundle, priv))
+	unsigned := *bundle
+	unsigned.Signatures = nil
+	policy := TrustPolicy{RequireSignature: true, TrustedKeys: []ed25519.PublicKey{pub}}
+
+	_, err = BuildOperator(&unsigned, policy)
+	a.Error(err)
+	op, err := BuildOperator(bundle, policy)
+	a.NoError(err)
+	a.Equal("signed", op.Child("a").Property("value"))
+
+	// The signed arguments cannot be replaced when signatures are required
+	_, err = BuildOperatorWithArgs(bundle, policy, core.Generics{}, core.Properties{})
+	a.Error(err)
+	_, err = BuildOperatorWithArgs(bundle, policy, core.Generics{}, core.Properties{"value": "replaced"})
+	a.Error(err)
+	op, err = BuildOperatorWithArgs(bundle, policy, core.Generics{}, core.Properties{"value": "signed"})
+	a.NoError(err)
+	a.Equal("signed", op.Child("a").Property("value"))
+
+	op, err = BuildOperatorWithArgs(bundle, TrustPolicy{}, core.Generics{}, core.Properties{"value": "replaced"})
+	a.NoError(err)
+	a.Equal("replaced", op.Child("a").Property("value"))
+}
+
+func TestKeyEncoding(t *testing.T) {
+	a := assertions.New(t)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	parsedPriv, err := ParsePrivateKey(EncodePrivateKey(priv))
+	a.NoError(err)
+	a.Equal(priv, parsedPriv)
+	parsedPub, err := ParsePublicKey(EncodePublicKey(pub))
+	a.NoError(err)
+	a.Equal(pub, parsedPub)
+
+	_, err = ParsePublicKey(EncodePrivateKey(priv))
+	a.Error(err)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -11,8 +12,21 @@ import (
 	"github.com/google/uuid"
 )
 
-// todo should be SlangBundle method
-func BuildOperator(bundle *core.SlangBundle) (*core.Operator, error) {
+// BuildOperator builds the bundle with the arguments it carries, it is refused if it does not satisfy the policy
+func BuildOperator(bundle *core.SlangBundle, policy TrustPolicy) (*core.Operator, error) {
+	return BuildOperatorWithArgs(bundle, policy, bundle.Args.Generics, bundle.Args.Properties)
+}
+
+// BuildOperatorWithArgs builds the bundle with other arguments than the ones it carries, e.g. given when running it.
+// The arguments are part of the signed content, so they cannot be replaced if the policy requires signatures.
+func BuildOperatorWithArgs(bundle *core.SlangBundle, policy TrustPolicy, gens core.Generics, props core.Properties) (*core.Operator, error) {
+	if err := policy.Check(bundle); err != nil {
+		return nil, err
+	}
+	if policy.RequireSignature && !hasSignedArgs(bundle, gens, props) {
+		return nil, errors.New("arguments of the bundle cannot be replaced when signatures are required")
+	}
+
 	if !bundle.Valid() {
 		if err := bundle.Validate(); err != nil {
 			return nil, err
@@ -21,7 +35,7 @@ func BuildOperator(bundle *core.SlangBundle) (*core.Operator, error) {
 
 	stor := newSlangBundleStorage(funk.Values(bundle.Blueprints).([]core.Blueprint))
 
-	return BuildAndCompile(bundle.Main, bundle.Args.Generics, bundle.Args.Properties, *stor)
+	return BuildAndCompile(bundle.Main, gens, props, *stor)
 }
 
 func gatherDependencies(def *core.Blueprint, bundle *core.SlangBundle, store *storage.Storage) error {
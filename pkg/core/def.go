@@ -878,9 +878,19 @@ type SlangBundle struct {
 
 	Blueprints map[uuid.UUID]Blueprint `json:"blueprints"`
 
+	// Signatures cover main, blueprints and arguments, see api.SignBundle
+	Signatures []BundleSignature `json:"signatures,omitempty" yaml:"signatures,omitempty"`
+
 	valid bool
 }
 
+// BundleSignature is an ed25519 signature of a slang bundle together with the public key it can be verified with
+type BundleSignature struct {
+	KeyId     string `json:"keyId" yaml:"keyId"`
+	PublicKey []byte `json:"publicKey" yaml:"publicKey"`
+	Signature []byte `json:"signature" yaml:"signature"`
+}
+
 func (sb SlangBundle) Valid() bool {
 	return sb.valid
 }
@@ -94,6 +94,14 @@ func (o *Operator) Service(srv string) *Service {
 	return nil
 }
 
+func (o *Operator) Meta() BlueprintMetaDef {
+	return o.defMeta
+}
+
+func (o *Operator) Services() map[string]*Service {
+	return o.services
+}
+
 func (o *Operator) Main() *Service {
 	return o.services[MAIN_SERVICE]
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -40,6 +41,32 @@ type PH struct {
 	t string
 }
 
+// portChannels are the buffer of a port and the channel which is closed when the port is closed.
+// They are replaced as a whole when the port is reopened.
+type portChannels struct {
+	buf  chan interface{}
+	done chan struct{}
+}
+
+// remaining returns an item left in the buffer of a closed port or nil
+func (c *portChannels) remaining() interface{} {
+	select {
+	case i := <-c.buf:
+		return i
+	default:
+		return nil
+	}
+}
+
+func (c *portChannels) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 var PHSingle = &PH{"..."}
 var PHMultiple = &PH{"[...]"}
 
@@ -60,9 +87,11 @@ type Port struct {
 	sub  *Port
 	subs map[string]*Port
 
-	buf    chan interface{}
-	mutex  sync.Mutex
-	closed bool
+	// Holds *portChannels, pushing and pulling items reads it without locking
+	channels atomic.Value
+	mutex    sync.Mutex
+	// Serializes opening and closing the port
+	closeMutex sync.Mutex
 }
 
 // Makes a new port.
@@ -89,6 +118,7 @@ func NewPort(srv *Service, del *Delegate, def TypeDef, dir int) (*Port, error) {
 	p.service = srv
 	p.delegate = del
 	p.dests = make(map[*Port]bool)
+	p.channels.Store(&portChannels{done: make(chan struct{})})
 
 	var err error
 	switch def.Type {
@@ -125,7 +155,7 @@ func NewPort(srv *Service, del *Delegate, def TypeDef, dir int) (*Port, error) {
 	}
 
 	if p.PrimitiveType() && dir == DIRECTION_IN && p.operator != nil && p.operator.function != nil {
-		p.buf = make(chan interface{}, CHANNEL_SIZE)
+		p.setBuffer(make(chan interface{}, CHANNEL_SIZE))
 	}
 
 	return p, nil
@@ -274,15 +304,19 @@ func (p *Port) Connected(q *Port) bool {
 
 // Opens the port by opening all channels
 func (p *Port) Open() {
-	if !p.closed {
+	p.closeMutex.Lock()
+	c := p.chans()
+	if !c.closed() {
+		p.closeMutex.Unlock()
 		return
 	}
 
-	p.closed = false
-
-	if p.buf != nil {
-		p.buf = make(chan interface{}, CHANNEL_SIZE)
+	opened := &portChannels{done: make(chan struct{})}
+	if c.buf != nil {
+		opened.buf = make(chan interface{}, CHANNEL_SIZE)
 	}
+	p.channels.Store(opened)
+	p.closeMutex.Unlock()
 
 	if p.sub != nil {
 		p.sub.Open()
@@ -296,16 +330,16 @@ func (p *Port) Open() {
 }
 
 // Closes the port by closing all channels
+// Items waiting in the buffer can still be pulled, then Pull returns nil. Pushes blocked on a full buffer return.
 func (p *Port) Close() {
-	if p.closed {
+	p.closeMutex.Lock()
+	c := p.chans()
+	if c.closed() {
+		p.closeMutex.Unlock()
 		return
 	}
-
-	p.closed = true
-
-	if p.buf != nil {
-		close(p.buf)
-	}
+	close(c.done)
+	p.closeMutex.Unlock()
 
 	if p.sub != nil {
 		p.sub.Close()
@@ -401,21 +435,31 @@ func (p *Port) DirectlyConnected() error {
 	return nil
 }
 
+func (p *Port) chans() *portChannels {
+	return p.channels.Load().(*portChannels)
+}
+
+// setBuffer replaces the buffer keeping the open state of the port
+func (p *Port) setBuffer(buf chan interface{}) {
+	p.channels.Store(&portChannels{buf: buf, done: p.chans().done})
+}
+
 func (p *Port) assertChannelSpace() {
-	c := cap(p.buf)
-	if len(p.buf) > c/2 {
+	buf := p.chans().buf
+	c := cap(buf)
+	if len(buf) > c/2 {
 		newChan := make(chan interface{}, 2*c)
 		p.mutex.Lock()
 		for {
 			select {
-			case i := <-p.buf:
+			case i := <-buf:
 				newChan <- i
 			default:
 				goto end
 			}
 		}
 	end:
-		p.buf = newChan
+		p.setBuffer(newChan)
 		p.mutex.Unlock()
 	}
 }
@@ -433,25 +477,36 @@ func (p *Port) WalkPrimitivePorts(handle func(p *Port)) {
 		p.Map(pname).WalkPrimitivePorts(handle)
 	}
 }
+
 func (p *Port) Closed() bool {
-	return p.closed
+	return p.chans().closed()
 }
 
 // Push an item to this port.
+// Pushing to a closed port drops the item, a push waiting for buffer space returns when the port is closed.
 func (p *Port) Push(item interface{}) {
-	if p.closed {
+	c := p.chans()
+	if c.closed() {
 		return
 	}
 
-	if p.buf != nil {
+	if c.buf != nil {
 		if CHANNEL_DYNAMIC {
 			p.assertChannelSpace()
 
 			p.mutex.Lock()
-			p.buf <- item
+			c = p.chans()
+			select {
+			case c.buf <- item:
+			case <-c.done:
+			}
 			p.mutex.Unlock()
 		} else {
-			p.buf <- item
+			select {
+			case c.buf <- item:
+			case <-c.done:
+				return
+			}
 		}
 	}
 
@@ -523,21 +578,30 @@ func (p *Port) Pull() interface{} {
 		panic("cannot pull from generic")
 	}
 
-	if p.buf != nil {
+	if c := p.chans(); c.buf != nil {
 		if CHANNEL_DYNAMIC {
 			for {
 				p.mutex.Lock()
+				c = p.chans()
 				select {
-				case i := <-p.buf:
+				case i := <-c.buf:
 					p.mutex.Unlock()
 					return i
 				default:
 					p.mutex.Unlock()
 				}
+				if c.closed() {
+					return nil
+				}
 				time.Sleep(1 * time.Millisecond)
 			}
 		} else {
-			return <-p.buf
+			select {
+			case i := <-c.buf:
+				return i
+			case <-c.done:
+				return c.remaining()
+			}
 		}
 	}
 
@@ -664,13 +728,14 @@ func (p *Port) PullEOS() bool {
 
 // Similar to Port.Pull but will return nil when there is no item after timeout
 func (p *Port) Poll() interface{} {
-	if p.buf == nil {
+	c := p.chans()
+	if c.buf == nil {
 		panic("no buffer")
 	}
 
-	if len(p.buf) == 0 {
+	if len(c.buf) == 0 {
 		time.Sleep(200 * time.Millisecond)
-		if len(p.buf) == 0 {
+		if len(c.buf) == 0 {
 			return nil
 		}
 	}
@@ -678,10 +743,10 @@ func (p *Port) Poll() interface{} {
 	var i interface{}
 	if CHANNEL_DYNAMIC {
 		p.mutex.Lock()
-		i = <-p.buf
+		i = p.chans().remaining()
 		p.mutex.Unlock()
 	} else {
-		i = <-p.buf
+		i = c.remaining()
 	}
 
 	return i
@@ -725,12 +790,12 @@ func (p *Port) Name() string {
 }
 
 func (p *Port) Bufferize() {
-	if p.buf != nil {
+	if p.chans().buf != nil {
 		return
 	}
 
 	if p.PrimitiveType() {
-		p.buf = make(chan interface{}, CHANNEL_SIZE)
+		p.setBuffer(make(chan interface{}, CHANNEL_SIZE))
 	} else if p.itemType == TYPE_MAP {
 		for _, sub := range p.subs {
 			sub.Bufferize()
@@ -7,11 +7,17 @@ import (
 type Synchronizer struct {
 	out     *Port
 	in      *Port
-	queue   chan int64
-	tasks   map[int64]chan pullFunc
-	done    map[int64]chan bool
+	queue   chan syncTask
+	tasks   map[int64]syncTask
 	mutex   *sync.Mutex
 	counter int64
+	// Guards tasks, mutex is held while waiting for the worker and cannot be used by Pull
+	tasksMutex *sync.Mutex
+}
+
+type syncTask struct {
+	pull chan pullFunc
+	done chan bool
 }
 
 type pushFunc func(port *Port)
@@ -20,10 +26,10 @@ type pullFunc func(port *Port)
 func (s *Synchronizer) Init(in, out *Port) {
 	s.in = in
 	s.out = out
-	s.queue = make(chan int64)
-	s.tasks = make(map[int64]chan pullFunc)
-	s.done = make(map[int64]chan bool)
+	s.queue = make(chan syncTask)
+	s.tasks = make(map[int64]syncTask)
 	s.mutex = &sync.Mutex{}
+	s.tasksMutex = &sync.Mutex{}
 }
 
 func (s *Synchronizer) Push(push pushFunc) int64 {
@@ -31,26 +37,31 @@ func (s *Synchronizer) Push(push pushFunc) int64 {
 	s.counter++
 	token := s.counter
 	push(s.out)
-	s.tasks[token] = make(chan pullFunc)
-	s.done[token] = make(chan bool)
-	s.queue <- token // order is important! worker expects to have s.tasks[token] once it can pull the token from queue
+	task := syncTask{make(chan pullFunc), make(chan bool)}
+	s.tasksMutex.Lock()
+	s.tasks[token] = task
+	s.tasksMutex.Unlock()
+	s.queue <- task // order is important! worker pulls in the same order items have been pushed
 	s.mutex.Unlock()
 
 	return token
 }
 
 func (s *Synchronizer) Pull(token int64, pull pullFunc) {
-	s.tasks[token] <- pull
-	<-s.done[token]
+	s.tasksMutex.Lock()
+	task := s.tasks[token]
 	delete(s.tasks, token)
-	delete(s.done, token)
+	s.tasksMutex.Unlock()
+
+	task.pull <- pull
+	<-task.done
 }
 
 func (s *Synchronizer) Worker() {
 	for {
-		token := <-s.queue
-		pull := <-s.tasks[token]
+		task := <-s.queue
+		pull := <-task.pull
 		pull(s.in)
-		s.done[token] <- true
+		task.done <- true
 	}
 }
@@ -0,0 +1,265 @@
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// Authenticator finds out which user made a request
+type Authenticator interface {
+	// Authenticate returns the user of the request or nil if the request carries no valid credentials
+	Authenticate(r *http.Request) (*UserID, error)
+}
+
+type userEntry struct {
+	Name string `yaml:"name"`
+	// Commits of the user are attributed to this email, name@localhost if it is empty
+	Email string `yaml:"email"`
+	// bcrypt hash of the password, see HashPassword
+	Password string `yaml:"password"`
+	// SHA-256 hashes of the API tokens of the user, see HashToken
+	Tokens []string `yaml:"tokens"`
+	Admin  bool     `yaml:"admin"`
+}
+
+// UserFile authenticates users listed in a YAML file like
+//
+//	users:
+//	- name: alice
+//	  email: alice@example.com
+//	  password: $2a$10$...
+//	  tokens: [9f86d081884c7d65...]
+//	  admin: true
+//
+// Requests authenticate with HTTP basic auth, with an API token as bearer token or, as browsers cannot
+// set headers for websockets, with an API token as query parameter `token`.
+type UserFile struct {
+	passwords map[string]string
+	tokens    map[string]*UserID
+	users     map[string]*UserID
+
+	// Remembers verified passwords as bcrypt is meant to be slow
+	mutex    *sync.Mutex
+	verified map[[sha256.Size]byte]*UserID
+}
+
+func LoadUserFile(file string) (*UserFile, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var content struct {
+		Users []userEntry `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(b, &content); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	uf := &UserFile{
+		passwords: make(map[string]string),
+		tokens:    make(map[string]*UserID),
+		users:     make(map[string]*UserID),
+		mutex:     &sync.Mutex{},
+		verified:  make(map[[sha256.Size]byte]*UserID),
+	}
+	for _, entry := range content.Users {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("%s: user without name", file)
+		}
+		if _, ok := uf.users[entry.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate user %s", file, entry.Name)
+		}
+		user := &UserID{Name: entry.Name, Email: entry.Email, Admin: entry.Admin}
+		uf.users[entry.Name] = user
+		if entry.Password != "" {
+			uf.passwords[entry.Name] = entry.Password
+		}
+		for _, token := range entry.Tokens {
+			uf.tokens[strings.ToLower(token)] = user
+		}
+	}
+	return uf, nil
+}
+
+// Users returns the number of users in the file
+func (uf *UserFile) Users() int {
+	return len(uf.users)
+}
+
+func (uf *UserFile) Authenticate(r *http.Request) (*UserID, error) {
+	if name, password, ok := r.BasicAuth(); ok {
+		return uf.verifyPassword(name, password), nil
+	}
+
+	var token string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if websocket.IsWebSocketUpgrade(r) {
+		// Browsers cannot set headers when opening a websocket, elsewhere query tokens would end up in logs
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil, nil
+	}
+	return uf.tokens[HashToken(token)], nil
+}
+
+func (uf *UserFile) verifyPassword(name string, password string) *UserID {
+	hash, ok := uf.passwords[name]
+	if !ok {
+		return nil
+	}
+
+	key := sha256.Sum256([]byte(name + "\x00" + password))
+	uf.mutex.Lock()
+	user, ok := uf.verified[key]
+	uf.mutex.Unlock()
+	if ok {
+		return user
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil
+	}
+	user = uf.users[name]
+	uf.mutex.Lock()
+	uf.verified[key] = user
+	uf.mutex.Unlock()
+	return user
+}
+
+// HashPassword returns the hash of the password as it is stored in the user file
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// HashToken returns the hash of the API token as it is stored in the user file
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken generates a random API token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authenticate rejects requests without valid credentials and attaches the user to the others.
+// Without authenticator all requests are made by `Root`.
+func authenticate(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// CORS preflight requests never carry credentials
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := auth.Authenticate(r)
+		if err != nil || user == nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="slang"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, &Error{Msg: "authentication required", Code: "E000X"})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// ownerRegistry keeps track of which user owns which blueprint. Blueprints without owner
+// can only be changed by admins.
+type ownerRegistry struct {
+	mutex  *sync.RWMutex
+	file   string
+	owners map[uuid.UUID]string
+}
+
+func newOwnerRegistry() *ownerRegistry {
+	return &ownerRegistry{mutex: &sync.RWMutex{}, owners: make(map[uuid.UUID]string)}
+}
+
+// Load reads the owners from the file and keeps persisting them there
+func (reg *ownerRegistry) Load(file string) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	reg.file = file
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &reg.owners); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+// mayChange tells whether the user is allowed to save the blueprint to the writable backend of the storage.
+// Owners are kept across workspaces, so only the owner may save a blueprint in any workspace. Blueprints without
+// owner may be saved if they do not exist yet. Blueprints of read-only backends may only be overridden by admins,
+// otherwise they would be shadowed for everyone using the storage.
+func (reg *ownerRegistry) mayChange(user *UserID, id uuid.UUID, st *storage.Storage) bool {
+	if user.Admin {
+		return true
+	}
+	if st.IsSavedInReadOnlyBackend(id) {
+		return false
+	}
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	if owner, ok := reg.owners[id]; ok {
+		return owner == user.Name
+	}
+	return !st.IsSavedInWritableBackend(id)
+}
+
+// owner returns the owner of the blueprint or nil if it has none
+func (reg *ownerRegistry) owner(id uuid.UUID) *UserID {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	if name, ok := reg.owners[id]; ok {
+		return &UserID{Name: name}
+	}
+	return nil
+}
+
+// claim makes the user the owner of the blueprint unless it has an owner already
+func (reg *ownerRegistry) claim(user *UserID, id uuid.UUID) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+
+	if _, ok := reg.owners[id]; ok {
+		return nil
+	}
+	reg.owners[id] = user.Name
+	if reg.file == "" {
+		return nil
+	}
+	return writeFileAtomic(reg.file, reg.owners)
+}
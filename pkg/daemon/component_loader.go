@@ -3,8 +3,12 @@ package daemon
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,34 +18,36 @@ import (
 )
 
 type SlangComponentLoader struct {
-	github          *github.Client
-	latestRelease   *github.RepositoryRelease
-	owner           string
+	source          ComponentSource
+	release         *ComponentRelease
+	releaseErr      error
 	repo            string
 	path            string
 	latest          string
 	versionFilePath string
+	requireChecksum bool
 }
 
 func NewComponentLoaderLatestRelease(repo string, path string) *SlangComponentLoader {
-	return newComponentLoader(repo, path, "release")
-
+	return NewComponentLoader(repo, path, NewGithubSource("Bitspark"))
 }
 
 func NewComponentLoaderLatestMaster(repo string, path string) *SlangComponentLoader {
-	return newComponentLoader(repo, path, "master")
+	return newComponentLoader(repo, path, NewGithubSource("Bitspark"), "master")
+}
 
+// NewComponentLoader loads the latest release of the component from the source into the path
+func NewComponentLoader(repo string, path string, source ComponentSource) *SlangComponentLoader {
+	return newComponentLoader(repo, path, source, "release")
 }
 
-func newComponentLoader(repo string, path string, latest string) *SlangComponentLoader {
+func newComponentLoader(repo string, path string, source ComponentSource, latest string) *SlangComponentLoader {
 	dl := &SlangComponentLoader{
-		github.NewClient(nil),
-		nil,
-		"Bitspark",
-		repo,
-		path,
-		latest,
-		filepath.Join(path, ".VERSION"),
+		source:          source,
+		repo:            repo,
+		path:            path,
+		latest:          latest,
+		versionFilePath: filepath.Join(path, ".VERSION"),
 	}
 	if latest == "release" {
 		dl.fetchLatestRelease()
@@ -49,6 +55,17 @@ func newComponentLoader(repo string, path string, latest string) *SlangComponent
 	return dl
 }
 
+// SetRequireChecksum makes loading fail for archives without a checksum instead of installing them unverified
+func (dl *SlangComponentLoader) SetRequireChecksum(require bool) *SlangComponentLoader {
+	dl.requireChecksum = require
+	return dl
+}
+
+// Err returns why the latest release could not be found, e.g. because there is no network
+func (dl *SlangComponentLoader) Err() error {
+	return dl.releaseErr
+}
+
 func (dl *SlangComponentLoader) NewerVersionExists() bool {
 	localVersion := dl.GetLocalReleaseVersion()
 	latestVersion := dl.GetLatestReleaseVersion()
@@ -60,17 +77,14 @@ func (dl *SlangComponentLoader) NewerVersionExists() bool {
 
 /*
  * Downloads & unpacks latest version of a component.
+ * If unpacking fails the previous version is restored.
  */
 func (dl *SlangComponentLoader) Load() error {
 	if dl.latest == "release" {
-		release := dl.latestRelease
-
-		if len(release.Assets) == 0 {
-			return fmt.Errorf("release '%v' needs at least 1 asset which can be downloaded", release.Name)
+		if dl.release == nil {
+			return fmt.Errorf("no release of %s found: %v", dl.repo, dl.releaseErr)
 		}
-
-		asset := release.Assets[0]
-		if err := dl.downloadArchiveAndUnpack(*asset.BrowserDownloadURL); err != nil {
+		if err := dl.downloadArchiveAndUnpack(dl.release.Archive, dl.release.Checksum); err != nil {
 			return err
 		}
 		if err := dl.updateLocalVersionFile(); err != nil {
@@ -78,8 +92,11 @@ func (dl *SlangComponentLoader) Load() error {
 		}
 	} else {
 		// Just download project as archive from master
-		archiveURL := dl.getLatestArchiveURL()
-		if err := dl.downloadArchiveAndUnpack(archiveURL); err != nil {
+		gs, ok := dl.source.(*GithubSource)
+		if !ok {
+			return fmt.Errorf("loading the master of %s needs GitHub", dl.repo)
+		}
+		if err := dl.downloadArchiveAndUnpack(gs.masterArchiveURL(dl.repo), ""); err != nil {
 			return err
 		}
 	}
@@ -87,13 +104,8 @@ func (dl *SlangComponentLoader) Load() error {
 }
 
 func (dl *SlangComponentLoader) fetchLatestRelease() error {
-	release, _, err := dl.github.Repositories.GetLatestRelease(context.Background(), dl.owner, dl.repo)
-	dl.latestRelease = release
-	return err
-}
-
-func (dl *SlangComponentLoader) getLatestArchiveURL() string {
-	return fmt.Sprintf("https://api.github.com/repos/%v/%v/zipball/master", dl.owner, dl.repo)
+	dl.release, dl.releaseErr = dl.source.Latest(dl.repo)
+	return dl.releaseErr
 }
 
 func (dl *SlangComponentLoader) updateLocalVersionFile() error {
@@ -102,21 +114,32 @@ func (dl *SlangComponentLoader) updateLocalVersionFile() error {
 	return err
 }
 
-func (dl *SlangComponentLoader) downloadArchiveAndUnpack(archiveURL string) error {
+func (dl *SlangComponentLoader) downloadArchiveAndUnpack(archiveURL string, checksum string) error {
 	archiveFilePath, err := dl.download(archiveURL)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(archiveFilePath)
+
+	if checksum != "" {
+		if err := verifyChecksum(archiveFilePath, checksum); err != nil {
+			return fmt.Errorf("%s: %s", archiveURL, err)
+		}
+	} else if dl.requireChecksum {
+		return fmt.Errorf("%s: no checksum to verify the archive", archiveURL)
+	} else {
+		log.Printf("No checksum for %s, the archive is not verified.", archiveURL)
+	}
+
 	// Unpack archive into directory
 	tmpDstDir, err := ioutil.TempDir("", dl.repo)
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmpDstDir)
 	if _, err := unzip(archiveFilePath, tmpDstDir); err != nil {
 		return err
 	}
-	defer os.Remove(archiveFilePath)
-	defer os.RemoveAll(tmpDstDir)
 
 	if err = dl.replaceDirContentBy(tmpDstDir); err != nil {
 		return err
@@ -133,11 +156,36 @@ func (dl *SlangComponentLoader) download(url string) (string, error) {
 	defer tmpDstFile.Close()
 
 	if err := download(url, tmpDstFile); err != nil {
+		os.Remove(tmpDstFile.Name())
 		return "", err
 	}
 	return tmpDstFile.Name(), nil
 }
 
+func verifyChecksum(file string, checksum string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(checksum) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, sum)
+	}
+	return nil
+}
+
+// previousPath is where the replaced version is kept, see Rollback
+func (dl *SlangComponentLoader) previousPath() string {
+	return strings.TrimRight(dl.path, string(filepath.Separator)) + ".previous"
+}
+
+// replaceDirContentBy replaces the component by the unpacked archive. The current version is kept
+// and restored if copying fails.
 func (dl *SlangComponentLoader) replaceDirContentBy(newDirPath string) error {
 	if _, err := os.Stat(newDirPath); err != nil {
 		return err
@@ -148,22 +196,44 @@ func (dl *SlangComponentLoader) replaceDirContentBy(newDirPath string) error {
 		return err
 	}
 
-	if os.IsExist(err) {
-		os.RemoveAll(dl.path)
+	hasPrevious := err == nil
+	if hasPrevious {
+		if err := os.RemoveAll(dl.previousPath()); err != nil {
+			return err
+		}
+		if err := os.Rename(dl.path, dl.previousPath()); err != nil {
+			return err
+		}
 	}
 
 	if err = copyAll(newDirPath, dl.path, true); err != nil {
+		if hasPrevious {
+			if rbErr := dl.Rollback(); rbErr != nil {
+				return fmt.Errorf("%v, restoring previous version failed: %v", err, rbErr)
+			}
+		}
 		return err
 	}
 
-	return err
+	return nil
+}
+
+// Rollback restores the version which has been replaced by the last load
+func (dl *SlangComponentLoader) Rollback() error {
+	if _, err := os.Stat(dl.previousPath()); err != nil {
+		return fmt.Errorf("no previous version of %s: %v", dl.repo, err)
+	}
+	if err := os.RemoveAll(dl.path); err != nil {
+		return err
+	}
+	return os.Rename(dl.previousPath(), dl.path)
 }
 
 func (dl *SlangComponentLoader) GetLatestReleaseVersion() *version.Version {
-	if dl.latestRelease == nil {
+	if dl.release == nil {
 		return nil
 	}
-	return toVersion(*dl.latestRelease.TagName)
+	return dl.release.Version
 }
 
 func (dl *SlangComponentLoader) GetLocalReleaseVersion() *version.Version {
@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Bitspark/go-github/github"
+	"github.com/Bitspark/go-version"
+)
+
+// ComponentRelease is a version of a component such as slang-lib or slang-ui and where its archive is found
+type ComponentRelease struct {
+	Version *version.Version
+	// http(s):// or file:// URL of the zip archive
+	Archive string
+	// Hex encoded SHA-256 checksum of the archive, empty if the source does not provide one
+	Checksum string
+}
+
+// ComponentSource provides the releases of the components
+type ComponentSource interface {
+	Latest(component string) (*ComponentRelease, error)
+}
+
+// componentIndex is the file COMPONENT.json of mirrors and directories describing the latest release.
+// The archive may be given relative to the index.
+type componentIndex struct {
+	Version string `json:"version"`
+	Archive string `json:"archive"`
+	Sha256  string `json:"sha256"`
+}
+
+var archiveVersionPattern = regexp.MustCompile(`^(.+)-v?([0-9]+(\.[0-9]+)*[^/]*)\.zip$`)
+
+// ParseComponentSource parses where components are loaded from:
+//
+//	""                          latest GitHub release
+//	https://mirror/path         mirror serving COMPONENT.json and the archives
+//	file:///dir or /dir         directory with COMPONENT.json or archives COMPONENT-VERSION.zip
+//	file:///a/slang-lib-1.0.zip a single archive
+func ParseComponentSource(s string) (ComponentSource, error) {
+	if s == "" || s == "github" {
+		return NewGithubSource("Bitspark"), nil
+	}
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return &MirrorSource{strings.TrimSuffix(s, "/")}, nil
+	}
+	if strings.Contains(s, "://") && !strings.HasPrefix(s, "file://") {
+		return nil, fmt.Errorf("unsupported component source: %s", s)
+	}
+	path := strings.TrimPrefix(s, "file://")
+	if strings.HasSuffix(path, ".zip") {
+		return &ArchiveSource{path}, nil
+	}
+	return &DirectorySource{path}, nil
+}
+
+// GithubSource loads the latest releases of the repositories of the owner on GitHub.
+// A release asset named like the archive with suffix .sha256 provides the checksum.
+type GithubSource struct {
+	github *github.Client
+	owner  string
+}
+
+func NewGithubSource(owner string) *GithubSource {
+	return &GithubSource{github.NewClient(nil), owner}
+}
+
+func (gs *GithubSource) Latest(component string) (*ComponentRelease, error) {
+	release, _, err := gs.github.Repositories.GetLatestRelease(context.Background(), gs.owner, component)
+	if err != nil {
+		return nil, err
+	}
+	if len(release.Assets) == 0 || release.TagName == nil {
+		return nil, fmt.Errorf("latest release of %s needs at least 1 asset which can be downloaded", component)
+	}
+
+	asset := release.Assets[0]
+	cr := &ComponentRelease{Version: toVersion(*release.TagName), Archive: *asset.BrowserDownloadURL}
+	for _, a := range release.Assets {
+		if *a.Name == *asset.Name+".sha256" {
+			if cr.Checksum, err = fetchChecksum(*a.BrowserDownloadURL); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cr, nil
+}
+
+func (gs *GithubSource) masterArchiveURL(component string) string {
+	return fmt.Sprintf("https://api.github.com/repos/%v/%v/zipball/master", gs.owner, component)
+}
+
+// MirrorSource loads components from an HTTP server serving COMPONENT.json next to the archives
+type MirrorSource struct {
+	url string
+}
+
+func (ms *MirrorSource) Latest(component string) (*ComponentRelease, error) {
+	indexURL := ms.url + "/" + component + ".json"
+	b, err := fetch(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseComponentIndex(b, indexURL)
+}
+
+// DirectorySource loads components from a local directory, e.g. a mounted drive for machines without
+// network. It uses COMPONENT.json if it exists, otherwise the archive COMPONENT-VERSION.zip with the
+// highest version. A file ARCHIVE.sha256 next to an archive provides its checksum.
+type DirectorySource struct {
+	dir string
+}
+
+func (ds *DirectorySource) Latest(component string) (*ComponentRelease, error) {
+	indexFile := filepath.Join(ds.dir, component+".json")
+	if b, err := ioutil.ReadFile(indexFile); err == nil {
+		return parseComponentIndex(b, fileURL(indexFile))
+	}
+
+	infos, err := ioutil.ReadDir(ds.dir)
+	if err != nil {
+		return nil, err
+	}
+	var latest *ComponentRelease
+	for _, info := range infos {
+		m := archiveVersionPattern.FindStringSubmatch(info.Name())
+		if m == nil || m[1] != component {
+			continue
+		}
+		v, err := version.NewVersion(m[2])
+		if err != nil {
+			continue
+		}
+		if latest == nil || latest.Version.LessThan(v) {
+			latest = &ComponentRelease{Version: v, Archive: fileURL(filepath.Join(ds.dir, info.Name()))}
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no archive of %s found in %s", component, ds.dir)
+	}
+	latest.Checksum = readChecksumFile(strings.TrimPrefix(latest.Archive, "file://") + ".sha256")
+	return latest, nil
+}
+
+// ArchiveSource is a single archive named COMPONENT-VERSION.zip
+type ArchiveSource struct {
+	file string
+}
+
+func (as *ArchiveSource) Latest(component string) (*ComponentRelease, error) {
+	m := archiveVersionPattern.FindStringSubmatch(filepath.Base(as.file))
+	if m == nil || m[1] != component {
+		return nil, fmt.Errorf("%s is no archive of %s, expecting %s-VERSION.zip", as.file, component, component)
+	}
+	v, err := version.NewVersion(m[2])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(as.file); err != nil {
+		return nil, err
+	}
+	return &ComponentRelease{v, fileURL(as.file), readChecksumFile(as.file + ".sha256")}, nil
+}
+
+func parseComponentIndex(b []byte, indexURL string) (*ComponentRelease, error) {
+	var idx componentIndex
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return nil, fmt.Errorf("%s: %s", indexURL, err)
+	}
+	v, err := version.NewVersion(idx.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid version %s", indexURL, idx.Version)
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := base.Parse(idx.Archive)
+	if err != nil {
+		return nil, err
+	}
+	return &ComponentRelease{v, archive.String(), strings.ToLower(idx.Sha256)}, nil
+}
+
+func fileURL(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return "file://" + filepath.ToSlash(path)
+}
+
+// fetchChecksum loads a checksum file as written by sha256sum
+func fetchChecksum(url string) (string, error) {
+	b, err := fetch(url)
+	if err != nil {
+		return "", err
+	}
+	return parseChecksum(string(b)), nil
+}
+
+func readChecksumFile(file string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return parseChecksum(string(b))
+}
+
+func parseChecksum(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+func fetch(url string) ([]byte, error) {
+	response, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return ioutil.ReadAll(response.Body)
+}
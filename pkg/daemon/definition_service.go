@@ -2,24 +2,247 @@ package daemon
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 
+	"github.com/Bitspark/slang/pkg/api"
 	"github.com/Bitspark/slang/pkg/core"
 	"github.com/Bitspark/slang/pkg/elem"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
+const uuidPattern = "{id:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}}"
+
+type blueprintJSON struct {
+	Def  core.Blueprint `json:"def"`
+	Type string         `json:"type"`
+}
+
+type blueprintRefJSON struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Type string    `json:"type"`
+}
+
+type validationJSON struct {
+	Valid       bool             `json:"valid"`
+	Diagnostics []api.Diagnostic `json:"diagnostics"`
+}
+
+func blueprintType(st storage.Storage, id uuid.UUID) string {
+	if elem.IsRegistered(id) {
+		return "elementary"
+	}
+	if st.IsSavedInWritableBackend(id) {
+		return "local"
+	}
+	return "library"
+}
+
+// parseBlueprintFilter reads the filter from the query parameters q, name, shortDescription, description,
+// icon, docUrl and tag, which may be given several times
+func parseBlueprintFilter(query url.Values) api.BlueprintFilter {
+	return api.BlueprintFilter{
+		Text:             query.Get("q"),
+		Name:             query.Get("name"),
+		ShortDescription: query.Get("shortDescription"),
+		Description:      query.Get("description"),
+		Icon:             query.Get("icon"),
+		DocURL:           query.Get("docUrl"),
+		Tags:             query["tag"],
+	}
+}
+
+// parsePage reads offset and limit from the query parameters, a limit of zero means no limit
+func parsePage(query url.Values) (int, int, error) {
+	offset, limit := 0, 0
+	var err error
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", s)
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", s)
+		}
+	}
+	return offset, limit, nil
+}
+
+func diagnose(bp core.Blueprint, st storage.Storage) validationJSON {
+	diagnostics := api.Diagnose(bp, &st)
+	valid := true
+	for _, d := range diagnostics {
+		if d.Severity == api.SeverityError {
+			valid = false
+		}
+	}
+	return validationJSON{valid, diagnostics}
+}
+
+// saveBlueprint saves the blueprint unless only a validation is requested with ?validate=true
+func saveBlueprint(w http.ResponseWriter, r *http.Request, def core.Blueprint) {
+	st := GetStorage(r)
+
+	if r.URL.Query().Get("validate") == "true" {
+		sendSuccess(w, &responseOK{Data: diagnose(def, st)})
+		return
+	}
+
+	user := GetUser(r)
+	owners := getOwners(r)
+	if !owners.mayChange(user, def.Id, &st) {
+		sendForbidden(w, fmt.Sprintf("not allowed to change %s", def.Id))
+		return
+	}
+
+	if _, err := st.Save(def); err != nil {
+		sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+		return
+	}
+
+	if err := owners.claim(user, def.Id); err != nil {
+		log.Printf("[ERROR] could not persist owner of %s: %v", def.Id, err)
+	}
+
+	getInstances(r).BlueprintSaved(getWorkspace(r), def.Id, GetHub(r))
+
+	sendStatusSuccess(w)
+}
+
+// blueprintDeleted notifies clients that the blueprint has been deleted from the writable backend of the
+// workspace of the request and lets instances with hot reload using it find out. If a library still provides
+// the blueprint, it has changed instead of being removed.
+func blueprintDeleted(r *http.Request, st *storage.Storage, id uuid.UUID) {
+	kind := storage.BlueprintRemoved
+	if _, err := st.Load(id); err == nil {
+		kind = storage.BlueprintChanged
+	}
+	hub := GetHub(r)
+	if hub != nil {
+		notifyBlueprintEvent(hub, getOwners(r), &blueprintEvent{kind, id, getWorkspace(r)})
+	}
+	getInstances(r).BlueprintSaved(getWorkspace(r), id, hub)
+}
+
+// blueprintRefs resolves the ids for clients, blueprints which cannot be loaded are left out
+func blueprintRefs(st storage.Storage, ids []uuid.UUID) []blueprintRefJSON {
+	refs := make([]blueprintRefJSON, 0, len(ids))
+	for _, id := range ids {
+		bp, err := st.Load(id)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, blueprintRefJSON{id, bp.Meta.Name, blueprintType(st, id)})
+	}
+	return refs
+}
+
+// loadBlueprint loads the blueprint given by the route and responds with 404 if it does not exist
+func loadBlueprint(w http.ResponseWriter, r *http.Request) (*core.Blueprint, bool) {
+	id := uuid.MustParse(mux.Vars(r)["id"])
+	st := GetStorage(r)
+	bp, err := st.Load(id)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, &Error{Msg: err.Error(), Code: "E000X"})
+		return nil, false
+	}
+	return bp, true
+}
+
+// sendStorageFailure responds with 409 if the blueprint is used by others or uses blueprints missing in the target,
+// so clients can ask whether to force the operation
+func sendStorageFailure(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *storage.InUseError, *storage.MissingDependenciesError:
+		w.WriteHeader(http.StatusConflict)
+		writeJSON(w, &Error{Msg: err.Error(), Code: "E000X"})
+	default:
+		sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+	}
+}
+
+// transferBlueprint copies or moves the blueprint to the workspace given in the body
+func transferBlueprint(w http.ResponseWriter, r *http.Request, move bool) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := loadBlueprint(w, r); !ok {
+		return
+	}
+
+	var in struct {
+		Workspace string `json:"workspace"`
+		Force     bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+		return
+	}
+	if in.Workspace == "" {
+		in.Workspace = DefaultWorkspace
+	}
+	if in.Workspace == getWorkspace(r) {
+		sendFailure(w, &responseBad{&Error{Msg: "operator is in workspace " + in.Workspace + " already", Code: "E000X"}})
+		return
+	}
+	to, err := getWorkspaces(r).Get(in.Workspace)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, &Error{Msg: fmt.Sprintf("%s: %s", err, in.Workspace), Code: "E000X"})
+		return
+	}
+	to = authored(r, to)
+
+	st := GetStorage(r)
+	id := uuid.MustParse(mux.Vars(r)["id"])
+	user := GetUser(r)
+	owners := getOwners(r)
+	if (move && !owners.mayChange(user, id, &st)) ||
+		!owners.mayChange(user, id, to) {
+		sendForbidden(w, fmt.Sprintf("not allowed to change %s", id))
+		return
+	}
+
+	var bp *core.Blueprint
+	if move {
+		bp, err = st.Move(id, to, in.Force)
+	} else {
+		bp, err = st.Copy(id, to, in.Force)
+	}
+	if err != nil {
+		sendStorageFailure(w, err)
+		return
+	}
+
+	if err := owners.claim(user, id); err != nil {
+		log.Printf("[ERROR] could not persist owner of %s: %v", id, err)
+	}
+	getInstances(r).BlueprintSaved(in.Workspace, id, GetHub(r))
+	if move && !st.IsSavedInWritableBackend(id) {
+		blueprintDeleted(r, &st, id)
+	}
+
+	sendSuccess(w, &responseOK{Data: blueprintJSON{*bp, blueprintType(*to, id)}})
+}
+
 var DefinitionService = &Service{map[string]*Endpoint{
 	"/": {func(w http.ResponseWriter, r *http.Request) {
 		st := GetStorage(r)
-		type blueprintJSON struct {
-			Def  core.Blueprint `json:"def"`
-			Type string         `json:"type"`
-		}
 
 		type outJSON struct {
 			Objects []blueprintJSON `json:"objects"`
+			Total   int             `json:"total"`
 			Status  string          `json:"status"`
 			Error   *Error          `json:"error,omitempty"`
 		}
@@ -28,10 +251,31 @@ var DefinitionService = &Service{map[string]*Endpoint{
 		var err error
 		blueprints := make([]blueprintJSON, 0)
 
-		opIds, err := st.List()
+		query := r.URL.Query()
+		filter := parseBlueprintFilter(query)
+		opType := query.Get("type")
+		offset, limit, err := parsePage(query)
+
+		matches := func(bp *core.Blueprint, t string) bool {
+			return (opType == "" || opType == t) && filter.Matches(bp)
+		}
+
+		// Only the blueprints which may match are loaded, their names, tags and dependencies are indexed
+		lookup := storage.Lookup{Name: filter.Name, Tags: filter.Tags}
+		if s := query.Get("uses"); s != "" && err == nil {
+			lookup.Uses, err = uuid.Parse(s)
+		}
+		var opIds []uuid.UUID
+		if err == nil {
+			opIds, err = st.Find(lookup)
+		}
 
 		if err == nil {
+			// Sorted to keep pages stable
 			builtinOpIds := elem.GetBuiltinIds()
+			sort.Slice(builtinOpIds, func(i, j int) bool {
+				return builtinOpIds[i].String() < builtinOpIds[j].String()
+			})
 
 			// Gather builtin/elementary blueprints
 			for _, opId := range builtinOpIds {
@@ -41,10 +285,13 @@ var DefinitionService = &Service{map[string]*Endpoint{
 					break
 				}
 
-				blueprints = append(blueprints, blueprintJSON{
-					Type: "elementary",
-					Def:  *blueprint,
-				})
+				// Elementary blueprints use no other blueprints
+				if lookup.Uses == uuid.Nil && matches(blueprint, "elementary") {
+					blueprints = append(blueprints, blueprintJSON{
+						Type: "elementary",
+						Def:  *blueprint,
+					})
+				}
 			}
 
 			if err == nil {
@@ -55,21 +302,27 @@ var DefinitionService = &Service{map[string]*Endpoint{
 						continue
 					}
 
-					opType := "library"
-					if st.IsSavedInWritableBackend(opId) {
-						opType = "local"
+					t := blueprintType(st, opId)
+					if matches(blueprint, t) {
+						blueprints = append(blueprints, blueprintJSON{
+							Type: t,
+							Def:  *blueprint,
+						})
 					}
-
-					blueprints = append(blueprints, blueprintJSON{
-						Type: opType,
-						Def:  *blueprint,
-					})
 				}
 			}
 		}
 
 		if err == nil {
-			dataOut = outJSON{Status: "success", Objects: blueprints}
+			total := len(blueprints)
+			if offset > total {
+				offset = total
+			}
+			blueprints = blueprints[offset:]
+			if limit > 0 && limit < len(blueprints) {
+				blueprints = blueprints[:limit]
+			}
+			dataOut = outJSON{Status: "success", Objects: blueprints, Total: total}
 		} else {
 			dataOut = outJSON{Status: "error", Error: &Error{Msg: err.Error(), Code: "E000X"}}
 		}
@@ -81,7 +334,6 @@ var DefinitionService = &Service{map[string]*Endpoint{
 		}
 	}},
 	"/def/": {func(w http.ResponseWriter, r *http.Request) {
-		st := GetStorage(r)
 		fail := func(err *Error) {
 			sendFailure(w, &responseBad{err})
 		}
@@ -100,14 +352,163 @@ var DefinitionService = &Service{map[string]*Endpoint{
 				return
 			}
 
-			_, err = st.Save(def)
+			saveBlueprint(w, r, def)
+		}
+	}},
+	"/" + uuidPattern + "/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		id := uuid.MustParse(mux.Vars(r)["id"])
+		fail := func(err *Error) {
+			sendFailure(w, &responseBad{err})
+		}
 
-			if err != nil {
+		switch r.Method {
+		case "GET":
+			bp, ok := loadBlueprint(w, r)
+			if !ok {
+				return
+			}
+			sendSuccess(w, &responseOK{Data: blueprintJSON{*bp, blueprintType(st, id)}})
+		case "PUT":
+			var def core.Blueprint
+			if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
 				fail(&Error{Msg: err.Error(), Code: "E000X"})
 				return
 			}
+			if def.Id == uuid.Nil {
+				def.Id = id
+			} else if def.Id != id {
+				fail(&Error{Msg: fmt.Sprintf("id %s does not match %s", def.Id, id), Code: "E000X"})
+				return
+			}
+			saveBlueprint(w, r, def)
+		case "DELETE":
+			if _, ok := loadBlueprint(w, r); !ok {
+				return
+			}
+			if !getOwners(r).mayChange(GetUser(r), id, &st) {
+				sendForbidden(w, fmt.Sprintf("not allowed to delete %s", id))
+				return
+			}
+			if err := st.Delete(id, r.URL.Query().Get("force") == "true"); err != nil {
+				sendStorageFailure(w, err)
+				return
+			}
+			blueprintDeleted(r, &st, id)
+			sendStatusSuccess(w)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}},
+	"/conflicts/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		sendSuccess(w, &responseOK{Data: st.Conflicts()})
+	}},
+	"/" + uuidPattern + "/copy": {func(w http.ResponseWriter, r *http.Request) {
+		transferBlueprint(w, r, false)
+	}},
+	"/" + uuidPattern + "/move": {func(w http.ResponseWriter, r *http.Request) {
+		transferBlueprint(w, r, true)
+	}},
+	"/" + uuidPattern + "/duplicate": {func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := loadBlueprint(w, r); !ok {
+			return
+		}
+
+		var in struct {
+			Name string `json:"name"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+		}
+
+		st := GetStorage(r)
+		bp, err := st.Duplicate(uuid.MustParse(mux.Vars(r)["id"]), in.Name)
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		if err := getOwners(r).claim(GetUser(r), bp.Id); err != nil {
+			log.Printf("[ERROR] could not persist owner of %s: %v", bp.Id, err)
+		}
+		sendSuccess(w, &responseOK{Data: blueprintJSON{*bp, blueprintType(st, bp.Id)}})
+	}},
+	"/" + uuidPattern + "/history/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		revisions, err := st.History(uuid.MustParse(mux.Vars(r)["id"]))
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		sendSuccess(w, &responseOK{Data: revisions})
+	}},
+	"/" + uuidPattern + "/history/{revision:\\w+}/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		id := uuid.MustParse(mux.Vars(r)["id"])
+		bp, err := st.LoadRevision(id, mux.Vars(r)["revision"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, &Error{Msg: err.Error(), Code: "E000X"})
+			return
+		}
+		sendSuccess(w, &responseOK{Data: blueprintJSON{*bp, blueprintType(st, id)}})
+	}},
+	"/" + uuidPattern + "/history/{revision:\\w+}/revert": {func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		st := GetStorage(r)
+		id := uuid.MustParse(mux.Vars(r)["id"])
+		user := GetUser(r)
+		owners := getOwners(r)
+		if !owners.mayChange(user, id, &st) {
+			sendForbidden(w, fmt.Sprintf("not allowed to change %s", id))
+			return
+		}
 
-			sendSuccess(w, nil)
+		bp, err := st.Revert(id, mux.Vars(r)["revision"])
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		if err := owners.claim(user, id); err != nil {
+			log.Printf("[ERROR] could not persist owner of %s: %v", id, err)
+		}
+		getInstances(r).BlueprintSaved(getWorkspace(r), id, GetHub(r))
+		sendSuccess(w, &responseOK{Data: blueprintJSON{*bp, blueprintType(st, id)}})
+	}},
+	"/" + uuidPattern + "/dependencies/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		bp, ok := loadBlueprint(w, r)
+		if !ok {
+			return
+		}
+		ids, err := api.Dependencies(bp, &st, r.URL.Query().Get("transitive") == "true")
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		sendSuccess(w, &responseOK{Data: blueprintRefs(st, ids)})
+	}},
+	"/" + uuidPattern + "/dependents/": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
+		bp, ok := loadBlueprint(w, r)
+		if !ok {
+			return
+		}
+		ids, err := api.Dependents(bp.Id, &st, r.URL.Query().Get("transitive") == "true")
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
 		}
+		sendSuccess(w, &responseOK{Data: blueprintRefs(st, ids)})
 	}},
 }}
@@ -0,0 +1,753 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+)
+
+type InstanceState string
+
+const (
+	InstanceStarting InstanceState = "starting"
+	InstanceRunning  InstanceState = "running"
+	InstanceFailed   InstanceState = "failed"
+	InstanceStopped  InstanceState = "stopped"
+)
+
+// Lifecycle of an instance, every other transition is invalid
+var instanceTransitions = map[InstanceState][]InstanceState{
+	InstanceStarting: {InstanceRunning, InstanceFailed, InstanceStopped},
+	InstanceRunning:  {InstanceStopped, InstanceFailed},
+	InstanceFailed:   {InstanceStarting, InstanceStopped},
+	InstanceStopped:  {InstanceStarting},
+}
+
+// instanceRecord is what is persisted of an instance, enough to start it again after a restart of the daemon
+type instanceRecord struct {
+	Handle         string          `json:"handle"`
+	Owner          string          `json:"owner,omitempty"`
+	Workspace      string          `json:"workspace,omitempty"`
+	Operator       uuid.UUID       `json:"operator"`
+	Generics       core.Generics   `json:"gens,omitempty"`
+	Properties     core.Properties `json:"props,omitempty"`
+	MaxConcurrency int             `json:"maxConcurrency,omitempty"`
+	QueueSize      int             `json:"queueSize,omitempty"`
+	HotReload      bool            `json:"hotReload,omitempty"`
+	Schedule       string          `json:"schedule,omitempty"`
+	DesiredState   InstanceState   `json:"desiredState"`
+	Created        time.Time       `json:"created"`
+}
+
+// instanceInfo is a snapshot of an instance as it is sent to clients
+type instanceInfo struct {
+	Operator  uuid.UUID       `json:"operator"`
+	Handle    string          `json:"handle"`
+	Owner     string          `json:"owner"`
+	Workspace string          `json:"workspace"`
+	URL       string          `json:"url"`
+	State     InstanceState   `json:"state"`
+	Error     string          `json:"error,omitempty"`
+	Gens      core.Generics   `json:"gens,omitempty"`
+	Props     core.Properties `json:"props,omitempty"`
+	Schedule  string          `json:"schedule,omitempty"`
+	Created   time.Time       `json:"created"`
+
+	HotReload   bool       `json:"hotReload"`
+	Reloaded    *time.Time `json:"reloaded,omitempty"`
+	ReloadError string     `json:"reloadError,omitempty"`
+}
+
+type runningOperator struct {
+	mutex        *sync.Mutex
+	info         instanceInfo
+	desiredState InstanceState
+
+	maxConcurrency int
+	queueSize      int
+
+	// Only set while the instance is running
+	op         *core.Operator
+	correlator *api.Correlator
+	outgoing   chan portOutput
+	ctx        context.Context
+	cancel     context.CancelFunc
+	// Items being pushed into op, an operator replaced by a reload is stopped once they are done
+	pushes *sync.WaitGroup
+
+	runs    *runStore
+	current *runLog
+}
+
+// ReloadDrainTimeout is how long an operator replaced by a reload may take to answer the items pushed into it
+var ReloadDrainTimeout = 30 * time.Second
+
+type portOutput struct {
+	// JSON
+	Handle string      `json:"handle"`
+	Port   string      `json:"port"`
+	Data   interface{} `json:"data"`
+	IsEOS  bool        `json:"isEOS"`
+	IsBOS  bool        `json:"isBOS"`
+
+	port *core.Port
+}
+
+func (pm *portOutput) String() string {
+	j, _ := json.Marshal(pm)
+	return string(j)
+}
+
+func newHandle() string {
+	return strings.Replace(uuid.New().String(), "-", "", -1)
+}
+
+func newRunningOperator(rec instanceRecord, runs *runStore) *runningOperator {
+	// Instances persisted before there were users belong to root
+	if rec.Owner == "" {
+		rec.Owner = Root.Name
+	}
+	if rec.Workspace == "" {
+		rec.Workspace = DefaultWorkspace
+	}
+	return &runningOperator{
+		mutex: &sync.Mutex{},
+		info: instanceInfo{
+			Operator:  rec.Operator,
+			Handle:    rec.Handle,
+			Owner:     rec.Owner,
+			Workspace: rec.Workspace,
+			URL:       "/instance/" + rec.Handle + "/",
+			State:     InstanceStopped,
+			Gens:      rec.Generics,
+			Props:     rec.Properties,
+			Schedule:  rec.Schedule,
+			Created:   rec.Created,
+			HotReload: rec.HotReload,
+		},
+		desiredState:   rec.DesiredState,
+		maxConcurrency: rec.MaxConcurrency,
+		queueSize:      rec.QueueSize,
+		runs:           runs,
+	}
+}
+
+// transition changes the state, the mutex has to be held
+func (ro *runningOperator) transition(to InstanceState) error {
+	for _, allowed := range instanceTransitions[ro.info.State] {
+		if allowed == to {
+			ro.info.State = to
+			return nil
+		}
+	}
+	return fmt.Errorf("instance is %s and cannot become %s", ro.info.State, to)
+}
+
+func (ro *runningOperator) snapshot() instanceInfo {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+	return ro.info
+}
+
+func (ro *runningOperator) record() instanceRecord {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+	return instanceRecord{
+		Handle:         ro.info.Handle,
+		Owner:          ro.info.Owner,
+		Workspace:      ro.info.Workspace,
+		Operator:       ro.info.Operator,
+		Generics:       ro.info.Gens,
+		Properties:     ro.info.Props,
+		MaxConcurrency: ro.maxConcurrency,
+		QueueSize:      ro.queueSize,
+		HotReload:      ro.info.HotReload,
+		Schedule:       ro.info.Schedule,
+		DesiredState:   ro.desiredState,
+		Created:        ro.info.Created,
+	}
+}
+
+// start builds the operator and runs it, outputs are relayed through the hub.
+// If the instance is stopped while it is being built it does not run.
+func (ro *runningOperator) start(st storage.Storage, hub *Hub) error {
+	ro.mutex.Lock()
+	if err := ro.transition(InstanceStarting); err != nil {
+		ro.mutex.Unlock()
+		return err
+	}
+	ro.desiredState = InstanceRunning
+	ro.info.Error = ""
+	ro.mutex.Unlock()
+
+	op, buildErr := api.BuildAndCompile(ro.info.Operator, ro.info.Gens, ro.info.Props, st)
+
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	if buildErr != nil {
+		ro.info.Error = buildErr.Error()
+		ro.transition(InstanceFailed)
+		ro.runs.failed(ro.info, buildErr)
+		return buildErr
+	}
+
+	if ro.desiredState != InstanceRunning {
+		return ro.transition(InstanceStopped)
+	}
+
+	ro.current = ro.runs.begin(ro.info)
+	ro.run(op, hub)
+	ro.info.ReloadError = ""
+	ro.transition(InstanceRunning)
+	log.Printf("operator %s (id: %s) started", op.Name(), ro.info.Handle)
+	return nil
+}
+
+// run starts the compiled operator and makes it the one items are pushed into, the mutex has to be held
+func (ro *runningOperator) run(op *core.Operator, hub *Hub) {
+	ro.op = op
+	ro.correlator = api.NewCorrelator(op.Main(), ro.maxConcurrency, ro.queueSize)
+	ro.outgoing = make(chan portOutput)
+	ro.ctx, ro.cancel = context.WithCancel(context.Background())
+	ro.pushes = &sync.WaitGroup{}
+
+	ro.correlator.Start()
+	op.Start()
+
+	go relay(ro.ctx, ro.outgoing, hub, &UserID{Name: ro.info.Owner}, ro.current)
+	go ro.watch(ro.ctx, ro.correlator)
+}
+
+// reload builds the operator again from the current blueprints and switches over to it, keeping the handle.
+// Items already pushed are still answered by the old operator, which is stopped afterwards. If the operator
+// cannot be built, the old one keeps running and the error is kept in the info.
+func (ro *runningOperator) reload(st storage.Storage, hub *Hub) error {
+	info := ro.snapshot()
+	if info.State != InstanceRunning {
+		return fmt.Errorf("instance is %s", info.State)
+	}
+
+	op, buildErr := api.BuildAndCompile(info.Operator, info.Gens, info.Props, st)
+
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	if buildErr != nil {
+		ro.info.ReloadError = buildErr.Error()
+		return buildErr
+	}
+
+	// Stopped in the meantime
+	if ro.info.State != InstanceRunning || ro.desiredState != InstanceRunning {
+		return fmt.Errorf("instance is %s", ro.info.State)
+	}
+
+	go drain(ro.op, ro.correlator, ro.cancel, ro.pushes)
+	ro.run(op, hub)
+
+	now := time.Now()
+	ro.info.Reloaded = &now
+	ro.info.ReloadError = ""
+	log.Printf("operator %s (id: %s) reloaded", op.Name(), ro.info.Handle)
+	return nil
+}
+
+// drain stops an operator replaced by a reload once the items pushed into it have been answered
+func drain(op *core.Operator, correlator *api.Correlator, cancel context.CancelFunc, pushes *sync.WaitGroup) {
+	done := make(chan bool)
+	go func() {
+		pushes.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(ReloadDrainTimeout):
+	}
+
+	cancel()
+	correlator.Stop()
+	op.Stop()
+}
+
+// watch marks the instance as failed if the operator stops without being asked to, e.g. after a panic
+func (ro *runningOperator) watch(ctx context.Context, correlator *api.Correlator) {
+	select {
+	case <-correlator.Done():
+	case <-ctx.Done():
+		return
+	}
+
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+	// Replaced by a reload
+	if ctx.Err() != nil || ro.correlator != correlator {
+		return
+	}
+	ro.cancel()
+	ro.op = nil
+	ro.correlator = nil
+	ro.info.Error = "operator stopped unexpectedly"
+	ro.transition(InstanceFailed)
+	ro.runs.finish(ro.current, RunFailed, errors.New(ro.info.Error))
+	ro.current = nil
+	log.Printf("instance %s failed: %s", ro.info.Handle, ro.info.Error)
+}
+
+// relay waits on messages from the operator resp. ports, records them and relays them through the hub to the owner
+func relay(ctx context.Context, outgoing chan portOutput, hub *Hub, owner *UserID, run *runLog) {
+	for {
+		select {
+		case po := <-outgoing:
+			run.output(po)
+			if hub != nil {
+				hub.broadCastTo(owner, Port, po)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stop cancels the running operator, an instance being started will not run
+func (ro *runningOperator) stop() error {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+
+	ro.desiredState = InstanceStopped
+
+	switch ro.info.State {
+	case InstanceStarting, InstanceStopped:
+		return nil
+	case InstanceRunning:
+		// Cancel first, so the stopping correlator is not taken for a failure
+		ro.cancel()
+		ro.correlator.Stop()
+		go ro.op.Stop()
+		ro.op = nil
+		ro.correlator = nil
+		ro.runs.finish(ro.current, RunStopped, nil)
+		ro.current = nil
+	}
+	return ro.transition(InstanceStopped)
+}
+
+// conclude finishes the current run with the result of an item pushed into the instance,
+// stopping the instance afterwards does not change the run anymore
+func (ro *runningOperator) conclude(output interface{}, err error) {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+	if ro.current == nil {
+		return
+	}
+	if err != nil {
+		ro.runs.finish(ro.current, RunFailed, err)
+		return
+	}
+	ro.current.result(output)
+	ro.runs.finish(ro.current, RunSuccess, nil)
+}
+
+// inDef returns the type of the items to be pushed, ok is false if the instance is not running
+func (ro *runningOperator) inDef() (core.TypeDef, bool) {
+	ro.mutex.Lock()
+	defer ro.mutex.Unlock()
+	if ro.info.State != InstanceRunning {
+		return core.TypeDef{}, false
+	}
+	return ro.op.Main().In().Define(), true
+}
+
+// Push pushes an item into the operator and returns the output item resulting from it.
+// The output item is also sent port by port to the hub.
+func (ro *runningOperator) Push(ctx context.Context, item interface{}) (interface{}, error) {
+	wait, err := ro.submit(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return wait(ctx)
+}
+
+// Submit pushes an item into the operator once the correlator admits it and returns without waiting for the
+// output item, which is only sent port by port to the hub.
+func (ro *runningOperator) Submit(ctx context.Context, item interface{}) error {
+	wait, err := ro.submit(ctx, item)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if _, err := wait(context.Background()); err != nil {
+			log.Printf("instance %s: %s", ro.info.Handle, err)
+		}
+	}()
+	return nil
+}
+
+// submit pushes the item and returns the function waiting for and emitting its output item
+func (ro *runningOperator) submit(ctx context.Context, item interface{}) (func(context.Context) (interface{}, error), error) {
+	ro.mutex.Lock()
+	if ro.info.State != InstanceRunning {
+		ro.mutex.Unlock()
+		return nil, fmt.Errorf("instance is %s", ro.info.State)
+	}
+	op, correlator, outgoing, insCtx, pushes := ro.op, ro.correlator, ro.outgoing, ro.ctx, ro.pushes
+	pushes.Add(1)
+	ro.current.input(item)
+	ro.mutex.Unlock()
+
+	call, err := correlator.Submit(ctx, item)
+	if err != nil {
+		pushes.Done()
+		return nil, err
+	}
+	return func(ctx context.Context) (interface{}, error) {
+		defer pushes.Done()
+		odat, err := call.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		emit(insCtx, ro.info.Handle, outgoing, op.Main().Out(), odat)
+		return odat, nil
+	}, nil
+}
+
+// emit splits up an item into the items of the primitive ports, the same way they would have been pulled
+func emit(ctx context.Context, handle string, outgoing chan portOutput, p *core.Port, item interface{}) {
+	send := func(po portOutput) {
+		select {
+		case outgoing <- po:
+		case <-ctx.Done():
+		}
+	}
+
+	switch {
+	case p.MapType():
+		m, _ := item.(map[string]interface{})
+		for _, name := range p.MapEntryNames() {
+			emit(ctx, handle, outgoing, p.Map(name), m[name])
+		}
+	case p.Stream() != nil:
+		items, _ := item.([]interface{})
+		p.Stream().WalkPrimitivePorts(func(sub *core.Port) {
+			send(portOutput{handle, sub.String(), core.BOS{}, false, true, sub})
+		})
+		for _, i := range items {
+			emit(ctx, handle, outgoing, p.Stream(), i)
+		}
+		p.Stream().WalkPrimitivePorts(func(sub *core.Port) {
+			send(portOutput{handle, sub.String(), core.EOS{}, true, false, sub})
+		})
+	default:
+		send(portOutput{handle, p.String(), item, core.IsEOS(item), core.IsBOS(item), p})
+	}
+}
+
+// runningOperatorManager keeps track of all instances of a server. If a registry file is set,
+// instances are persisted to it and started again when the registry is loaded.
+// Instances are built from the storage of their workspace, their runs are recorded in the run store.
+type runningOperatorManager struct {
+	mutex        *sync.RWMutex
+	ops          map[string]*runningOperator
+	workspaces   *workspaceManager
+	runs         *runStore
+	registryFile string
+
+	// Serializes writing the registry file
+	persistMutex *sync.Mutex
+}
+
+func newRunningOperatorManager(workspaces *workspaceManager) *runningOperatorManager {
+	return &runningOperatorManager{
+		mutex:        &sync.RWMutex{},
+		ops:          make(map[string]*runningOperator),
+		workspaces:   workspaces,
+		runs:         newRunStore(),
+		persistMutex: &sync.Mutex{},
+	}
+}
+
+// start starts the instance with the storage of its workspace
+func (rom *runningOperatorManager) start(ro *runningOperator, hub *Hub) error {
+	st, err := rom.workspaces.Get(ro.snapshot().Workspace)
+	if err != nil {
+		return err
+	}
+	return ro.start(*st, hub)
+}
+
+// Start builds and runs a new instance owned by the user. Instances which cannot be built are not registered.
+func (rom *runningOperatorManager) Start(ri RunInstruction, owner *UserID, workspace string, hub *Hub) (*runningOperator, error) {
+	return rom.launch(newInstanceRecord(ri, owner, workspace), hub)
+}
+
+func newInstanceRecord(ri RunInstruction, owner *UserID, workspace string) instanceRecord {
+	return instanceRecord{
+		Handle:         newHandle(),
+		Owner:          owner.Name,
+		Workspace:      workspace,
+		Operator:       ri.Id,
+		Generics:       ri.Gens,
+		Properties:     ri.Props,
+		MaxConcurrency: ri.MaxConcurrency,
+		QueueSize:      ri.QueueSize,
+		HotReload:      ri.HotReload,
+		Created:        time.Now(),
+	}
+}
+
+// launch starts a new instance from the record and registers it
+func (rom *runningOperatorManager) launch(rec instanceRecord, hub *Hub) (*runningOperator, error) {
+	ro := newRunningOperator(rec, rom.runs)
+
+	if err := rom.start(ro, hub); err != nil {
+		return nil, err
+	}
+
+	rom.mutex.Lock()
+	rom.ops[ro.info.Handle] = ro
+	rom.mutex.Unlock()
+
+	rom.persist()
+	return ro, nil
+}
+
+// Restart starts a stopped or failed instance again, keeping its handle
+func (rom *runningOperatorManager) Restart(handle string, hub *Hub) error {
+	ro, err := rom.Get(handle)
+	if err != nil {
+		return err
+	}
+
+	err = rom.start(ro, hub)
+	rom.persist()
+	return err
+}
+
+// Reload rebuilds a running instance from the current blueprints of its workspace, keeping its handle.
+// Connected clients of the owner are told about the result through the `Instance` topic.
+func (rom *runningOperatorManager) Reload(handle string, hub *Hub) error {
+	ro, err := rom.Get(handle)
+	if err != nil {
+		return err
+	}
+
+	info := ro.snapshot()
+	st, err := rom.workspaces.Get(info.Workspace)
+	if err != nil {
+		return err
+	}
+
+	err = ro.reload(*st, hub)
+	if err != nil {
+		log.Printf("instance %s could not be reloaded: %s", handle, err)
+	}
+	if hub != nil {
+		hub.broadCastTo(&UserID{Name: info.Owner}, Instance, ro.snapshot())
+	}
+	return err
+}
+
+// BlueprintSaved reloads the running instances with hot reload in the workspace which use the blueprint
+func (rom *runningOperatorManager) BlueprintSaved(workspace string, id uuid.UUID, hub *Hub) {
+	st, err := rom.workspaces.Get(workspace)
+	if err != nil {
+		return
+	}
+
+	for _, ro := range rom.all() {
+		info := ro.snapshot()
+		if !info.HotReload || info.State != InstanceRunning || info.Workspace != workspace {
+			continue
+		}
+		if info.Operator != id {
+			bp, err := st.Load(info.Operator)
+			if err != nil {
+				continue
+			}
+			deps, err := api.Dependencies(bp, st, true)
+			if err != nil || !containsId(deps, id) {
+				continue
+			}
+		}
+		rom.Reload(info.Handle, hub)
+	}
+}
+
+func containsId(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Halt stops the instance, it stays registered with state stopped unless it is removed
+func (rom *runningOperatorManager) Halt(handle string, remove bool) error {
+	ro, err := rom.Get(handle)
+	if err != nil {
+		return err
+	}
+
+	if err := ro.stop(); err != nil {
+		return err
+	}
+	log.Printf("instance %s stopped", handle)
+
+	if remove {
+		rom.mutex.Lock()
+		delete(rom.ops, handle)
+		rom.mutex.Unlock()
+	}
+
+	rom.persist()
+	return nil
+}
+
+func (rom *runningOperatorManager) Get(handle string) (*runningOperator, error) {
+	rom.mutex.RLock()
+	defer rom.mutex.RUnlock()
+
+	if runningOp, ok := rom.ops[handle]; ok {
+		return runningOp, nil
+	}
+	return nil, fmt.Errorf("unknown handle value: %s", handle)
+}
+
+// GetOwned returns the instance only if the user is allowed to access it, other instances are treated as unknown
+func (rom *runningOperatorManager) GetOwned(handle string, user *UserID) (*runningOperator, error) {
+	ro, err := rom.Get(handle)
+	if err != nil {
+		return nil, err
+	}
+	if !user.owns(ro.snapshot().Owner) {
+		return nil, fmt.Errorf("unknown handle value: %s", handle)
+	}
+	return ro, nil
+}
+
+// InWorkspace tells whether there are instances built from the workspace
+func (rom *runningOperatorManager) InWorkspace(workspace string) bool {
+	for _, ro := range rom.all() {
+		if ro.snapshot().Workspace == workspace {
+			return true
+		}
+	}
+	return false
+}
+
+func (rom *runningOperatorManager) all() []*runningOperator {
+	rom.mutex.RLock()
+	defer rom.mutex.RUnlock()
+
+	ros := make([]*runningOperator, 0, len(rom.ops))
+	for _, ro := range rom.ops {
+		ros = append(ros, ro)
+	}
+	return ros
+}
+
+// List returns snapshots of the instances the user is allowed to access ordered by their creation
+func (rom *runningOperatorManager) List(user *UserID) []instanceInfo {
+	infos := make([]instanceInfo, 0)
+	for _, ro := range rom.all() {
+		if info := ro.snapshot(); user.owns(info.Owner) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+// Load reads the instances from the registry file and starts those which have been running.
+// From now on all changes are persisted to this file.
+func (rom *runningOperatorManager) Load(registryFile string, hub *Hub) error {
+	rom.persistMutex.Lock()
+	rom.registryFile = registryFile
+	rom.persistMutex.Unlock()
+
+	b, err := ioutil.ReadFile(registryFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var records []instanceRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return fmt.Errorf("%s: %s", registryFile, err)
+	}
+
+	for _, rec := range records {
+		ro := newRunningOperator(rec, rom.runs)
+
+		rom.mutex.Lock()
+		rom.ops[rec.Handle] = ro
+		rom.mutex.Unlock()
+
+		if rec.DesiredState != InstanceRunning {
+			continue
+		}
+
+		if err := rom.start(ro, hub); err != nil {
+			log.Printf("instance %s could not be restarted: %s", rec.Handle, err)
+		}
+	}
+
+	return nil
+}
+
+// persist writes all instances to the registry file, if there is one
+func (rom *runningOperatorManager) persist() {
+	rom.persistMutex.Lock()
+	defer rom.persistMutex.Unlock()
+
+	if rom.registryFile == "" {
+		return
+	}
+
+	records := make([]instanceRecord, 0)
+	for _, ro := range rom.all() {
+		records = append(records, ro.record())
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+
+	if err := writeFileAtomic(rom.registryFile, records); err != nil {
+		log.Printf("[ERROR] could not persist instances: %v", err)
+	}
+}
+
+func writeFileAtomic(file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := utils.EnsureDirExists(filepath.Dir(file)); err != nil {
+		return err
+	}
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
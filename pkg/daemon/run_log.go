@@ -0,0 +1,430 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type RunStatus string
+
+const (
+	RunRunning RunStatus = "running"
+	RunSuccess RunStatus = "success"
+	RunFailed  RunStatus = "failed"
+	// Final status of a run which has been stopped on request
+	RunStopped RunStatus = "stopped"
+)
+
+// MaxRunLogItems is the number of inputs resp. outputs recorded per run, further items are only counted
+var MaxRunLogItems = 10000
+
+// RunRetention tells how long finished runs are kept, zero values mean no limit
+type RunRetention struct {
+	MaxAge  time.Duration
+	MaxRuns int
+}
+
+var DefaultRunRetention = RunRetention{MaxAge: 7 * 24 * time.Hour, MaxRuns: 1000}
+
+type runInput struct {
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+type runOutput struct {
+	Time time.Time `json:"time"`
+	portOutput
+}
+
+// runSummary describes a run of an instance, from being started until being stopped or failing.
+// Runs of instances started by a schedule carry its id and the output item resulting from the scheduled input.
+type runSummary struct {
+	Id        string          `json:"id"`
+	Handle    string          `json:"handle"`
+	Owner     string          `json:"owner"`
+	Workspace string          `json:"workspace"`
+	Operator  uuid.UUID       `json:"operator"`
+	Gens      core.Generics   `json:"gens,omitempty"`
+	Props     core.Properties `json:"props,omitempty"`
+	Schedule  string          `json:"schedule,omitempty"`
+	Started   time.Time       `json:"started"`
+	Stopped   *time.Time      `json:"stopped,omitempty"`
+	Status    RunStatus       `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Output    interface{}     `json:"output,omitempty"`
+	Inputs    int             `json:"inputCount"`
+	Outputs   int             `json:"outputCount"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// runLog is a run along with the items pushed into it and the items it has sent
+type runLog struct {
+	runSummary
+	InputItems  []runInput  `json:"inputs"`
+	OutputItems []runOutput `json:"outputs"`
+
+	mutex *sync.Mutex
+}
+
+func (rl *runLog) input(item interface{}) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.Inputs++
+	if len(rl.InputItems) >= MaxRunLogItems {
+		rl.Truncated = true
+		return
+	}
+	rl.InputItems = append(rl.InputItems, runInput{time.Now(), item})
+}
+
+func (rl *runLog) output(po portOutput) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.Outputs++
+	if len(rl.OutputItems) >= MaxRunLogItems {
+		rl.Truncated = true
+		return
+	}
+	rl.OutputItems = append(rl.OutputItems, runOutput{time.Now(), po})
+}
+
+func (rl *runLog) result(output interface{}) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.Output = output
+}
+
+func (rl *runLog) summary() runSummary {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return rl.runSummary
+}
+
+// runStore records the runs of all instances of a server. If a directory is set, finished runs are written
+// to it and only their summaries are kept in memory. Finished runs are dropped according to the retention.
+type runStore struct {
+	mutex     *sync.Mutex
+	dir       string
+	retention RunRetention
+	runs      map[string]*runLog
+}
+
+func newRunStore() *runStore {
+	return &runStore{
+		mutex:     &sync.Mutex{},
+		retention: DefaultRunRetention,
+		runs:      make(map[string]*runLog),
+	}
+}
+
+// begin records a new run of the instance
+func (rs *runStore) begin(info instanceInfo) *runLog {
+	rl := &runLog{
+		runSummary: runSummary{
+			Id:        newHandle(),
+			Handle:    info.Handle,
+			Owner:     info.Owner,
+			Workspace: info.Workspace,
+			Operator:  info.Operator,
+			Gens:      info.Gens,
+			Props:     info.Props,
+			Schedule:  info.Schedule,
+			Started:   time.Now(),
+			Status:    RunRunning,
+		},
+		InputItems:  make([]runInput, 0),
+		OutputItems: make([]runOutput, 0),
+		mutex:       &sync.Mutex{},
+	}
+
+	rs.mutex.Lock()
+	rs.runs[rl.Id] = rl
+	rs.mutex.Unlock()
+	return rl
+}
+
+// finish sets the final status of the run, persists it and applies the retention
+func (rs *runStore) finish(rl *runLog, status RunStatus, err error) {
+	rl.mutex.Lock()
+	if rl.Stopped != nil {
+		rl.mutex.Unlock()
+		return
+	}
+	stopped := time.Now()
+	rl.Stopped = &stopped
+	rl.Status = status
+	if err != nil {
+		rl.Error = err.Error()
+	}
+	rl.mutex.Unlock()
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.dir != "" {
+		if err := rs.write(rl); err != nil {
+			log.Printf("[ERROR] could not persist run %s: %v", rl.Id, err)
+		} else {
+			// Only the summary is kept in memory
+			rs.runs[rl.Id] = &runLog{runSummary: rl.summary(), mutex: &sync.Mutex{}}
+		}
+	}
+	rs.applyRetention()
+}
+
+// failed records a run which could not even be started
+func (rs *runStore) failed(info instanceInfo, err error) {
+	rs.finish(rs.begin(info), RunFailed, err)
+}
+
+func (rs *runStore) file(id string) string {
+	return filepath.Join(rs.dir, id+".json")
+}
+
+// write persists the run, the mutex has to be held
+func (rs *runStore) write(rl *runLog) error {
+	rl.mutex.Lock()
+	b, err := json.Marshal(rl)
+	rl.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if _, err := utils.EnsureDirExists(rs.dir); err != nil {
+		return err
+	}
+	tmpFile := rs.file(rl.Id) + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, rs.file(rl.Id))
+}
+
+// applyRetention drops finished runs which are too old or exceed the maximum number, the mutex has to be held
+func (rs *runStore) applyRetention() {
+	finished := make([]runSummary, 0)
+	for _, rl := range rs.runs {
+		if s := rl.summary(); s.Stopped != nil {
+			finished = append(finished, s)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Started.After(finished[j].Started)
+	})
+
+	for i, s := range finished {
+		tooMany := rs.retention.MaxRuns > 0 && i >= rs.retention.MaxRuns
+		tooOld := rs.retention.MaxAge > 0 && time.Since(*s.Stopped) > rs.retention.MaxAge
+		if tooMany || tooOld {
+			rs.remove(s.Id)
+		}
+	}
+}
+
+// remove drops the run, the mutex has to be held
+func (rs *runStore) remove(id string) {
+	delete(rs.runs, id)
+	if rs.dir != "" {
+		if err := os.Remove(rs.file(id)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[ERROR] could not remove run %s: %v", id, err)
+		}
+	}
+}
+
+// Load reads the summaries of the runs persisted in the directory, from now on finished runs are written there
+func (rs *runStore) Load(dir string, retention RunRetention) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rs.dir = dir
+	rs.retention = retention
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		var rl runLog
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err == nil {
+			err = json.Unmarshal(b, &rl)
+		}
+		if err != nil || rl.Stopped == nil {
+			log.Printf("cannot read run %s: %v", f.Name(), err)
+			continue
+		}
+		rs.runs[rl.Id] = &runLog{runSummary: rl.runSummary, mutex: &sync.Mutex{}}
+	}
+
+	rs.applyRetention()
+	return nil
+}
+
+// runFilter restricts runs to the runs of an instance, a blueprint or a schedule, zero values match all runs
+type runFilter struct {
+	Handle   string
+	Operator uuid.UUID
+	Schedule string
+}
+
+func (f runFilter) matches(s runSummary) bool {
+	return (f.Handle == "" || s.Handle == f.Handle) &&
+		(f.Operator == uuid.Nil || s.Operator == f.Operator) &&
+		(f.Schedule == "" || s.Schedule == f.Schedule)
+}
+
+// List returns the summaries of the runs the user is allowed to access matching the filter, the most recent run first
+func (rs *runStore) List(user *UserID, filter runFilter) []runSummary {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	summaries := make([]runSummary, 0)
+	for _, rl := range rs.runs {
+		s := rl.summary()
+		if !user.owns(s.Owner) || !filter.matches(s) {
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Started.After(summaries[j].Started)
+	})
+	return summaries
+}
+
+// GetOwned returns the run including its items if the user is allowed to access it
+func (rs *runStore) GetOwned(id string, user *UserID) (*runLog, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rl, ok := rs.runs[id]
+	if !ok || !user.owns(rl.summary().Owner) {
+		return nil, fmt.Errorf("unknown run: %s", id)
+	}
+	if rl.InputItems != nil {
+		return rl, nil
+	}
+
+	var stored runLog
+	b, err := ioutil.ReadFile(rs.file(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	stored.mutex = &sync.Mutex{}
+	return &stored, nil
+}
+
+// Delete drops a finished run
+func (rs *runStore) Delete(id string) error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rl, ok := rs.runs[id]
+	if !ok {
+		return fmt.Errorf("unknown run: %s", id)
+	}
+	if rl.summary().Stopped == nil {
+		return fmt.Errorf("run %s is still running", id)
+	}
+	rs.remove(id)
+	return nil
+}
+
+// pageRuns returns the runs from the offset on, at most limit runs if limit is positive
+func pageRuns(runs []runSummary, offset int, limit int) []runSummary {
+	if offset > len(runs) {
+		offset = len(runs)
+	}
+	runs = runs[offset:]
+	if limit > 0 && limit < len(runs) {
+		runs = runs[:limit]
+	}
+	return runs
+}
+
+func writeRun(w http.ResponseWriter, rl *runLog) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	writeJSON(w, rl)
+}
+
+var RunLogService = &Service{map[string]*Endpoint{
+	"/": {func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := runFilter{Handle: query.Get("handle"), Schedule: query.Get("schedule")}
+		if s := query.Get("operator"); s != "" {
+			var err error
+			if filter.Operator, err = uuid.Parse(s); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+		}
+		offset, limit, err := parsePage(query)
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+
+		writeJSON(w, pageRuns(getRuns(r).List(GetUser(r), filter), offset, limit))
+	}},
+	"/{id:\\w+}/": {func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		runs := getRuns(r)
+		rl, err := runs.GetOwned(id, GetUser(r))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeRun(w, rl)
+		case "DELETE":
+			if err := runs.Delete(id); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+			sendStatusSuccess(w)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}},
+	"/{id:\\w+}/download": {func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		rl, err := getRuns(r).GetOwned(id, GetUser(r))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="run-%s.json"`, id))
+		writeRun(w, rl)
+	}},
+}}
@@ -4,12 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
 
-	"github.com/Bitspark/go-funk"
 	"github.com/Bitspark/slang/pkg/api"
 	"github.com/Bitspark/slang/pkg/core"
 	"github.com/google/uuid"
@@ -21,6 +17,13 @@ type RunInstruction struct {
 	Props  core.Properties `json:"props"`
 	Gens   core.Generics   `json:"gens"`
 	Stream bool            `json:"stream"`
+
+	// Limits for items pushed into the instance, zero means unlimited
+	MaxConcurrency int `json:"maxConcurrency"`
+	QueueSize      int `json:"queueSize"`
+
+	// Rebuilds the instance whenever a blueprint it uses is saved
+	HotReload bool `json:"hotReload"`
 }
 
 type RunState struct {
@@ -30,118 +33,11 @@ type RunState struct {
 	Error  *Error `json:"error,omitempty"`
 }
 
-type runningOperator struct {
-	// JSON
-	Operator uuid.UUID `json:"operator"`
-	Handle   string    `json:"handle"`
-	URL      string    `json:"url"`
-
-	op       *core.Operator
-	incoming chan interface{}
-	outgoing chan portOutput
-	inStop   chan bool
-	outStop  chan bool
-}
-
-type portOutput struct {
-	// JSON
-	Handle string      `json:"handle"`
-	Port   string      `json:"port"`
-	Data   interface{} `json:"data"`
-	IsEOS  bool        `json:"isEOS"`
-	IsBOS  bool        `json:"isBOS"`
-
-	port *core.Port
-}
-
-func (pm *portOutput) String() string {
-	j, _ := json.Marshal(pm)
-	return string(j)
-}
-
-type runningOperatorManager struct {
-	ops map[string]*runningOperator
-}
-
-var rnd = rand.New(rand.NewSource(99))
-var runningOperators = &runningOperatorManager{make(map[string]*runningOperator)}
-
-func (rom *runningOperatorManager) newRunningOperator(op *core.Operator) *runningOperator {
-	handle := strconv.FormatInt(rnd.Int63(), 16)
-	url := "/instance/" + handle + "/"
-	runningOp := &runningOperator{op.Id(), handle, url, op, make(chan interface{}, 0), make(chan portOutput, 0), make(chan bool, 0), make(chan bool, 0)}
-	rom.ops[handle] = runningOp
-	op.Main().Out().Bufferize()
-	op.Start()
-	log.Printf("operator %s (id: %s) started", op.Name(), handle)
-	return runningOp
-}
-
-func (rom *runningOperatorManager) Run(op *core.Operator) *runningOperator {
-	runningOp := rom.newRunningOperator(op)
-	go func() {
-	loop:
-		for {
-			select {
-			case incoming := <-runningOp.incoming:
-				op.Main().In().Push(incoming)
-			case <-runningOp.inStop:
-				break loop
-			}
-		}
-	}()
-
-	op.Main().Out().WalkPrimitivePorts(func(p *core.Port) {
-		go func() {
-			for {
-				if p.Closed() {
-					break
-				}
-				i := p.Pull()
-
-				po := portOutput{runningOp.Handle, p.String(), i, core.IsEOS(i), core.IsBOS(i), p}
-				runningOp.outgoing <- po
-			}
-		}()
-	})
-	return runningOp
-}
-
-func (rom *runningOperatorManager) Halt(handle string) error {
-	// `Halt` to me suggest that there is a way to resume operations
-	// which is not the case.
-	ro, err := runningOperators.Get(handle)
-
-	if err != nil {
-		return err
-	}
-
-	go ro.op.Stop()
-	ro.inStop <- true
-	ro.outStop <- true
-	delete(rom.ops, handle)
-
-	return nil
-}
-
-func (rom runningOperatorManager) Get(handle string) (*runningOperator, error) {
-	if runningOp, ok := rom.ops[handle]; ok {
-		return runningOp, nil
-	}
-	return nil, fmt.Errorf("unknown handle value: %s", handle)
-}
-
 var InstanceService = &Service{map[string]*Endpoint{
 	"/": {func(w http.ResponseWriter, r *http.Request) {
 
-		type outJSON struct {
-			Objects []runningOperator `json:"objects"`
-			Status  string            `json:"status"`
-			Error   *Error            `json:"error,omitempty"`
-		}
-
 		if r.Method == "GET" {
-			writeJSON(w, funk.Values(runningOperators.ops))
+			writeJSON(w, getInstances(r).List(GetUser(r)))
 		}
 	}},
 }}
@@ -150,14 +46,23 @@ var RunningInstanceService = &Service{map[string]*Endpoint{
 	"/{handle:\\w+}/": {func(w http.ResponseWriter, r *http.Request) {
 		handle := mux.Vars(r)["handle"]
 
-		runningIns, err := runningOperators.Get(handle)
+		runningIns, err := getInstances(r).GetOwned(handle, GetUser(r))
 		if err != nil {
 			w.WriteHeader(404)
 			return
 		}
 
 		var idat interface{}
-		if r.Method == "POST" {
+		if r.Method == "GET" {
+			writeJSON(w, runningIns.snapshot())
+		} else if r.Method == "POST" {
+			inDef, ok := runningIns.inDef()
+			if !ok {
+				w.WriteHeader(http.StatusConflict)
+				writeJSON(w, &Error{Msg: fmt.Sprintf("instance is %s", runningIns.snapshot().State), Code: "E000X"})
+				return
+			}
+
 			r.ParseForm()
 			buf := new(bytes.Buffer)
 			buf.ReadFrom(r.Body)
@@ -170,19 +75,75 @@ var RunningInstanceService = &Service{map[string]*Endpoint{
 					w.WriteHeader(400)
 					return
 				}
+				idat = core.CleanValue(idat)
+				if err := inDef.VerifyData(idat); err != nil {
+					w.WriteHeader(400)
+					writeJSON(w, &Error{Msg: err.Error(), Code: "E000X"})
+					return
+				}
+			}
+
+			// With ?wait=true the response is the output item belonging to the pushed item,
+			// otherwise output items are only sent through the websocket
+			if r.FormValue("wait") != "true" {
+				if err := runningIns.Submit(r.Context(), idat); err != nil {
+					sendPushFailure(w, err)
+					return
+				}
+				writeJSON(w, runningIns.snapshot())
+				return
 			}
-			runningIns.incoming <- idat
 
-			writeJSON(w, &runningIns)
+			odat, err := runningIns.Push(r.Context(), idat)
+			if err != nil {
+				sendPushFailure(w, err)
+				return
+			}
+			writeJSON(w, odat)
 		}
 
 	}},
+	"/{handle:\\w+}/start": {func(w http.ResponseWriter, r *http.Request) {
+		changeInstanceState(w, r, func(instances *runningOperatorManager, handle string) error {
+			return instances.Restart(handle, GetHub(r))
+		})
+	}},
+	"/{handle:\\w+}/stop": {func(w http.ResponseWriter, r *http.Request) {
+		changeInstanceState(w, r, func(instances *runningOperatorManager, handle string) error {
+			return instances.Halt(handle, false)
+		})
+	}},
+	"/{handle:\\w+}/reload": {func(w http.ResponseWriter, r *http.Request) {
+		changeInstanceState(w, r, func(instances *runningOperatorManager, handle string) error {
+			return instances.Reload(handle, GetHub(r))
+		})
+	}},
 }}
 
+func changeInstanceState(w http.ResponseWriter, r *http.Request, change func(instances *runningOperatorManager, handle string) error) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := mux.Vars(r)["handle"]
+	instances := getInstances(r)
+	runningIns, err := instances.GetOwned(handle, GetUser(r))
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+
+	if err := change(instances, handle); err != nil {
+		sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+		return
+	}
+	sendSuccess(w, &responseOK{Data: runningIns.snapshot()})
+}
+
 var RunnerService = &Service{map[string]*Endpoint{
 	"/": {Handle: func(w http.ResponseWriter, r *http.Request) {
 		hub := GetHub(r)
-		st := GetStorage(r)
 		if r.Method == "POST" {
 			var data RunState
 			var ri RunInstruction
@@ -195,42 +156,25 @@ var RunnerService = &Service{map[string]*Endpoint{
 				return
 			}
 
-			opId := ri.Id
-			op, err := api.BuildAndCompile(opId, ri.Gens, ri.Props, st)
+			runOp, err := getInstances(r).Start(ri, GetUser(r), getWorkspace(r), hub)
 			if err != nil {
 				data = RunState{Status: "error", Error: &Error{Msg: err.Error(), Code: "E000X"}}
 				writeJSON(w, &data)
 				return
 			}
 
-			runOp := runningOperators.Run(op)
-
-			// Move into the background and wait on message from the operator resp. ports
-			// and relay them through the `hub`
-			go func() {
-			loop:
-				for {
-					select {
-					case outgoing := <-runOp.outgoing:
-						// I don't know what happens when Root would be a dynamically changing variable.
-						// Is root's value bound to the scope or is the reference bound to the scope.
-						// I would suspect the latter, which means this is could turn into a race condition.
-						hub.broadCastTo(Root, Port, outgoing)
-					case <-runOp.outStop:
-						break loop
-					}
-				}
-			}()
-
 			data.Status = "success"
-			data.Handle = runOp.Handle
-			data.URL = runOp.URL
+			info := runOp.snapshot()
+			data.Handle = info.Handle
+			data.URL = info.URL
 
 			writeJSON(w, &data)
 
 		} else if r.Method == "DELETE" {
 			type stopInstructionJSON struct {
 				Handle string `json:"handle"`
+				// Keeps the instance with state stopped instead of removing it, so it can be started again
+				Keep bool `json:"keep"`
 			}
 
 			type outJSON struct {
@@ -249,7 +193,14 @@ var RunnerService = &Service{map[string]*Endpoint{
 				return
 			}
 
-			if err := runningOperators.Halt(si.Handle); err == nil {
+			instances := getInstances(r)
+			if _, err := instances.GetOwned(si.Handle, GetUser(r)); err != nil {
+				data = outJSON{Status: "error", Error: &Error{Msg: "Unknown handle", Code: "E000X"}}
+				writeJSON(w, &data)
+				return
+			}
+
+			if err := instances.Halt(si.Handle, !si.Keep); err == nil {
 				data.Status = "success"
 			} else {
 				data = outJSON{Status: "error", Error: &Error{Msg: "Unknown handle", Code: "E000X"}}
@@ -259,3 +210,13 @@ var RunnerService = &Service{map[string]*Endpoint{
 		}
 	}},
 }}
+
+// sendPushFailure responds why an item could not be pushed into an instance
+func sendPushFailure(w http.ResponseWriter, err error) {
+	if err == api.ErrQueueFull {
+		w.WriteHeader(http.StatusTooManyRequests)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, &Error{Msg: err.Error(), Code: "E000X"})
+}
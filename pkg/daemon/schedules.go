@@ -0,0 +1,381 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/robfig/cron"
+)
+
+// ScheduledRunTimeout is how long a scheduled run may take until it is stopped and counted as failed
+var ScheduledRunTimeout = 10 * time.Minute
+
+// ScheduleInstruction tells which blueprint is to be run when. At each tick an instance is started,
+// the input is pushed into it and the instance is removed once its output has arrived. The runs are
+// recorded in the run store like the runs of all other instances.
+type ScheduleInstruction struct {
+	Id    uuid.UUID       `json:"id"`
+	Props core.Properties `json:"props"`
+	Gens  core.Generics   `json:"gens"`
+	Input interface{}     `json:"input"`
+	// Crontab spec with seconds, e.g. "0 */5 * * * *", or a descriptor such as "@every 1h"
+	Cron string `json:"cron"`
+}
+
+// scheduleRecord is what is persisted of a schedule
+type scheduleRecord struct {
+	Id         string          `json:"id"`
+	Owner      string          `json:"owner"`
+	Workspace  string          `json:"workspace"`
+	Operator   uuid.UUID       `json:"operator"`
+	Generics   core.Generics   `json:"gens,omitempty"`
+	Properties core.Properties `json:"props,omitempty"`
+	Input      interface{}     `json:"input,omitempty"`
+	Cron       string          `json:"cron"`
+	Created    time.Time       `json:"created"`
+}
+
+// scheduleInfo is a schedule as it is sent to clients, runs are listed separately
+type scheduleInfo struct {
+	Id        string          `json:"id"`
+	Owner     string          `json:"owner"`
+	Workspace string          `json:"workspace"`
+	Operator  uuid.UUID       `json:"operator"`
+	Gens      core.Generics   `json:"gens,omitempty"`
+	Props     core.Properties `json:"props,omitempty"`
+	Input     interface{}     `json:"input,omitempty"`
+	Cron      string          `json:"cron"`
+	Created   time.Time       `json:"created"`
+	Next      time.Time       `json:"next"`
+	LastRun   *runSummary     `json:"lastRun,omitempty"`
+}
+
+// scheduleManager starts instances of blueprints according to their schedules. If a registry file
+// is set, schedules are persisted to it and scheduled again when it is loaded.
+type scheduleManager struct {
+	mutex     *sync.Mutex
+	schedules map[string]*scheduleRecord
+	cancels   map[string]context.CancelFunc
+	instances *runningOperatorManager
+	file      string
+
+	// Serializes writing the registry file
+	persistMutex *sync.Mutex
+}
+
+func newScheduleManager(instances *runningOperatorManager) *scheduleManager {
+	return &scheduleManager{
+		mutex:        &sync.Mutex{},
+		schedules:    make(map[string]*scheduleRecord),
+		cancels:      make(map[string]context.CancelFunc),
+		instances:    instances,
+		persistMutex: &sync.Mutex{},
+	}
+}
+
+// Create validates the instruction and schedules it for the user in the workspace
+func (sm *scheduleManager) Create(si ScheduleInstruction, owner *UserID, workspace string, hub *Hub) (scheduleInfo, error) {
+	spec, err := cron.Parse(si.Cron)
+	if err != nil {
+		return scheduleInfo{}, fmt.Errorf("invalid cron spec: %s", err)
+	}
+	st, err := sm.instances.workspaces.Get(workspace)
+	if err != nil {
+		return scheduleInfo{}, err
+	}
+	if _, err := st.Load(si.Id); err != nil {
+		return scheduleInfo{}, err
+	}
+
+	rec := &scheduleRecord{
+		Id:         newHandle(),
+		Owner:      owner.Name,
+		Workspace:  workspace,
+		Operator:   si.Id,
+		Generics:   si.Gens,
+		Properties: si.Props,
+		Input:      si.Input,
+		Cron:       si.Cron,
+		Created:    time.Now(),
+	}
+
+	sm.mutex.Lock()
+	sm.schedules[rec.Id] = rec
+	sm.schedule(rec.Id, spec, hub)
+	info := sm.info(rec)
+	sm.mutex.Unlock()
+
+	sm.persist()
+	return info, nil
+}
+
+// schedule starts the loop running the schedule at each tick, the mutex has to be held
+func (sm *scheduleManager) schedule(id string, spec cron.Schedule, hub *Hub) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.cancels[id] = cancel
+
+	go func() {
+		for {
+			select {
+			case <-time.After(time.Until(spec.Next(time.Now()))):
+				go sm.run(id, hub)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// run starts an instance, pushes the input and finishes the run of the instance with the output
+func (sm *scheduleManager) run(id string, hub *Hub) {
+	sm.mutex.Lock()
+	rec, ok := sm.schedules[id]
+	if !ok {
+		sm.mutex.Unlock()
+		return
+	}
+	ins := newInstanceRecord(RunInstruction{Id: rec.Operator, Gens: rec.Generics, Props: rec.Properties},
+		&UserID{Name: rec.Owner}, rec.Workspace)
+	ins.Schedule = id
+	input := rec.Input
+	sm.mutex.Unlock()
+
+	ro, err := sm.instances.launch(ins, hub)
+	if err != nil {
+		log.Printf("scheduled run of %s failed: %s", id, err)
+		return
+	}
+
+	output, err := pushScheduled(ro, input)
+	if err != nil {
+		log.Printf("scheduled run of %s failed: %s", id, err)
+	}
+	ro.conclude(output, err)
+	if err := sm.instances.Halt(ins.Handle, true); err != nil {
+		log.Printf("scheduled instance %s could not be removed: %s", ins.Handle, err)
+	}
+}
+
+func pushScheduled(ro *runningOperator, input interface{}) (interface{}, error) {
+	inDef, ok := ro.inDef()
+	if !ok {
+		return nil, fmt.Errorf("instance is %s", ro.snapshot().State)
+	}
+	input = core.CleanValue(input)
+	if err := inDef.VerifyData(input); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ScheduledRunTimeout)
+	defer cancel()
+	return ro.Push(ctx, input)
+}
+
+// info returns the schedule as it is sent to clients, the mutex has to be held
+func (sm *scheduleManager) info(rec *scheduleRecord) scheduleInfo {
+	info := scheduleInfo{
+		Id:        rec.Id,
+		Owner:     rec.Owner,
+		Workspace: rec.Workspace,
+		Operator:  rec.Operator,
+		Gens:      rec.Generics,
+		Props:     rec.Properties,
+		Input:     rec.Input,
+		Cron:      rec.Cron,
+		Created:   rec.Created,
+	}
+	if spec, err := cron.Parse(rec.Cron); err == nil {
+		info.Next = spec.Next(time.Now())
+	}
+	if runs := sm.instances.runs.List(&UserID{Name: rec.Owner}, runFilter{Schedule: rec.Id}); len(runs) > 0 {
+		info.LastRun = &runs[0]
+	}
+	return info
+}
+
+// GetOwned returns the schedule only if the user is allowed to access it, other schedules are treated as unknown
+func (sm *scheduleManager) GetOwned(id string, user *UserID) (scheduleInfo, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	rec, ok := sm.schedules[id]
+	if !ok || !user.owns(rec.Owner) {
+		return scheduleInfo{}, fmt.Errorf("unknown schedule: %s", id)
+	}
+	return sm.info(rec), nil
+}
+
+// Runs returns the runs of the schedule, the most recent run first
+func (sm *scheduleManager) Runs(id string, user *UserID) ([]runSummary, error) {
+	if _, err := sm.GetOwned(id, user); err != nil {
+		return nil, err
+	}
+	return sm.instances.runs.List(user, runFilter{Schedule: id}), nil
+}
+
+// List returns the schedules the user is allowed to access ordered by their creation
+func (sm *scheduleManager) List(user *UserID) []scheduleInfo {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	infos := make([]scheduleInfo, 0)
+	for _, rec := range sm.schedules {
+		if user.owns(rec.Owner) {
+			infos = append(infos, sm.info(rec))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+// Delete stops scheduling, runs in progress are finished
+func (sm *scheduleManager) Delete(id string) {
+	sm.mutex.Lock()
+	if cancel, ok := sm.cancels[id]; ok {
+		cancel()
+		delete(sm.cancels, id)
+	}
+	delete(sm.schedules, id)
+	sm.mutex.Unlock()
+
+	sm.persist()
+}
+
+// InWorkspace tells whether there are schedules of blueprints of the workspace
+func (sm *scheduleManager) InWorkspace(workspace string) bool {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, rec := range sm.schedules {
+		if rec.Workspace == workspace {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the schedules from the registry file and schedules them again.
+// From now on all changes are persisted to this file.
+func (sm *scheduleManager) Load(file string, hub *Hub) error {
+	sm.persistMutex.Lock()
+	sm.file = file
+	sm.persistMutex.Unlock()
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var records []*scheduleRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, rec := range records {
+		spec, err := cron.Parse(rec.Cron)
+		if err != nil {
+			log.Printf("schedule %s could not be restored: %s", rec.Id, err)
+			continue
+		}
+		sm.schedules[rec.Id] = rec
+		sm.schedule(rec.Id, spec, hub)
+	}
+
+	return nil
+}
+
+// persist writes all schedules to the registry file, if there is one
+func (sm *scheduleManager) persist() {
+	sm.persistMutex.Lock()
+	defer sm.persistMutex.Unlock()
+
+	if sm.file == "" {
+		return
+	}
+
+	sm.mutex.Lock()
+	records := make([]scheduleRecord, 0, len(sm.schedules))
+	for _, rec := range sm.schedules {
+		records = append(records, *rec)
+	}
+	sm.mutex.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Created.Before(records[j].Created)
+	})
+
+	if err := writeFileAtomic(sm.file, records); err != nil {
+		log.Printf("[ERROR] could not persist schedules: %v", err)
+	}
+}
+
+var ScheduleService = &Service{map[string]*Endpoint{
+	"/": {func(w http.ResponseWriter, r *http.Request) {
+		schedules := getSchedules(r)
+		if r.Method == "GET" {
+			writeJSON(w, schedules.List(GetUser(r)))
+		} else if r.Method == "POST" {
+			var si ScheduleInstruction
+			if err := json.NewDecoder(r.Body).Decode(&si); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+			info, err := schedules.Create(si, GetUser(r), getWorkspace(r), GetHub(r))
+			if err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+			sendSuccess(w, &responseOK{Data: info})
+		}
+	}},
+	"/{id:\\w+}/": {func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		schedules := getSchedules(r)
+		info, err := schedules.GetOwned(id, GetUser(r))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, info)
+		case "DELETE":
+			schedules.Delete(id)
+			sendStatusSuccess(w)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}},
+	"/{id:\\w+}/runs/": {func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, err := parsePage(r.URL.Query())
+		if err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		runs, err := getSchedules(r).Runs(mux.Vars(r)["id"], GetUser(r))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, pageRuns(runs, offset, limit))
+	}},
+}}
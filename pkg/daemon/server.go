@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
 
 	"github.com/rs/cors"
 
@@ -27,8 +29,13 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, clients push items into instances through the websocket.
+	maxMessageSize = 64 * 1024
+
+	// Messages for a client are collected as long as new ones arrive within `batchMin`,
+	// but for no longer than `batchMax`.
+	batchMin = 100 * time.Millisecond
+	batchMax = 500 * time.Millisecond
 )
 
 var (
@@ -41,9 +48,9 @@ var (
 		// allow every host/origin to make a connection e.g. :8080 -> 5149
 		CheckOrigin: func(r *http.Request) bool { return true },
 	}
-	// Root defines a single instance of our user as we currently do not have
-	// I use that to get the rest of the code to think about multi tenancy
-	Root = &UserID{0}
+	// Root is the user of all requests as long as no authentication is enabled,
+	// it is allowed to access everything.
+	Root = &UserID{Name: "root", Admin: true}
 )
 
 // Hub maintains the set of active clients and broadcasts messages to the
@@ -60,6 +67,14 @@ type Hub struct {
 
 	// Unregister requests from clients.
 	unregister chan *ConnectedClient
+
+	// Messages that should be sent to a single connection only
+	direct chan *directMessage
+}
+
+type directMessage struct {
+	client  *ConnectedClient
+	message *message
 }
 
 // Envelop functions as an addressable pack of messages that is only sent to
@@ -70,7 +85,9 @@ type Hub struct {
 // Receiving end must of course know that message can hold 1+N message and dispatch accordingly.
 type envelop struct {
 	receiver *UserID
-	messages []*message
+	// If set only clients of this workspace receive the messages
+	workspace string
+	messages  []*message
 }
 
 // In the end we need to represent a message we want to send to a connected client.
@@ -99,6 +116,8 @@ type Server struct {
 	Port   int
 	router *mux.Router
 	ctx    *context.Context
+	// Requests are only served if the authenticator knows the user, without one every request is made by `Root`
+	auth Authenticator
 }
 
 // ConnectedClient holds everything we need to know about a connection that
@@ -107,18 +126,39 @@ type ConnectedClient struct {
 	hub       *Hub
 	websocket *websocket.Conn
 	userID    *UserID
-	// Send data through this channel in order to get it send through the websocket
-	// currently this is what the `hub` uses to send it's received message through a websocket.
-	send chan []byte
+	// The `hub` puts the messages accepted by the client into this channel,
+	// they are collected and sent through the websocket in batches.
+	queue chan *message
+	// While a client has no subscriptions it receives all messages of its user
+	subscriptions *subscriptions
+	// Instances the client can push items into
+	instances *runningOperatorManager
+	// Workspace selected when connecting, the client only receives blueprint events of this workspace
+	workspace string
 }
 
 // UserID represents an Identifier for a user of the system
 // This is also intended to deliver `envelops` to the correct `ConnectedClients`
-// instead of sending a message to all connected clients. Currently we do not have real users.
-// The variable acts more as a placeholder and thinking vehicle to remind oneself that the system
-// might have more than one user in the future - I know, YAGNI.
+// instead of sending a message to all connected clients. Users are identified by their name.
 type UserID struct {
-	id int
+	Name  string
+	Email string
+	// Admins are allowed to access the instances and blueprints of all users
+	Admin bool
+}
+
+// author is who changes of the user are attributed to by storages recording authors
+func (u *UserID) author() storage.GitAuthor {
+	email := u.Email
+	if email == "" {
+		email = u.Name + "@localhost"
+	}
+	return storage.GitAuthor{Name: u.Name, Email: email}
+}
+
+// owns tells whether the user is allowed to access something owned by the given user name
+func (u *UserID) owns(owner string) bool {
+	return u.Admin || u.Name == owner
 }
 
 // We want types around the topic as this makes it easier to work with.
@@ -128,13 +168,15 @@ type Topic int
 
 const (
 	Port     Topic = iota
-	Operator       // currently unused but displays the intended usage
+	Operator       // blueprints have been added, changed or removed
+	Reply          // answers to commands a client sent through the websocket
+	Instance       // an instance has been reloaded or could not be reloaded
 )
 
 // Since we can't send proper type information over the wire, we send a string
 // representation instead.
 func (t Topic) String() string {
-	return [...]string{"Port", "Operator"}[t]
+	return [...]string{"Port", "Operator", "Reply", "Instance"}[t]
 }
 
 // This encodes a `Topic` to Json using it's string representation
@@ -153,6 +195,7 @@ func newHub() *Hub {
 		broadcast:  make(chan *envelop),
 		register:   make(chan *ConnectedClient),
 		unregister: make(chan *ConnectedClient),
+		direct:     make(chan *directMessage),
 		clients:    make(map[*ConnectedClient]bool),
 	}
 }
@@ -162,98 +205,70 @@ func newHub() *Hub {
 func (h *Hub) broadCastTo(u *UserID, topic Topic, data interface{}) {
 	var messages []*message
 	messages = append(messages, &message{topic, data})
-	h.broadcast <- &envelop{u, messages}
+	h.broadcast <- &envelop{u, "", messages}
+}
+
+// Send a message to the connections of a single user, or of all users if u is nil, which have selected the workspace
+func (h *Hub) broadCastToWorkspace(u *UserID, workspace string, topic Topic, data interface{}) {
+	h.broadcast <- &envelop{u, workspace, []*message{{topic, data}}}
+}
+
+// Send a message to a single connection, e.g. the reply to a command the client sent
+func (h *Hub) sendTo(c *ConnectedClient, topic Topic, data interface{}) {
+	h.direct <- &directMessage{c, &message{topic, data}}
 }
 
 func (h *Hub) run() {
-	var (
-		incomingEnvelop *envelop
-		ok              bool
-		minTimer        <-chan time.Time
-		maxTimer        <-chan time.Time
-	)
-	min := 100 * time.Millisecond
-	max := 500 * time.Millisecond
-	postBox := make(map[*UserID]*envelop)
-
-	actualSend := func(letter *envelop) {
-		for client := range h.clients {
-			// this might become PINA as iterating all clients to find only those which we want to address
-			// could get expensive - maybe look up the clients by `userID` in the first place.
-			if client.userID != letter.receiver {
-				continue
-			}
-			// wrapping `<-` with a `select` and `default` makes it non-blocking if there is no receiver on the other reading off the channel.
-			// The channel is buffered meaning that we can successfully write into it as long as a receiver is pulling data from the other end.
-			select {
-			case client.send <- letter.Bytes():
-				// message written
-			default:
-				// buffer of channel full - no one reading? Let's disconnect them.
-				close(client.send)
-				delete(h.clients, client)
-			}
+	deliver := func(client *ConnectedClient, m *message) {
+		if !h.clients[client] {
+			return
+		}
+		// wrapping `<-` with a `select` and `default` makes it non-blocking if there is no receiver on the other reading off the channel.
+		// The channel is buffered meaning that we can successfully write into it as long as a receiver is pulling data from the other end.
+		select {
+		case client.queue <- m:
+			// message queued
+		default:
+			// buffer of channel full - no one reading? Let's disconnect them.
+			close(client.queue)
+			delete(h.clients, client)
 		}
 	}
 
-	// This implementation is flawed as minTimer and maxTimer introduce a global tick for sending messages.
-	// Meaning that as long as any UserID is sent a message from the backend all other outgoing messages are
-	// collected so that no other UserID might get their message. Before either `minTimer` or `maxTimer` is up.
-	// As consequence message for all UserIDs are blocked for `maxTimer`.
-	//
-	// One way around this would be to use dynamic `select` with `reflect.Select` and `reflect.SelectCase`
-	// where we could build up a per UserID timer. But for now we live with the lag between `minTimer` and `maxTimer`
+	// Batching happens per client, so a busy client does not delay the messages of any other.
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
 		case client := <-h.unregister:
-			if _, ok = h.clients[client]; ok {
+			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
-			}
-		case incomingEnvelop = <-h.broadcast:
-			// Keep adding messages from other envelop for at least `min` amount of time to the postbox.
-			minTimer = time.After(min)
-			// We only want to set the how long we are going to keep adding messages once.
-			if maxTimer == nil {
-				maxTimer = time.After(max)
+				close(client.queue)
 			}
-			// If we already have a envelop for that user, append the contents of the current envelop
-			// to the one that is already scheduled to be sent.
-			if _, ok := postBox[incomingEnvelop.receiver]; ok {
-				// What we do here is to grow the single envelop`s messages.
-				postBox[incomingEnvelop.receiver].append(incomingEnvelop.messages...)
-			} else {
-				// If do not yet have a letter to be sent create one for the current receiver.
-				postBox[incomingEnvelop.receiver] = incomingEnvelop
+		case e := <-h.broadcast:
+			for client := range h.clients {
+				// this might become PINA as iterating all clients to find only those which we want to address
+				// could get expensive - maybe look up the clients by `userID` in the first place.
+				if e.receiver != nil && !client.userID.owns(e.receiver.Name) {
+					continue
+				}
+				if e.workspace != "" && e.workspace != client.workspace {
+					continue
+				}
+				for _, m := range e.messages {
+					if client.subscriptions.accepts(m) {
+						deliver(client, m)
+					}
+				}
 			}
-
-		case <-minTimer:
-			// We have not seen new letters since `min` time which means we can now send
-			// send the letters to all users.
-			minTimer, maxTimer = nil, nil
-			for _, e := range postBox {
-				actualSend(e)
-			}
-			// we also need to clear our letters since we have sent them all
-			postBox = make(map[*UserID]*envelop)
-		case <-maxTimer:
-			// Enough time has now passed and we should now send what we have already collected.
-			// This useful in scenarios where we send just enough data to
-			minTimer, maxTimer = nil, nil
-			for _, e := range postBox {
-				actualSend(e)
-			}
-			postBox = make(map[*UserID]*envelop)
+		case d := <-h.direct:
+			deliver(d.client, d.message)
 		}
 	}
 }
 
-func (c *ConnectedClient) waitOnIncoming() {
+func (c *ConnectedClient) waitOnIncoming(ctx context.Context) {
 	ws := c.websocket
-	newline := []byte{'\n'}
-	space := []byte{' '}
 	defer func() {
 		c.hub.unregister <- c
 	}()
@@ -270,31 +285,58 @@ func (c *ConnectedClient) waitOnIncoming() {
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
-		log.Printf("Got Message: %v", message)
+
+		var cmd clientCommand
+		if err := json.Unmarshal(bytes.TrimSpace(message), &cmd); err != nil {
+			c.hub.sendTo(c, Reply, &commandReply{Error: &Error{Msg: err.Error(), Code: "E000X"}})
+			continue
+		}
+		c.handle(ctx, cmd)
 	}
 }
 
 func (c *ConnectedClient) waitOnOutgoing() {
+	var (
+		pending  []*message
+		minTimer <-chan time.Time
+		maxTimer <-chan time.Time
+	)
 	ticker := time.NewTicker(pingPeriod)
 	ws := c.websocket
 	defer func() {
 		ticker.Stop()
 		c.hub.unregister <- c
 	}()
+
+	flush := func() error {
+		letter := &envelop{c.userID, c.workspace, pending}
+		pending, minTimer, maxTimer = nil, nil, nil
+		ws.SetWriteDeadline(time.Now().Add(writeWait))
+		return ws.WriteMessage(websocket.TextMessage, letter.Bytes())
+	}
+
 	for {
 		select {
-		case msg, ok := <-c.send:
+		case msg, ok := <-c.queue:
 			if !ok {
-				// This happens if there was a call to `close(c.send)`,
+				// This happens if there was a call to `close(c.queue)`,
 				// which means the client was disconnect from the hub via `unregister <- c` or otherwise closed.
-				//
-				// And actually we should never reach this in normal execution, as the client should no
-				// longer be in the list of registered client, otherwise we would be reading an endless amount of <nil>.
 				return
 			}
-			ws.SetWriteDeadline(time.Now().Add(writeWait))
-			ws.WriteMessage(websocket.TextMessage, msg)
+			pending = append(pending, msg)
+			// Keep collecting messages for at least `batchMin`, but set the deadline only once
+			minTimer = time.After(batchMin)
+			if maxTimer == nil {
+				maxTimer = time.After(batchMax)
+			}
+		case <-minTimer:
+			if err := flush(); err != nil {
+				return
+			}
+		case <-maxTimer:
+			if err := flush(); err != nil {
+				return
+			}
 		case <-ticker.C:
 			ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -306,7 +348,7 @@ func (c *ConnectedClient) waitOnOutgoing() {
 
 func serveWs(w http.ResponseWriter, r *http.Request) {
 	hub := GetHub(r)
-	user := Root
+	user := GetUser(r)
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); !ok {
@@ -318,13 +360,14 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
 	// attaching the user makes it possible to send message to multiple
 	// open browsers that are associated with the user.
 	//
-	// Then channel is a bytes channel with the size of 256, I am unsure of
-	// wether this is enough and what happends if we have message greater than that.
-	// Might be a better idea to make channel of a type with a smaller size the get the same effect.
-	// Without the uncertainty.
-	client := &ConnectedClient{hub, ws, user, make(chan []byte, 256)}
+	// The queue holds up to 256 messages which have not been sent yet,
+	// clients not keeping up with that are disconnected.
+	client := &ConnectedClient{hub, ws, user, make(chan *message, 256), newSubscriptions(), getInstances(r), getWorkspace(r)}
 	hub.register <- client
 
+	// Pushes of the client are cancelled once it disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Part of the RFC is this Ping<>Pong thing which we need to have both in the writer and reader of the
 	// socket connection. see -> https://developer.mozilla.org/en-US/docs/Web/API/WebSockets_API/Writing_WebSocket_servers#Pings_and_Pongs_The_Heartbeat_of_WebSockets
 	//
@@ -332,27 +375,46 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
 	// waits on messages from the `hub` that it can forward outwards to the connected client
 	go client.waitOnOutgoing()
 
-	// we keep this around for now as it serves the websocket ping<>pong
-	// if we want to allow the UI to control the daemon via websockets, this is the place.
-	go client.waitOnIncoming()
+	// Apart from serving the websocket ping<>pong this go routine handles the commands of the client,
+	// see `clientCommand`.
+	go func() {
+		defer cancel()
+		client.waitOnIncoming(ctx)
+	}()
 
 	// so basically only returns if the ping pong fails or there is another error.
 }
 
 func NewServer(ctx *context.Context, env *env.Environment) *Server {
 	r := mux.NewRouter().StrictSlash(true)
-	srv := &Server{env.HTTP.Address, env.HTTP.Port, r, ctx}
+	// Each server manages its own workspaces and instances
+	workspaces := newWorkspaceManager((*ctx).Value(storageKey).(*storage.Storage))
+	srvCtx := context.WithValue(*ctx, workspacesKey, workspaces)
+	instances := newRunningOperatorManager(workspaces)
+	srvCtx = context.WithValue(srvCtx, instancesKey, instances)
+	srvCtx = context.WithValue(srvCtx, schedulesKey, newScheduleManager(instances))
+	srvCtx = context.WithValue(srvCtx, ownersKey, newOwnerRegistry())
+	srv := &Server{env.HTTP.Address, env.HTTP.Port, r, &srvCtx, nil}
 	srv.mountWebServices()
 	return srv
 }
 
 func (s *Server) Handler() http.Handler {
 	handler := cors.New(cors.Options{
-		AllowedMethods: []string{"GET", "POST", "DELETE"},
-	}).Handler(s.router)
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization", workspaceHeader},
+	}).Handler(authenticate(s.auth, selectWorkspace(s.router)))
 	return addContext(*s.ctx, handler)
 }
 
+// EnableAuth makes the server serve authenticated requests only. Ownership of blueprints is persisted
+// in the owners file, the ownership of instances is persisted along with the instances.
+func (s *Server) EnableAuth(auth Authenticator, ownersFile string) error {
+	s.auth = auth
+	owners := (*s.ctx).Value(ownersKey).(*ownerRegistry)
+	return owners.Load(ownersFile)
+}
+
 func (s *Server) AddWebsocket(path string) {
 	r := s.router.Path(path)
 	r.HandlerFunc(serveWs)
@@ -374,9 +436,55 @@ func (s *Server) mountWebServices() {
 	s.AddService("/share", SharingService)
 	s.AddService("/instances", InstanceService)
 	s.AddService("/instance", RunningInstanceService)
+	s.AddService("/workspaces", WorkspaceService)
+	s.AddService("/schedules", ScheduleService)
+	s.AddService("/runs", RunLogService)
 	s.AddWebsocket("/ws")
 }
 
+// LoadInstances restores the instances persisted in the registry file and keeps persisting them there.
+// Instances which have been running are started again.
+func (s *Server) LoadInstances(registryFile string) error {
+	hub, _ := (*s.ctx).Value(hubKey).(*Hub)
+	instances := (*s.ctx).Value(instancesKey).(*runningOperatorManager)
+	return instances.Load(registryFile, hub)
+}
+
+// LoadRuns keeps the finished runs of instances in the directory and drops them according to the retention
+func (s *Server) LoadRuns(dir string, retention RunRetention) error {
+	instances := (*s.ctx).Value(instancesKey).(*runningOperatorManager)
+	return instances.runs.Load(dir, retention)
+}
+
+// LoadSchedules restores the schedules persisted in the registry file and keeps persisting them there.
+// Like instances, schedules can only be restored after the workspaces have been loaded.
+func (s *Server) LoadSchedules(registryFile string) error {
+	hub, _ := (*s.ctx).Value(hubKey).(*Hub)
+	schedules := (*s.ctx).Value(schedulesKey).(*scheduleManager)
+	return schedules.Load(registryFile, hub)
+}
+
+// WatchBlueprints notifies connected clients through the `Operator` topic whenever blueprint files of
+// their workspace change, including changes made by hand or by git
+func (s *Server) WatchBlueprints() error {
+	hub, ok := (*s.ctx).Value(hubKey).(*Hub)
+	if !ok {
+		return errors.New("no websocket to notify")
+	}
+	workspaces := (*s.ctx).Value(workspacesKey).(*workspaceManager)
+	owners := (*s.ctx).Value(ownersKey).(*ownerRegistry)
+	return workspaces.Watch(func(workspace string, change storage.Change) {
+		notifyBlueprintEvent(hub, owners, &blueprintEvent{change.Kind, change.Id, workspace})
+	})
+}
+
+// LoadWorkspaces makes the directories in the given directory available as workspaces,
+// new workspaces are created there. Instances of these workspaces can only be restored afterwards.
+func (s *Server) LoadWorkspaces(dir string) error {
+	workspaces := (*s.ctx).Value(workspacesKey).(*workspaceManager)
+	return workspaces.Load(dir)
+}
+
 func (s *Server) AddService(pathPrefix string, services *Service) {
 	r := s.router.PathPrefix(pathPrefix).Subrouter()
 	for path, endpoint := range services.Routes {
@@ -22,9 +22,25 @@ type contextKey string
 
 const storageKey contextKey = "storage"
 const hubKey contextKey = "hub"
-
+const instancesKey contextKey = "instances"
+const schedulesKey contextKey = "schedules"
+const userKey contextKey = "user"
+const ownersKey contextKey = "owners"
+const workspacesKey contextKey = "workspaces"
+const workspaceKey contextKey = "workspace"
+
+// GetStorage returns the storage of the workspace of the request, changes are attributed to the authenticated user
 func GetStorage(r *http.Request) storage.Storage {
-	return *contextGet(r, storageKey).(*storage.Storage)
+	return *authored(r, contextGet(r, storageKey).(*storage.Storage))
+}
+
+// authored returns the storage attributing changes to the user of the request,
+// without authentication changes are attributed to the default authors of the backends
+func authored(r *http.Request, st *storage.Storage) *storage.Storage {
+	if user, ok := contextGet(r, userKey).(*UserID); ok {
+		return st.As(user.author())
+	}
+	return st
 }
 
 func SetHub(ctx context.Context, h *Hub) context.Context {
@@ -35,6 +51,42 @@ func GetHub(r *http.Request) *Hub {
 	return contextGet(r, hubKey).(*Hub)
 }
 
+func getInstances(r *http.Request) *runningOperatorManager {
+	return contextGet(r, instancesKey).(*runningOperatorManager)
+}
+
+func getRuns(r *http.Request) *runStore {
+	return getInstances(r).runs
+}
+
+func getSchedules(r *http.Request) *scheduleManager {
+	return contextGet(r, schedulesKey).(*scheduleManager)
+}
+
+// GetUser returns the user the request has been authenticated as
+func GetUser(r *http.Request) *UserID {
+	if user, ok := contextGet(r, userKey).(*UserID); ok {
+		return user
+	}
+	return Root
+}
+
+func getWorkspaces(r *http.Request) *workspaceManager {
+	return contextGet(r, workspacesKey).(*workspaceManager)
+}
+
+// getWorkspace returns the name of the workspace selected by the request
+func getWorkspace(r *http.Request) string {
+	if name, ok := contextGet(r, workspaceKey).(string); ok {
+		return name
+	}
+	return DefaultWorkspace
+}
+
+func getOwners(r *http.Request) *ownerRegistry {
+	return contextGet(r, ownersKey).(*ownerRegistry)
+}
+
 func SetStorage(ctx context.Context, st *storage.Storage) context.Context {
 	return context.WithValue(ctx, storageKey, st)
 }
@@ -56,6 +108,11 @@ type responseOK struct {
 	Data interface{} `json:"data,omitempty"`
 }
 
+// responseStatus is sent by requests which have nothing else to respond
+type responseStatus struct {
+	Status string `json:"status"`
+}
+
 type responseBad struct {
 	Error *Error `json:"error,omitempty"`
 }
@@ -68,6 +125,22 @@ func sendSuccess(w http.ResponseWriter, resp *responseOK) {
 	}
 }
 
+func sendStatusSuccess(w http.ResponseWriter) {
+	w.WriteHeader(200)
+	err := writeJSON(w, &responseStatus{"success"})
+	if err != nil {
+		log.Printf("[ERROR] %v\n", err)
+	}
+}
+
+func sendForbidden(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusForbidden)
+	err := writeJSON(w, &responseBad{&Error{Msg: msg, Code: "E000X"}})
+	if err != nil {
+		log.Printf("[ERROR] %v\n", err)
+	}
+}
+
 func sendFailure(w http.ResponseWriter, resp *responseBad) {
 	w.WriteHeader(400)
 	err := writeJSON(w, resp)
@@ -4,25 +4,141 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
-	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/Bitspark/go-version"
+	"github.com/Bitspark/slang/pkg/api"
+	"github.com/Bitspark/slang/pkg/core"
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v2"
 )
 
+const manifestFile = "manifest.yaml"
+
 type manifest struct {
-	SlangVersion string `yaml:"slangVersion"`
-	TimeUnix     int64  `yaml:"timeUnix"`
+	SlangVersion string    `yaml:"slangVersion"`
+	TimeUnix     int64     `yaml:"timeUnix"`
+	Main         uuid.UUID `yaml:"main"`
+}
+
+// packBlueprints writes a zip archive containing the manifest and one YAML file per blueprint
+func packBlueprints(main uuid.UUID, blueprints []core.Blueprint) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+
+	manifestBytes, err := yaml.Marshal(&manifest{
+		SlangVersion: SlangVersion,
+		TimeUnix:     time.Now().Unix(),
+		Main:         main,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fileWriter, err := zipWriter.Create(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	fileWriter.Write(manifestBytes)
+
+	for _, bp := range blueprints {
+		blueprintBytes, err := yaml.Marshal(&bp)
+		if err != nil {
+			return nil, err
+		}
+		fileWriter, err := zipWriter.Create(bp.Id.String() + ".yaml")
+		if err != nil {
+			return nil, err
+		}
+		fileWriter.Write(blueprintBytes)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpackBlueprints reads the manifest and the blueprints of a zip archive
+func unpackBlueprints(zipReader *zip.Reader) (*manifest, []core.Blueprint, error) {
+	var m *manifest
+	blueprints := make([]core.Blueprint, 0)
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		fileReader, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := ioutil.ReadAll(fileReader)
+		fileReader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if file.Name == manifestFile {
+			m = &manifest{}
+			if err := yaml.Unmarshal(content, m); err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", manifestFile, err)
+			}
+			continue
+		}
+
+		var bp core.Blueprint
+		switch path.Ext(file.Name) {
+		case ".yaml", ".yml":
+			bp, err = core.ParseYAMLOperatorDef(string(content))
+		case ".json":
+			bp, err = core.ParseJSONOperatorDef(string(content))
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", file.Name, err)
+		}
+		blueprints = append(blueprints, bp)
+	}
+
+	if m == nil {
+		return nil, nil, fmt.Errorf("missing %s", manifestFile)
+	}
+	return m, blueprints, nil
 }
 
-/* TODO re-implements this service
- */
+// checkManifestVersion rejects archives created by a newer slang version
+func checkManifestVersion(m *manifest) error {
+	if m.SlangVersion == "" {
+		// Archive has been exported by a development build
+		return nil
+	}
+
+	manifestVersion, err := version.NewVersion(m.SlangVersion)
+	if err != nil {
+		return fmt.Errorf("invalid slang version in manifest: %s", m.SlangVersion)
+	}
+
+	myVersion, err := version.NewVersion(SlangVersion)
+	if err != nil {
+		// Development builds have no proper version
+		return nil
+	}
+
+	if myVersion.LessThan(manifestVersion) {
+		return fmt.Errorf("archive requires slang %s, please upgrade your slang version", manifestVersion)
+	}
+	return nil
+}
 
 var SharingService = &Service{map[string]*Endpoint{
 	"/export": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
 		fail := func(err *Error) {
 			sendFailure(w, &responseBad{err})
 		}
@@ -31,33 +147,28 @@ var SharingService = &Service{map[string]*Endpoint{
 		 */
 		if r.Method == "GET" {
 			opId, err := uuid.Parse(r.FormValue("id"))
-
 			if err != nil {
 				fail(&Error{Msg: err.Error(), Code: "E000X"})
 				return
 			}
 
-			buf := new(bytes.Buffer)
-			zipWriter := zip.NewWriter(buf)
-
-			fileWriter, _ := zipWriter.Create("manifest.yaml")
-			manifestBytes, _ := yaml.Marshal(&manifest{
-				SlangVersion: SlangVersion,
-				TimeUnix:     time.Now().Unix(),
-			})
-
-			fileWriter.Write(manifestBytes)
+			bp, err := st.Load(opId)
+			if err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
+			}
 
-			/* TODO
-			read := make(map[uuid.UUID]bool)
-			err = st.PackOperator(zipWriter, opId, read)
+			blueprints, err := api.GatherBlueprints(bp, &st)
 			if err != nil {
 				fail(&Error{Msg: err.Error(), Code: "E000X"})
 				return
 			}
-			*/
 
-			zipWriter.Close()
+			archive, err := packBlueprints(opId, blueprints)
+			if err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
+			}
 
 			w.Header().Set("Pragma", "public")
 			w.Header().Set("Expires", "0")
@@ -67,19 +178,25 @@ var SharingService = &Service{map[string]*Endpoint{
 			w.Header().Set("Content-Type", "application/octet-stream")
 			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", opId))
 			w.Header().Set("Content-Transfer-Encoding", "binary")
-			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(buf.Bytes())))
-			w.Write(buf.Bytes())
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(archive)))
+			w.Write(archive)
 		}
 	}},
 	"/import": {func(w http.ResponseWriter, r *http.Request) {
+		st := GetStorage(r)
 		fail := func(err *Error) {
 			sendFailure(w, &responseBad{err})
 		}
 		/*
-		 * GET
+		 * POST
 		 */
 		if r.Method == "POST" {
-			var buf bytes.Buffer
+			policy, err := api.ParseConflictPolicy(r.FormValue("conflict"))
+			if err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
+			}
+
 			file, header, err := r.FormFile("file")
 			if err != nil {
 				fail(&Error{Msg: err.Error(), Code: "E000X"})
@@ -87,38 +204,47 @@ var SharingService = &Service{map[string]*Endpoint{
 			}
 			defer file.Close()
 
-			io.Copy(&buf, file)
-
 			zipReader, err := zip.NewReader(file, header.Size)
 			if err != nil {
 				fail(&Error{Msg: err.Error(), Code: "E000X"})
 				return
 			}
 
-			manifest := manifest{}
-			for _, file := range zipReader.File {
-				if file.Name == "manifest.yaml" {
-					fileReader, _ := file.Open()
-					buf := new(bytes.Buffer)
-					buf.ReadFrom(fileReader)
-					yaml.Unmarshal(buf.Bytes(), &manifest)
-					fileReader.Close()
-				}
+			m, blueprints, err := unpackBlueprints(zipReader)
+			if err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
 			}
 
-			myVersion, err := version.NewVersion(SlangVersion)
-			if err == nil {
-				manifestVersion, err := version.NewVersion(manifest.SlangVersion)
-				if err == nil {
-					if myVersion.LessThan(manifestVersion) {
-						fail(&Error{Msg: "Please upgrade your slang version", Code: "E000X"})
+			if err := checkManifestVersion(m); err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
+			}
+
+			user := GetUser(r)
+			owners := getOwners(r)
+			if policy == api.ConflictOverwrite {
+				for _, bp := range blueprints {
+					if !owners.mayChange(user, bp.Id, &st) {
+						sendForbidden(w, fmt.Sprintf("not allowed to overwrite %s", bp.Id))
 						return
 					}
 				}
 			}
 
-			fail(&Error{Msg: "not implemented yet", Code: "E000X"})
-			return
+			result, err := api.ImportBlueprints(blueprints, &st, policy)
+			if err != nil {
+				fail(&Error{Msg: err.Error(), Code: "E000X"})
+				return
+			}
+
+			for _, id := range result.Imported {
+				if err := owners.claim(user, id); err != nil {
+					log.Printf("[ERROR] could not persist owner of %s: %v", id, err)
+				}
+			}
+
+			sendSuccess(w, &responseOK{Data: result})
 		}
 	}},
 }}
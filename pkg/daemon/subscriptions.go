@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/Bitspark/slang/pkg/core"
+)
+
+// clientCommand is sent by a client through the websocket, e.g.
+//
+//	{"type": "subscribe", "handle": "...", "ports": [")output"]}
+//	{"type": "unsubscribe", "handle": "..."}
+//	{"type": "push", "id": "1", "handle": "...", "data": "item"}
+//
+// Every command is answered with a message of topic `Reply` carrying the id of the command.
+type clientCommand struct {
+	Type   string      `json:"type"`
+	Id     string      `json:"id,omitempty"`
+	Handle string      `json:"handle"`
+	Ports  []string    `json:"ports,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+type commandReply struct {
+	Id     string `json:"id,omitempty"`
+	Type   string `json:"type"`
+	Handle string `json:"handle,omitempty"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// subscriptions maps instance handles to the port paths a client wants to receive the outputs of.
+// An empty list of port paths means all ports of the instance.
+type subscriptions struct {
+	mutex    *sync.RWMutex
+	byHandle map[string][]string
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{&sync.RWMutex{}, make(map[string][]string)}
+}
+
+// subscribe replaces the port paths subscribed to for the instance
+func (s *subscriptions) subscribe(handle string, ports []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.byHandle[handle] = ports
+}
+
+func (s *subscriptions) unsubscribe(handle string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.byHandle, handle)
+}
+
+// accepts tells whether the message is meant for the client. As long as there are no subscriptions,
+// all messages are accepted. Otherwise port outputs have to belong to a subscribed instance and port.
+func (s *subscriptions) accepts(m *message) bool {
+	if m.Topic != Port {
+		return true
+	}
+	po, ok := m.Payload.(portOutput)
+	if !ok {
+		return true
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if len(s.byHandle) == 0 {
+		return true
+	}
+	ports, ok := s.byHandle[po.Handle]
+	if !ok {
+		return false
+	}
+	if len(ports) == 0 {
+		return true
+	}
+	for _, path := range ports {
+		if portPathMatches(path, po.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// portPathMatches tells whether the port is the port described by path or one of its sub ports,
+// e.g. ")output" matches ")output.a" but not ")outputs"
+func portPathMatches(path string, port string) bool {
+	if !strings.HasPrefix(port, path) {
+		return false
+	}
+	if len(port) == len(path) || strings.HasSuffix(path, ")") || strings.HasSuffix(path, ".") {
+		return true
+	}
+	return port[len(path)] == '.'
+}
+
+// handle executes a command of the client and replies to it
+func (c *ConnectedClient) handle(ctx context.Context, cmd clientCommand) {
+	reply := &commandReply{Id: cmd.Id, Type: cmd.Type, Handle: cmd.Handle}
+	fail := func(err error) {
+		reply.Error = &Error{Msg: err.Error(), Code: "E000X"}
+		c.hub.sendTo(c, Reply, reply)
+	}
+
+	switch cmd.Type {
+	case "subscribe":
+		if _, err := c.instances.GetOwned(cmd.Handle, c.userID); err != nil {
+			fail(err)
+			return
+		}
+		c.subscriptions.subscribe(cmd.Handle, cmd.Ports)
+	case "unsubscribe":
+		c.subscriptions.unsubscribe(cmd.Handle)
+	case "push":
+		runningIns, err := c.instances.GetOwned(cmd.Handle, c.userID)
+		if err != nil {
+			fail(err)
+			return
+		}
+		inDef, ok := runningIns.inDef()
+		if !ok {
+			fail(fmt.Errorf("instance is %s", runningIns.snapshot().State))
+			return
+		}
+		idat := core.CleanValue(cmd.Data)
+		if err := inDef.VerifyData(idat); err != nil {
+			fail(err)
+			return
+		}
+
+		// Outputs are sent to the subscribers, the reply only tells whether the item has been processed
+		go func() {
+			if _, err := runningIns.Push(ctx, idat); err != nil {
+				log.Printf("instance %s: %s", cmd.Handle, err)
+				fail(err)
+				return
+			}
+			c.hub.sendTo(c, Reply, reply)
+		}()
+		return
+	default:
+		fail(fmt.Errorf("unknown command: %s", cmd.Type))
+		return
+	}
+	c.hub.sendTo(c, Reply, reply)
+}
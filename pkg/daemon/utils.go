@@ -2,12 +2,14 @@ package daemon
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Bitspark/go-version"
 )
@@ -27,19 +29,33 @@ func IsDirEmpty(dir string) bool {
 	return len(entries) == 0
 }
 
-func download(srcUrl string, dstFile *os.File) error {
-	response, err := http.Get(srcUrl)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
+// httpClient fails instead of hanging if the network is gone
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
 
-	_, err = io.Copy(dstFile, response.Body)
-	if err != nil {
-		return err
+// download copies the file at the URL into the destination file, file:// URLs are copied from the disk
+func download(srcUrl string, dstFile *os.File) error {
+	var src io.ReadCloser
+	if strings.HasPrefix(srcUrl, "file://") {
+		f, err := os.Open(filepath.FromSlash(strings.TrimPrefix(srcUrl, "file://")))
+		if err != nil {
+			return err
+		}
+		src = f
+	} else {
+		response, err := httpClient.Get(srcUrl)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return fmt.Errorf("GET %s: %s", srcUrl, response.Status)
+		}
+		src = response.Body
 	}
+	defer src.Close()
 
-	return nil
+	_, err := io.Copy(dstFile, src)
+	return err
 }
 
 func unzip(srcPath string, dstPath string) ([]string, error) {
@@ -61,6 +77,9 @@ func unzip(srcPath string, dstPath string) ([]string, error) {
 
 		// Store filename/path for returning and using later on
 		filePath := filepath.Join(dstPath, f.Name)
+		if !strings.HasPrefix(filePath, filepath.Clean(dstPath)+string(filepath.Separator)) {
+			return filePaths, fmt.Errorf("%s: illegal file path %s", srcPath, f.Name)
+		}
 		filePaths = append(filePaths, filePath)
 
 		if f.FileInfo().IsDir() {
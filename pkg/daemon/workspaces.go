@@ -0,0 +1,315 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// DefaultWorkspace is the workspace of the storage the server has been created with
+const DefaultWorkspace = "default"
+
+// Requests select their workspace with this header or the query parameter `workspace`
+const workspaceHeader = "X-Slang-Workspace"
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+var errUnknownWorkspace = errors.New("unknown workspace")
+
+// blueprintEvent is sent to clients when a blueprint of a workspace has changed
+type blueprintEvent struct {
+	Kind      storage.ChangeKind `json:"kind"`
+	Id        uuid.UUID          `json:"id"`
+	Workspace string             `json:"workspace"`
+}
+
+// notifyBlueprintEvent sends the event to the clients which can see the blueprint: the clients of its workspace
+// which belong to its owner or an admin, or all clients of its workspace if it has no owner
+func notifyBlueprintEvent(hub *Hub, owners *ownerRegistry, event *blueprintEvent) {
+	hub.broadCastToWorkspace(owners.owner(event.Id), event.Workspace, Operator, event)
+}
+
+type workspaceInfo struct {
+	Name    string `json:"name"`
+	Default bool   `json:"default"`
+}
+
+// workspaceManager keeps the workspaces of a server. Each workspace is a directory below the root directory
+// and has its own writable backend, the read-only backends are shared with the default workspace.
+type workspaceManager struct {
+	mutex      *sync.RWMutex
+	root       string
+	base       *storage.Storage
+	workspaces map[string]*storage.Storage
+	// Writable backends of the named workspaces
+	backends map[string]*storage.WritableFileSystem
+
+	// Set while watching, changes are reported to notify
+	notify       func(workspace string, change storage.Change)
+	stopWatching map[string]context.CancelFunc
+}
+
+type watchable interface {
+	Watch(ctx context.Context) (<-chan storage.Change, error)
+}
+
+func newWorkspaceManager(base *storage.Storage) *workspaceManager {
+	return &workspaceManager{
+		mutex:        &sync.RWMutex{},
+		base:         base,
+		workspaces:   map[string]*storage.Storage{DefaultWorkspace: base},
+		backends:     make(map[string]*storage.WritableFileSystem),
+		stopWatching: make(map[string]context.CancelFunc),
+	}
+}
+
+// Load makes the directories below root available as workspaces, new workspaces are created there
+func (wm *workspaceManager) Load(root string) error {
+	if _, err := utils.EnsureDirExists(root); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.root = root
+	for _, entry := range entries {
+		if !entry.IsDir() || !workspaceNamePattern.MatchString(entry.Name()) || entry.Name() == DefaultWorkspace {
+			continue
+		}
+		wm.add(entry.Name())
+	}
+	return nil
+}
+
+// add makes the workspace available, the mutex has to be held
+func (wm *workspaceManager) add(name string) {
+	backend := storage.NewWritableFileSystem(filepath.Join(wm.root, name))
+	wm.backends[name] = backend
+	wm.workspaces[name] = wm.base.WithWritableBackend(backend)
+	if wm.notify != nil {
+		if err := wm.watch(name, backend); err != nil {
+			log.Printf("cannot watch workspace %s: %s", name, err)
+		}
+	}
+}
+
+// Watch reports the changes of the blueprints of all workspaces, also of those created later.
+// Changes of the library are reported for the default workspace.
+func (wm *workspaceManager) Watch(notify func(workspace string, change storage.Change)) error {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.notify = notify
+	if err := wm.watch(DefaultWorkspace, wm.base); err != nil {
+		return err
+	}
+	for name, backend := range wm.backends {
+		if err := wm.watch(name, backend); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch starts watching the workspace, the mutex has to be held
+func (wm *workspaceManager) watch(name string, w watchable) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := w.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	wm.stopWatching[name] = cancel
+
+	notify := wm.notify
+	go func() {
+		for change := range changes {
+			wm.reindex(name, change.Id)
+			notify(name, change)
+		}
+	}()
+	return nil
+}
+
+// reindex updates the indexes of the storages seeing the changed blueprint,
+// changes of the default workspace concern all workspaces as they share the library
+func (wm *workspaceManager) reindex(name string, opId uuid.UUID) {
+	wm.mutex.RLock()
+	defer wm.mutex.RUnlock()
+
+	for n, st := range wm.workspaces {
+		if name == DefaultWorkspace || n == name {
+			st.Reindex(opId)
+		}
+	}
+}
+
+func (wm *workspaceManager) Get(name string) (*storage.Storage, error) {
+	if name == "" {
+		name = DefaultWorkspace
+	}
+
+	wm.mutex.RLock()
+	defer wm.mutex.RUnlock()
+
+	if st, ok := wm.workspaces[name]; ok {
+		return st, nil
+	}
+	return nil, errUnknownWorkspace
+}
+
+func (wm *workspaceManager) List() []workspaceInfo {
+	wm.mutex.RLock()
+	defer wm.mutex.RUnlock()
+
+	infos := make([]workspaceInfo, 0, len(wm.workspaces))
+	for name := range wm.workspaces {
+		infos = append(infos, workspaceInfo{name, name == DefaultWorkspace})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (wm *workspaceManager) Create(name string) error {
+	if !workspaceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid workspace name: %s", name)
+	}
+
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	if wm.root == "" {
+		return errors.New("no directory for workspaces configured")
+	}
+	if _, ok := wm.workspaces[name]; ok {
+		return fmt.Errorf("workspace %s exists already", name)
+	}
+	if _, err := utils.EnsureDirExists(filepath.Join(wm.root, name)); err != nil {
+		return err
+	}
+	wm.add(name)
+	return nil
+}
+
+// Delete removes the workspace and all blueprints saved in it
+func (wm *workspaceManager) Delete(name string) error {
+	if name == DefaultWorkspace {
+		return errors.New("the default workspace cannot be deleted")
+	}
+
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	if _, ok := wm.workspaces[name]; !ok {
+		return errUnknownWorkspace
+	}
+	if cancel, ok := wm.stopWatching[name]; ok {
+		cancel()
+		delete(wm.stopWatching, name)
+	}
+	delete(wm.workspaces, name)
+	delete(wm.backends, name)
+	return os.RemoveAll(filepath.Join(wm.root, name))
+}
+
+// selectWorkspace replaces the storage of the request with the storage of the workspace it selects
+func selectWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(workspaceHeader)
+		if name == "" {
+			name = r.URL.Query().Get("workspace")
+		}
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		st, err := getWorkspaces(r).Get(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, &Error{Msg: fmt.Sprintf("%s: %s", err, name), Code: "E000X"})
+			return
+		}
+		ctx := context.WithValue(r.Context(), storageKey, st)
+		ctx = context.WithValue(ctx, workspaceKey, name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+var WorkspaceService = &Service{map[string]*Endpoint{
+	"/": {func(w http.ResponseWriter, r *http.Request) {
+		workspaces := getWorkspaces(r)
+		if r.Method == "GET" {
+			writeJSON(w, workspaces.List())
+		} else if r.Method == "POST" {
+			if !GetUser(r).Admin {
+				sendForbidden(w, "only admins can create workspaces")
+				return
+			}
+
+			var ws workspaceInfo
+			if err := json.NewDecoder(r.Body).Decode(&ws); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+			if err := workspaces.Create(ws.Name); err != nil {
+				sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+				return
+			}
+			sendSuccess(w, &responseOK{Data: workspaceInfo{Name: ws.Name}})
+		}
+	}},
+	"/{name}/": {func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !GetUser(r).Admin {
+			sendForbidden(w, "only admins can delete workspaces")
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		workspaces := getWorkspaces(r)
+		if _, err := workspaces.Get(name); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if getInstances(r).InWorkspace(name) {
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(w, &Error{Msg: "workspace has instances, remove them first", Code: "E000X"})
+			return
+		}
+		if getSchedules(r).InWorkspace(name) {
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(w, &Error{Msg: "workspace has schedules, remove them first", Code: "E000X"})
+			return
+		}
+		if err := workspaces.Delete(name); err != nil {
+			sendFailure(w, &responseBad{&Error{Msg: err.Error(), Code: "E000X"}})
+			return
+		}
+		sendSuccess(w, nil)
+	}},
+}}
@@ -182,3 +182,54 @@ func Test_HTTP__Response404(t *testing.T) {
 	}
 	a.Fail("no response")
 }
+
+func Test_HTTP__ConcurrentRequests(t *testing.T) {
+	a := assertions.New(t)
+
+	o, err := buildOperator(
+		core.InstanceDef{
+			Operator: netHTTPServerId,
+		},
+	)
+	require.NoError(t, err)
+
+	o.Main().Out().Bufferize()
+	handler := o.Delegate("handler")
+	handler.Out().Bufferize()
+
+	o.Start()
+	defer o.Stop()
+	o.Main().In().Push(9441)
+
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		handler.In().Push(map[string]interface{}{"status": 200, "headers": []interface{}{}, "body": core.Binary("hallo slang!")})
+	}
+
+	statuses := make(chan int, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				resp, err := http.Get("http://127.0.0.1:9441/concurrent")
+				if err != nil {
+					time.Sleep(20 * time.Millisecond)
+					continue
+				}
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+				return
+			}
+			statuses <- 0
+		}()
+	}
+
+	for i := 0; i < requests; i++ {
+		select {
+		case status := <-statuses:
+			a.Equal(200, status)
+		case <-time.After(5 * time.Second):
+			a.Fail("concurrent requests are blocked")
+			return
+		}
+	}
+}
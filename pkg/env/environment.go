@@ -22,6 +22,10 @@ type Environment struct {
 	SLANG_LIB_REPO_PATH string
 	SLANG_LIB           string
 	SLANG_UI            string
+	// Installed packages, see package packages
+	SLANG_PACKAGES string
+	// Package archives packages are installed from
+	SLANG_REGISTRY string
 
 	HTTP httpCfg
 }
@@ -48,6 +52,8 @@ func New(addr string, port int) *Environment {
 		ensureEnvironVar("SLANG_LIB_REPO_PATH", filepath.Join(slangPath, "lib")),
 		ensureEnvironVar("SLANG_LIB", filepath.Join(slangPath, "lib", "slang")),
 		ensureEnvironVar("SLANG_UI", filepath.Join(slangPath, "ui")),
+		ensureEnvironVar("SLANG_PACKAGES", filepath.Join(slangPath, "packages")),
+		ensureEnvironVar("SLANG_REGISTRY", filepath.Join(slangPath, "registry")),
 		httpCfg{Address: addr, Port: port},
 	}
 
@@ -62,6 +68,9 @@ func New(addr string, port int) *Environment {
 	if _, err = utils.EnsureDirExists(e.SLANG_UI); err != nil {
 		log.Fatal(err)
 	}
+	if _, err = utils.EnsureDirExists(e.SLANG_PACKAGES); err != nil {
+		log.Fatal(err)
+	}
 
 	return e
 }
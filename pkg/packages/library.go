@@ -0,0 +1,306 @@
+package packages
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/pkg/utils"
+)
+
+// Registry is a directory of package archives packages are installed from, so it works offline
+type Registry struct {
+	dir string
+}
+
+// available is a package of the registry
+type available struct {
+	manifest *Manifest
+	file     string
+}
+
+func NewRegistry(dir string) *Registry {
+	return &Registry{dir}
+}
+
+// Packages returns the manifests of all archives in the registry, broken archives are left out
+func (reg *Registry) Packages() ([]*Manifest, error) {
+	all, err := reg.available()
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]*Manifest, 0, len(all))
+	for _, a := range all {
+		manifests = append(manifests, a.manifest)
+	}
+	return manifests, nil
+}
+
+func (reg *Registry) available() ([]available, error) {
+	infos, err := ioutil.ReadDir(reg.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	all := make([]available, 0)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".zip") {
+			continue
+		}
+		file := filepath.Join(reg.dir, info.Name())
+		m, err := ReadArchive(file)
+		if err != nil {
+			continue
+		}
+		all = append(all, available{m, file})
+	}
+	sortManifests(all)
+	return all, nil
+}
+
+// find returns the newest version of the package matching the constraint
+func (reg *Registry) find(name string, constraint string) (*available, error) {
+	cs, err := parseConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint for %s: %s", name, constraint)
+	}
+	all, err := reg.available()
+	if err != nil {
+		return nil, err
+	}
+	var best *available
+	for i, a := range all {
+		if a.manifest.Name == name && cs.Check(a.manifest.version()) {
+			best = &all[i]
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no version of package %s matching %q in %s", name, constraint, reg.dir)
+	}
+	return best, nil
+}
+
+// Library is the directory packages are installed to, each package in a directory of its name
+type Library struct {
+	dir string
+}
+
+func NewLibrary(dir string) *Library {
+	return &Library{dir}
+}
+
+// Installed returns the manifests of the installed packages sorted by name
+func (lib *Library) Installed() ([]*Manifest, error) {
+	infos, err := ioutil.ReadDir(lib.dir)
+	if os.IsNotExist(err) {
+		return []*Manifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	manifests := make([]*Manifest, 0)
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		m, err := readManifest(filepath.Join(lib.dir, info.Name(), ManifestFile))
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// Backends returns a read-only backend for each installed package
+func (lib *Library) Backends() ([]storage.Backend, error) {
+	installed, err := lib.Installed()
+	if err != nil {
+		return nil, err
+	}
+	backends := make([]storage.Backend, 0, len(installed))
+	for _, m := range installed {
+		backends = append(backends, storage.NewReadOnlyFileSystem(filepath.Join(lib.dir, m.Name, BlueprintDir)))
+	}
+	return backends, nil
+}
+
+func (lib *Library) installedByName() (map[string]*Manifest, error) {
+	installed, err := lib.Installed()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Manifest)
+	for _, m := range installed {
+		byName[m.Name] = m
+	}
+	return byName, nil
+}
+
+// Install installs the newest version of the package matching the constraint from the registry, together
+// with the packages it depends on. Installed packages are kept if they match the constraints, otherwise
+// they are replaced. The installed packages are returned.
+func (lib *Library) Install(reg *Registry, name string, constraint string) ([]*Manifest, error) {
+	root, err := reg.find(name, constraint)
+	if err != nil {
+		return nil, err
+	}
+	return lib.install(reg, root)
+}
+
+// InstallArchive installs the package archive, the packages it depends on are installed from the registry
+func (lib *Library) InstallArchive(reg *Registry, file string) ([]*Manifest, error) {
+	m, err := ReadArchive(file)
+	if err != nil {
+		return nil, err
+	}
+	return lib.install(reg, &available{m, file})
+}
+
+func (lib *Library) install(reg *Registry, root *available) ([]*Manifest, error) {
+	installed, err := lib.installedByName()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := map[string]*available{root.manifest.Name: root}
+	var resolve func(m *Manifest) error
+	resolve = func(m *Manifest) error {
+		for _, dep := range sortedKeys(m.Dependencies) {
+			constraint := m.Dependencies[dep]
+			cs, _ := parseConstraint(constraint)
+			if planned, ok := plan[dep]; ok {
+				if !cs.Check(planned.manifest.version()) {
+					return fmt.Errorf("%s requires %s %s but %s is needed", m, dep, constraint, planned.manifest)
+				}
+				continue
+			}
+			if current, ok := installed[dep]; ok && cs.Check(current.version()) {
+				continue
+			}
+			a, err := reg.find(dep, constraint)
+			if err != nil {
+				return fmt.Errorf("%s: %s", m, err)
+			}
+			plan[dep] = a
+			if err := resolve(a.manifest); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := resolve(root.manifest); err != nil {
+		return nil, err
+	}
+
+	// All packages, planned or staying installed, must still find what they depend on. Installed packages
+	// satisfying a dependency when it was resolved may be replaced for the dependency of another package.
+	final := make(map[string]*Manifest)
+	for name, m := range installed {
+		final[name] = m
+	}
+	for name, a := range plan {
+		final[name] = a.manifest
+	}
+	for _, name := range sortedKeys(final) {
+		m := final[name]
+		for _, dep := range sortedKeys(m.Dependencies) {
+			constraint := m.Dependencies[dep]
+			cs, _ := parseConstraint(constraint)
+			if d, ok := final[dep]; ok && !cs.Check(d.version()) {
+				return nil, fmt.Errorf("%s requires %s %s but %s is needed", m, dep, constraint, d)
+			}
+		}
+	}
+
+	result := make([]*Manifest, 0, len(plan))
+	for _, name := range sortedKeys(plan) {
+		if err := lib.unpack(plan[name]); err != nil {
+			return result, err
+		}
+		result = append(result, plan[name].manifest)
+	}
+	return result, nil
+}
+
+// unpack extracts and verifies the package next to its installed version, which is only replaced if
+// the new version is fine
+func (lib *Library) unpack(a *available) error {
+	if _, err := utils.EnsureDirExists(lib.dir); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(lib.dir, ".install-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extract(a.file, tmp); err != nil {
+		return err
+	}
+	m, err := readManifest(filepath.Join(tmp, ManifestFile))
+	if err != nil {
+		return err
+	}
+	if err := verify(tmp, m); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(lib.dir, m.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// Remove uninstalls the package. Unless forced, packages other installed packages depend on are kept.
+func (lib *Library) Remove(name string, force bool) error {
+	installed, err := lib.installedByName()
+	if err != nil {
+		return err
+	}
+	if _, ok := installed[name]; !ok {
+		return fmt.Errorf("package %s is not installed", name)
+	}
+	if !force {
+		for _, m := range installed {
+			if _, ok := m.Dependencies[name]; ok {
+				return fmt.Errorf("package %s is required by %s", name, m)
+			}
+		}
+	}
+	return os.RemoveAll(filepath.Join(lib.dir, name))
+}
+
+func sortManifests(all []available) {
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].manifest.Name != all[j].manifest.Name {
+			return all[i].manifest.Name < all[j].manifest.Name
+		}
+		return all[i].manifest.version().LessThan(all[j].manifest.version())
+	})
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*available:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*Manifest:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
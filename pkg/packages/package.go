@@ -0,0 +1,295 @@
+package packages
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Bitspark/go-version"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestFile describes a package, it is found next to the directory BlueprintDir holding the blueprints
+const ManifestFile = "slang-package.yaml"
+
+const BlueprintDir = "blueprints"
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Manifest describes a package of blueprints. Dependencies map the names of other packages to version
+// constraints such as ">= 1.2, < 2". The checksum covers all blueprint files.
+type Manifest struct {
+	Name         string            `yaml:"name" json:"name"`
+	Version      string            `yaml:"version" json:"version"`
+	Description  string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Dependencies map[string]string `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	Blueprints   []string          `yaml:"blueprints" json:"blueprints"`
+	Checksum     string            `yaml:"checksum" json:"checksum"`
+}
+
+func (m *Manifest) Validate() error {
+	if !namePattern.MatchString(m.Name) {
+		return fmt.Errorf("invalid package name: %s", m.Name)
+	}
+	if _, err := version.NewVersion(m.Version); err != nil {
+		return fmt.Errorf("package %s: invalid version: %s", m.Name, m.Version)
+	}
+	for name, constraint := range m.Dependencies {
+		if _, err := parseConstraint(constraint); err != nil {
+			return fmt.Errorf("package %s: invalid constraint for %s: %s", m.Name, name, constraint)
+		}
+	}
+	for _, id := range m.Blueprints {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("package %s: invalid blueprint id: %s", m.Name, id)
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) version() *version.Version {
+	v, _ := version.NewVersion(m.Version)
+	return v
+}
+
+func (m *Manifest) String() string {
+	return m.Name + "@" + m.Version
+}
+
+// parseConstraint parses a version constraint, an empty constraint allows all versions
+func parseConstraint(constraint string) (version.Constraints, error) {
+	if strings.TrimSpace(constraint) == "" {
+		constraint = ">= 0"
+	}
+	return version.NewConstraint(constraint)
+}
+
+func readManifest(file string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(b)
+}
+
+func parseManifest(b []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// blueprintFiles returns the sorted names of the blueprint files in the directory
+func blueprintFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		if utils.IsYAML(info.Name()) || utils.IsJSON(info.Name()) {
+			files = append(files, info.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// checksum hashes names and contents of the blueprint files in the directory
+func checksum(dir string) (string, error) {
+	files, err := blueprintFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(file + "\x00"))
+		h.Write(content)
+		h.Write([]byte("\x00"))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verify checks that the blueprints of the package directory are the ones described by its manifest
+func verify(dir string, m *Manifest) error {
+	sum, err := checksum(filepath.Join(dir, BlueprintDir))
+	if err != nil {
+		return err
+	}
+	if sum != m.Checksum {
+		return fmt.Errorf("package %s: checksum mismatch", m)
+	}
+
+	fs := storage.NewReadOnlyFileSystem(filepath.Join(dir, BlueprintDir))
+	for _, id := range m.Blueprints {
+		if !fs.Has(uuid.MustParse(id)) {
+			return fmt.Errorf("package %s: blueprint %s is missing", m, id)
+		}
+	}
+	return nil
+}
+
+// Pack creates the package archive NAME-VERSION.zip in the output directory from the package directory,
+// which holds the manifest and the blueprints in BlueprintDir. Blueprints and checksum of the manifest are
+// filled in.
+func Pack(dir string, outDir string) (*Manifest, string, error) {
+	m, err := readManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids, err := storage.NewReadOnlyFileSystem(filepath.Join(dir, BlueprintDir)).List()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(ids) == 0 {
+		return nil, "", fmt.Errorf("package %s has no blueprints", m)
+	}
+	m.Blueprints = make([]string, 0, len(ids))
+	for _, id := range ids {
+		m.Blueprints = append(m.Blueprints, id.String())
+	}
+	sort.Strings(m.Blueprints)
+	if m.Checksum, err = checksum(filepath.Join(dir, BlueprintDir)); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := utils.EnsureDirExists(outDir); err != nil {
+		return nil, "", err
+	}
+	file := filepath.Join(outDir, archiveName(m))
+	out, err := os.Create(file)
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	mb, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := writeZipFile(w, ManifestFile, mb); err != nil {
+		return nil, "", err
+	}
+	files, err := blueprintFiles(filepath.Join(dir, BlueprintDir))
+	if err != nil {
+		return nil, "", err
+	}
+	for _, f := range files {
+		content, err := ioutil.ReadFile(filepath.Join(dir, BlueprintDir, f))
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeZipFile(w, BlueprintDir+"/"+f, content); err != nil {
+			return nil, "", err
+		}
+	}
+	return m, file, w.Close()
+}
+
+func archiveName(m *Manifest) string {
+	return m.Name + "-" + m.Version + ".zip"
+}
+
+func writeZipFile(w *zip.Writer, name string, content []byte) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+// ReadArchive reads the manifest of the package archive
+func ReadArchive(file string) (*Manifest, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name != ManifestFile {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return parseManifest(b)
+	}
+	return nil, fmt.Errorf("%s: %s is missing", file, ManifestFile)
+}
+
+// extract unpacks the package archive into the directory
+func extract(file string, dir string) error {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		name := filepath.Clean(filepath.FromSlash(f.Name))
+		if name != ManifestFile && filepath.Dir(name) != BlueprintDir {
+			return fmt.Errorf("%s: unexpected file %s", file, f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := extractFile(f, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	if _, err := utils.EnsureDirExists(filepath.Join(dir, BlueprintDir)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, path string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := utils.EnsureDirExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, rc)
+	return err
+}
@@ -0,0 +1,130 @@
+package packages
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+)
+
+// writePackage creates a package directory with one blueprint and packs it into the registry
+func writePackage(a *assertions.SlAssertions, root string, registry string, manifest string) uuid.UUID {
+	dir, err := ioutil.TempDir(root, "src")
+	a.NoError(err)
+	a.NoError(os.MkdirAll(filepath.Join(dir, BlueprintDir), os.ModePerm))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, ManifestFile), []byte(manifest), os.ModePerm))
+
+	bp := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Packaged"}}
+	b, err := json.Marshal(&bp)
+	a.NoError(err)
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, BlueprintDir, bp.Id.String()+".json"), b, os.ModePerm))
+
+	_, _, err = Pack(dir, registry)
+	a.NoError(err)
+	return bp.Id
+}
+
+func TestLibrary_Install_Remove(t *testing.T) {
+	a := assertions.New(t)
+	root, err := ioutil.TempDir("", "slang-packages")
+	a.NoError(err)
+	defer os.RemoveAll(root)
+	registry := filepath.Join(root, "registry")
+	reg := NewRegistry(registry)
+	lib := NewLibrary(filepath.Join(root, "packages"))
+
+	writePackage(a, root, registry, "name: base\nversion: 1.0.0\n")
+	baseId := writePackage(a, root, registry, "name: base\nversion: 1.4.0\n")
+	writePackage(a, root, registry, "name: base\nversion: 2.0.0\n")
+	writePackage(a, root, registry, "name: math\nversion: 0.1.0\ndependencies:\n  base: '>= 1.2, < 2'\n")
+	available, err := reg.Packages()
+	a.NoError(err)
+	a.Len(available, 4)
+
+	installed, err := lib.Install(reg, "math", "")
+	a.NoError(err)
+	a.Len(installed, 2)
+	a.Equal("base@1.4.0", installed[0].String())
+
+	backends, err := lib.Backends()
+	a.NoError(err)
+	st := storage.NewStorage()
+	for _, b := range backends {
+		st.AddBackend(b)
+	}
+	_, err = st.Load(baseId)
+	a.NoError(err)
+
+	// Other packages still need base below 2
+	_, err = lib.Install(reg, "base", ">= 2")
+	a.Error(err)
+	_, err = lib.Install(reg, "unknown", "")
+	a.Error(err)
+
+	a.Error(lib.Remove("base", false))
+	a.NoError(lib.Remove("math", false))
+	a.NoError(lib.Remove("base", false))
+	installed, err = lib.Installed()
+	a.NoError(err)
+	a.Empty(installed)
+}
+
+func TestLibrary_Install__InstalledDependencyReplaced(t *testing.T) {
+	a := assertions.New(t)
+	root, err := ioutil.TempDir("", "slang-packages")
+	a.NoError(err)
+	defer os.RemoveAll(root)
+	registry := filepath.Join(root, "registry")
+	reg := NewRegistry(registry)
+	lib := NewLibrary(filepath.Join(root, "packages"))
+
+	writePackage(a, root, registry, "name: base\nversion: 1.0.0\n")
+	writePackage(a, root, registry, "name: base\nversion: 2.0.0\n")
+	writePackage(a, root, registry, "name: charts\nversion: 1.0.0\ndependencies:\n  base: '>= 2'\n")
+	writePackage(a, root, registry, "name: app\nversion: 1.0.0\ndependencies:\n  base: '< 2'\n  charts: '1.0.0'\n")
+
+	_, err = lib.Install(reg, "base", "1.0.0")
+	a.NoError(err)
+
+	// base 1.0.0 satisfies app, but charts would replace it with base 2.0.0
+	_, err = lib.Install(reg, "app", "")
+	a.Error(err)
+	a.Contains(err.Error(), "app@1.0.0 requires base")
+	installed, err := lib.Installed()
+	a.NoError(err)
+	a.Len(installed, 1)
+	a.Equal("base@1.0.0", installed[0].String())
+}
+
+func TestLibrary_Install__ChecksumMismatch(t *testing.T) {
+	a := assertions.New(t)
+	root, err := ioutil.TempDir("", "slang-packages")
+	a.NoError(err)
+	defer os.RemoveAll(root)
+	registry := filepath.Join(root, "registry")
+
+	writePackage(a, root, registry, "name: base\nversion: 1.0.0\n")
+	// Tamper with the manifest of the archive
+	file := filepath.Join(registry, "base-1.0.0.zip")
+	m, err := ReadArchive(file)
+	a.NoError(err)
+	a.Len(m.Blueprints, 1)
+	dir := filepath.Join(root, "tampered")
+	a.NoError(extract(file, dir))
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, BlueprintDir, "extra.yaml"), []byte("id: x"), os.ModePerm))
+	a.Error(verify(dir, m))
+}
+
+func TestManifest_Validate(t *testing.T) {
+	a := assertions.New(t)
+	a.NoError((&Manifest{Name: "math", Version: "1.0.0", Dependencies: map[string]string{"base": "~> 1.2"}}).Validate())
+	a.Error((&Manifest{Name: "Math Lib", Version: "1.0.0"}).Validate())
+	a.Error((&Manifest{Name: "math", Version: "one"}).Validate())
+	a.Error((&Manifest{Name: "math", Version: "1.0.0", Dependencies: map[string]string{"base": "about 1"}}).Validate())
+}
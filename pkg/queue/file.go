@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileMessageExt    = ".json"
+	fileProcessingExt = ".processing"
+)
+
+var FilePollInterval = 100 * time.Millisecond
+
+// FileQueue stores each message as file in a directory, it is meant for local testing.
+// A received message is renamed until it is acknowledged, messages not acknowledged
+// are delivered again after the queue has been opened again.
+type FileQueue struct {
+	dir     string
+	mutex   *sync.Mutex
+	counter int64
+	closed  chan bool
+}
+
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file: missing directory")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	fq := &FileQueue{dir: dir, mutex: &sync.Mutex{}, closed: make(chan bool)}
+	if err := fq.restore(); err != nil {
+		return nil, err
+	}
+	return fq, nil
+}
+
+// restore makes messages which have been received but not acknowledged available again
+func (fq *FileQueue) restore() error {
+	files, err := filepath.Glob(filepath.Join(fq.dir, "*"+fileProcessingExt))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Rename(file, strings.TrimSuffix(file, fileProcessingExt)+fileMessageExt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fq *FileQueue) Publish(data []byte) error {
+	fq.mutex.Lock()
+	fq.counter++
+	name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), fq.counter%1000000)
+	fq.mutex.Unlock()
+
+	// Write to a hidden file first so that consumers never see partial messages
+	tmpFile := filepath.Join(fq.dir, "."+name+".tmp")
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(fq.dir, name+fileMessageExt))
+}
+
+func (fq *FileQueue) Receive() (*Message, error) {
+	for {
+		select {
+		case <-fq.closed:
+			return nil, ErrClosed
+		default:
+		}
+
+		files, err := filepath.Glob(filepath.Join(fq.dir, "*"+fileMessageExt))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			processingFile := strings.TrimSuffix(file, fileMessageExt) + fileProcessingExt
+			if err := os.Rename(file, processingFile); err != nil {
+				// Another consumer has been faster
+				continue
+			}
+
+			data, err := ioutil.ReadFile(processingFile)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Message{data, func() error {
+				return os.Remove(processingFile)
+			}}, nil
+		}
+
+		select {
+		case <-fq.closed:
+			return nil, ErrClosed
+		case <-time.After(FilePollInterval):
+		}
+	}
+}
+
+func (fq *FileQueue) Close() error {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	select {
+	case <-fq.closed:
+	default:
+		close(fq.closed)
+	}
+	return nil
+}
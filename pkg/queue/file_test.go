@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileQueue(t *testing.T) (*FileQueue, string) {
+	dir, err := ioutil.TempDir("", "slang-queue")
+	require.NoError(t, err)
+	fq, err := NewFileQueue(dir)
+	require.NoError(t, err)
+	return fq, dir
+}
+
+func TestFileQueue__InOrder(t *testing.T) {
+	a := assertions.New(t)
+	fq, dir := newTestFileQueue(t)
+	defer os.RemoveAll(dir)
+	defer fq.Close()
+
+	for _, data := range []string{"1", "2", "3"} {
+		a.NoError(fq.Publish([]byte(data)))
+	}
+
+	for _, data := range []string{"1", "2", "3"} {
+		m, err := fq.Receive()
+		a.NoError(err)
+		a.Equal(data, string(m.Data))
+		a.NoError(m.Ack())
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	a.Len(files, 0)
+}
+
+func TestFileQueue__RedeliverUnacknowledged(t *testing.T) {
+	a := assertions.New(t)
+	fq, dir := newTestFileQueue(t)
+	defer os.RemoveAll(dir)
+
+	a.NoError(fq.Publish([]byte(`{"a":1}`)))
+	m, err := fq.Receive()
+	a.NoError(err)
+	a.Equal(`{"a":1}`, string(m.Data))
+	fq.Close()
+
+	fq, err = NewFileQueue(dir)
+	a.NoError(err)
+	defer fq.Close()
+
+	m, err = fq.Receive()
+	a.NoError(err)
+	a.Equal(`{"a":1}`, string(m.Data))
+}
+
+func TestFileQueue__Close(t *testing.T) {
+	a := assertions.New(t)
+	fq, dir := newTestFileQueue(t)
+	defer os.RemoveAll(dir)
+
+	fq.Close()
+	_, err := fq.Receive()
+	a.Equal(ErrClosed, err)
+}
+
+func TestOpenConsumer__UnsupportedQueue(t *testing.T) {
+	a := assertions.New(t)
+	_, err := OpenConsumer("amqp://localhost/jobs")
+	a.Error(err)
+	_, err = OpenProducer("redis://localhost:6379")
+	a.Error(err)
+}
@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+const kafkaDefaultGroup = "slang"
+
+// kafkaConsumer consumes a topic as member of a consumer group,
+// the offset of a message is committed after it has been acknowledged
+type kafkaConsumer struct {
+	group    sarama.ConsumerGroup
+	messages chan *Message
+	cancel   context.CancelFunc
+	// closed is closed when consuming has ended, err tells why
+	closed chan bool
+	err    error
+}
+
+func newKafkaConsumer(u *url.URL) (*kafkaConsumer, error) {
+	topic, err := queueName(u)
+	if err != nil {
+		return nil, err
+	}
+
+	groupId := u.Query().Get("group")
+	if groupId == "" {
+		groupId = kafkaDefaultGroup
+	}
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_10_2_0
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	group, err := sarama.NewConsumerGroup(strings.Split(u.Host, ","), groupId, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return consumeKafkaGroup(group, topic), nil
+}
+
+func consumeKafkaGroup(group sarama.ConsumerGroup, topic string) *kafkaConsumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	kc := &kafkaConsumer{group: group, messages: make(chan *Message), cancel: cancel, closed: make(chan bool)}
+
+	go func() {
+		defer close(kc.closed)
+		// Consume returns whenever the group is rebalanced
+		for ctx.Err() == nil {
+			if err := group.Consume(ctx, []string{topic}, kc); err != nil {
+				kc.err = err
+				return
+			}
+		}
+		kc.err = ErrClosed
+	}()
+
+	return kc
+}
+
+func (kc *kafkaConsumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (kc *kafkaConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (kc *kafkaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		msg := msg
+		m := &Message{msg.Value, func() error {
+			session.MarkMessage(msg, "")
+			return nil
+		}}
+
+		select {
+		case kc.messages <- m:
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (kc *kafkaConsumer) Receive() (*Message, error) {
+	select {
+	case m := <-kc.messages:
+		return m, nil
+	case <-kc.closed:
+		return nil, kc.err
+	}
+}
+
+func (kc *kafkaConsumer) Close() error {
+	kc.cancel()
+	return kc.group.Close()
+}
+
+type kafkaProducer struct {
+	topic    string
+	producer sarama.SyncProducer
+}
+
+func newKafkaProducer(u *url.URL) (*kafkaProducer, error) {
+	topic, err := queueName(u)
+	if err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(strings.Split(u.Host, ","), config)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaProducer{topic, producer}, nil
+}
+
+func (kp *kafkaProducer) Publish(data []byte) error {
+	_, _, err := kp.producer.SendMessage(&sarama.ProducerMessage{Topic: kp.topic, Value: sarama.ByteEncoder(data)})
+	return err
+}
+
+func (kp *kafkaProducer) Close() error {
+	return kp.producer.Close()
+}
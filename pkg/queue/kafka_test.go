@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/Shopify/sarama"
+)
+
+// fakeConsumerGroup consumes until the context is done or fails with err
+type fakeConsumerGroup struct {
+	sarama.ConsumerGroup
+	err error
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if g.err != nil {
+		return g.err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (g *fakeConsumerGroup) Close() error {
+	return nil
+}
+
+func receiveWithin(t *testing.T, c Consumer) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Receive()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("receive is blocked")
+		return nil
+	}
+}
+
+func TestKafkaConsumer__Close(t *testing.T) {
+	a := assertions.New(t)
+	kc := consumeKafkaGroup(&fakeConsumerGroup{}, "topic")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		kc.Close()
+	}()
+	a.Equal(ErrClosed, receiveWithin(t, kc))
+	a.Equal(ErrClosed, receiveWithin(t, kc))
+}
+
+func TestKafkaConsumer__ConsumeError(t *testing.T) {
+	a := assertions.New(t)
+	failure := errors.New("broker unavailable")
+	kc := consumeKafkaGroup(&fakeConsumerGroup{err: failure}, "topic")
+	defer kc.Close()
+
+	a.Equal(failure, receiveWithin(t, kc))
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+const mqttDefaultQoS = 1
+
+func newMQTTClient(u *url.URL, autoAck bool) (mqtt.Client, string, byte, error) {
+	topic, err := queueName(u)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	qos := mqttDefaultQoS
+	if qosStr := u.Query().Get("qos"); qosStr != "" {
+		if qos, err = strconv.Atoi(qosStr); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	options := mqtt.NewClientOptions()
+	options.AddBroker("tcp://" + u.Host)
+	if u.User != nil {
+		options.SetUsername(u.User.Username())
+		password, _ := u.User.Password()
+		options.SetPassword(password)
+	}
+	if clientId := u.Query().Get("clientId"); clientId != "" {
+		// Unacknowledged messages are only delivered again to the same persistent session
+		options.SetClientID(clientId)
+		options.SetCleanSession(false)
+	}
+	options.SetAutoAckDisabled(!autoAck)
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return nil, "", 0, err
+	}
+	return client, topic, byte(qos), nil
+}
+
+type mqttConsumer struct {
+	client   mqtt.Client
+	messages chan *Message
+	closed   chan bool
+}
+
+func newMQTTConsumer(u *url.URL) (*mqttConsumer, error) {
+	client, topic, qos, err := newMQTTClient(u, false)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := &mqttConsumer{client, make(chan *Message), make(chan bool)}
+	token := client.Subscribe(topic, qos, func(client mqtt.Client, msg mqtt.Message) {
+		m := &Message{msg.Payload(), func() error {
+			msg.Ack()
+			return nil
+		}}
+		select {
+		case mc.messages <- m:
+		case <-mc.closed:
+		}
+	})
+	token.Wait()
+	if err := token.Error(); err != nil {
+		client.Disconnect(0)
+		return nil, err
+	}
+	return mc, nil
+}
+
+func (mc *mqttConsumer) Receive() (*Message, error) {
+	select {
+	case m := <-mc.messages:
+		return m, nil
+	case <-mc.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (mc *mqttConsumer) Close() error {
+	close(mc.closed)
+	mc.client.Disconnect(250)
+	return nil
+}
+
+type mqttProducer struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+}
+
+func newMQTTProducer(u *url.URL) (*mqttProducer, error) {
+	client, topic, qos, err := newMQTTClient(u, true)
+	if err != nil {
+		return nil, err
+	}
+	return &mqttProducer{client, topic, qos}, nil
+}
+
+func (mp *mqttProducer) Publish(data []byte) error {
+	token := mp.client.Publish(mp.topic, mp.qos, false, data)
+	token.Wait()
+	return token.Error()
+}
+
+func (mp *mqttProducer) Close() error {
+	mp.client.Disconnect(250)
+	return nil
+}
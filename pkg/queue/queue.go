@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+var ErrClosed = errors.New("queue has been closed")
+
+// Message is an item received from a queue. It is delivered again unless it is acknowledged.
+type Message struct {
+	Data []byte
+	ack  func() error
+}
+
+// Ack confirms that the message has been processed and must not be delivered again
+func (m *Message) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+type Consumer interface {
+	// Receive blocks until the next message is available
+	Receive() (*Message, error)
+	Close() error
+}
+
+type Producer interface {
+	Publish(data []byte) error
+	Close() error
+}
+
+// OpenConsumer connects to the queue described by the URL. Supported are
+//
+//	file:///path/to/dir
+//	kafka://broker1:9092,broker2:9092/topic?group=name
+//	redis://host:6379/list?db=0&password=secret
+//	mqtt://host:1883/some/topic?qos=1&clientId=name
+func OpenConsumer(rawURL string) (Consumer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileQueue(u.Path)
+	case "kafka":
+		return newKafkaConsumer(u)
+	case "redis":
+		return newRedisConsumer(u)
+	case "mqtt":
+		return newMQTTConsumer(u)
+	}
+	return nil, fmt.Errorf("unsupported queue: %s", u.Scheme)
+}
+
+// OpenProducer connects to the queue described by the URL, see OpenConsumer for the supported queues
+func OpenProducer(rawURL string) (Producer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileQueue(u.Path)
+	case "kafka":
+		return newKafkaProducer(u)
+	case "redis":
+		return newRedisProducer(u)
+	case "mqtt":
+		return newMQTTProducer(u)
+	}
+	return nil, fmt.Errorf("unsupported queue: %s", u.Scheme)
+}
+
+func queueName(u *url.URL) (string, error) {
+	if len(u.Path) <= 1 {
+		return "", fmt.Errorf("%s: missing queue name", u.Scheme)
+	}
+	return u.Path[1:], nil
+}
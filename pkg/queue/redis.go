@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/go-redis/redis"
+)
+
+const redisProcessingSuffix = ":processing"
+
+// redisRestoreScript moves all messages of the processing list KEYS[1] back to the right end of the list KEYS[2],
+// the oldest message ends up rightmost and is received first. It returns the number of messages moved.
+var redisRestoreScript = redis.NewScript(`
+local n = 0
+while true do
+	local value = redis.call('LPOP', KEYS[1])
+	if not value then
+		return n
+	end
+	redis.call('RPUSH', KEYS[2], value)
+	n = n + 1
+end
+`)
+
+func newRedisClient(u *url.URL) (*redis.Client, string, error) {
+	list, err := queueName(u)
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := 0
+	if dbStr := u.Query().Get("db"); dbStr != "" {
+		if db, err = strconv.Atoi(dbStr); err != nil {
+			return nil, "", err
+		}
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     u.Host,
+		Password: u.Query().Get("password"),
+		DB:       db,
+	})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, "", err
+	}
+	return client, list, nil
+}
+
+// redisConsumer pops messages from the right of a list and keeps them in a processing list until they are
+// acknowledged. Messages remaining in the processing list have not been processed completely, they are moved back
+// to the list when a consumer is opened. Consumers of the same list should therefore not run at the same time,
+// otherwise messages in process by another consumer are delivered again.
+type redisConsumer struct {
+	client     *redis.Client
+	list       string
+	processing string
+}
+
+func newRedisConsumer(u *url.URL) (*redisConsumer, error) {
+	client, list, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConsumer{client, list, list + redisProcessingSuffix}
+	if err := rc.restore(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// restore makes messages which have been received but not acknowledged available again
+func (rc *redisConsumer) restore() error {
+	return redisRestoreScript.Run(rc.client, []string{rc.processing, rc.list}).Err()
+}
+
+func (rc *redisConsumer) Receive() (*Message, error) {
+	value, err := rc.client.BRPopLPush(rc.list, rc.processing, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &Message{[]byte(value), func() error {
+		return rc.client.LRem(rc.processing, 1, value).Err()
+	}}, nil
+}
+
+func (rc *redisConsumer) Close() error {
+	return rc.client.Close()
+}
+
+type redisProducer struct {
+	client *redis.Client
+	list   string
+}
+
+func newRedisProducer(u *url.URL) (*redisProducer, error) {
+	client, list, err := newRedisClient(u)
+	if err != nil {
+		return nil, err
+	}
+	return &redisProducer{client, list}, nil
+}
+
+func (rp *redisProducer) Publish(data []byte) error {
+	return rp.client.LPush(rp.list, data).Err()
+}
+
+func (rp *redisProducer) Close() error {
+	return rp.client.Close()
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Precedence decides which backend a blueprint is loaded from if several backends have it
+type Precedence string
+
+const (
+	// PrecedenceOrder prefers the backend added first
+	PrecedenceOrder Precedence = "order"
+	// PrecedenceLocal prefers writable backends, such as the project directory
+	PrecedenceLocal Precedence = "local"
+	// PrecedenceLibrary prefers read-only backends, such as the library
+	PrecedenceLibrary Precedence = "library"
+)
+
+func ParsePrecedence(s string) (Precedence, error) {
+	switch p := Precedence(s); p {
+	case PrecedenceOrder, PrecedenceLocal, PrecedenceLibrary:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown precedence: %s", s)
+}
+
+// ConflictVersion is one of the versions of a conflicting blueprint
+type ConflictVersion struct {
+	Backend  string `json:"backend"`
+	Writable bool   `json:"writable"`
+	Name     string `json:"name"`
+	// Whether the blueprint is loaded from this backend
+	Selected bool `json:"selected"`
+}
+
+// Conflict is a blueprint which several backends have with different content
+type Conflict struct {
+	Id       uuid.UUID         `json:"id"`
+	Versions []ConflictVersion `json:"versions"`
+}
+
+// SetPrecedence changes which backend blueprints held by several backends are loaded from
+func (s *Storage) SetPrecedence(precedence Precedence) *Storage {
+	s.precedence = precedence
+	s.Invalidate()
+	return s
+}
+
+func (s *Storage) Precedence() Precedence {
+	return s.precedence
+}
+
+// orderedBackends returns the backends in the order of the precedence
+func (s *Storage) orderedBackends() []Backend {
+	if s.precedence != PrecedenceLocal && s.precedence != PrecedenceLibrary {
+		return s.backends
+	}
+	writableFirst := s.precedence == PrecedenceLocal
+	first := s.selectBackends(s.backends, func(b Backend) bool {
+		_, ok := b.(WriteableBackend)
+		return ok == writableFirst
+	})
+	rest := s.selectBackends(s.backends, func(b Backend) bool {
+		_, ok := b.(WriteableBackend)
+		return ok != writableFirst
+	})
+	return append(first, rest...)
+}
+
+// Conflicts returns the blueprints several backends have with different content, ids are sorted.
+// Backends having the same blueprint with the same content are no conflict.
+func (s *Storage) Conflicts() []Conflict {
+	s.index.mutex.Lock()
+	s.ensureIndex()
+	candidates := make(map[uuid.UUID][]Backend)
+	for id, entry := range s.index.entries {
+		if len(entry.others) > 0 {
+			candidates[id] = append([]Backend{entry.backend}, entry.others...)
+		}
+	}
+	s.index.mutex.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	sortIds(ids)
+
+	conflicts := make([]Conflict, 0)
+	for _, id := range ids {
+		versions := make([]ConflictVersion, 0)
+		contents := make(map[string]bool)
+		for i, backend := range candidates[id] {
+			bp, err := backend.Load(id)
+			if err != nil {
+				continue
+			}
+			content, err := json.Marshal(bp)
+			if err != nil {
+				continue
+			}
+			contents[string(content)] = true
+			_, writable := backend.(WriteableBackend)
+			versions = append(versions, ConflictVersion{describeBackend(backend), writable, bp.Meta.Name, i == 0})
+		}
+		if len(contents) > 1 {
+			conflicts = append(conflicts, Conflict{id, versions})
+		}
+	}
+	return conflicts
+}
+
+func describeBackend(backend Backend) string {
+	if s, ok := backend.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", backend)
+}
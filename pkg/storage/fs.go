@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/Bitspark/go-funk"
 	"github.com/Bitspark/slang/pkg/core"
@@ -19,8 +20,11 @@ var FILE_ENDINGS = []string{".yaml", ".yml", ".json"} // Order of endings matter
 
 type FileSystem struct {
 	root  string
+	mutex *sync.Mutex
 	cache map[uuid.UUID]*core.Blueprint
 	uuids []uuid.UUID
+	// Blueprint files found when listing, used to tell which blueprint has been removed
+	paths map[string]uuid.UUID
 }
 
 type WritableFileSystem struct {
@@ -38,13 +42,16 @@ func cleanPath(p string) string {
 }
 
 func NewWritableFileSystem(root string) *WritableFileSystem {
-	p := cleanPath(root)
-	return &WritableFileSystem{FileSystem: FileSystem{p, make(map[uuid.UUID]*core.Blueprint), nil}}
+	return &WritableFileSystem{FileSystem: *NewReadOnlyFileSystem(root)}
 }
 
 func NewReadOnlyFileSystem(root string) *FileSystem {
 	p := cleanPath(root)
-	return &FileSystem{p, make(map[uuid.UUID]*core.Blueprint), nil}
+	return &FileSystem{p, &sync.Mutex{}, make(map[uuid.UUID]*core.Blueprint), nil, make(map[string]uuid.UUID)}
+}
+
+func (fs *FileSystem) String() string {
+	return fs.root
 }
 
 func (fs *FileSystem) Has(opId uuid.UUID) bool {
@@ -53,11 +60,18 @@ func (fs *FileSystem) Has(opId uuid.UUID) bool {
 }
 
 func (fs *FileSystem) List() ([]uuid.UUID, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.list()
+}
+
+func (fs *FileSystem) list() ([]uuid.UUID, error) {
 	if fs.uuids != nil {
 		return fs.uuids, nil
 	}
 
 	opsFilePathSet := make(map[uuid.UUID]bool)
+	fs.paths = make(map[string]uuid.UUID)
 
 	_ = filepath.Walk(fs.root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -84,16 +98,20 @@ func (fs *FileSystem) List() ([]uuid.UUID, error) {
 		}
 
 		opsFilePathSet[blueprint.Id] = true
+		fs.paths[filepath.Clean(path)] = blueprint.Id
 
 		return nil
 	})
 
 	fs.uuids = funk.Keys(opsFilePathSet).([]uuid.UUID)
 
-	return fs.List()
+	return fs.uuids, nil
 }
 
 func (fs *FileSystem) Load(opId uuid.UUID) (*core.Blueprint, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
 	if def, ok := fs.cache[opId]; ok {
 		return def, nil
 	}
@@ -103,12 +121,13 @@ func (fs *FileSystem) Load(opId uuid.UUID) (*core.Blueprint, error) {
 		return nil, err
 	}
 
-	fs.cache[opId], err = fs.readBlueprintFile(blueprintFile)
+	def, err := fs.readBlueprintFile(blueprintFile)
 	if err != nil {
 		return nil, err
 	}
+	fs.cache[opId] = def
 
-	return fs.Load(opId)
+	return def, nil
 }
 
 func (fs *WritableFileSystem) Save(blueprint core.Blueprint) (uuid.UUID, error) {
@@ -122,6 +141,9 @@ func (fs *WritableFileSystem) Save(blueprint core.Blueprint) (uuid.UUID, error)
 		return opId, err
 	}
 
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
 	delete(fs.cache, opId)
 	fs.uuids = nil
 
@@ -139,6 +161,21 @@ func (fs *WritableFileSystem) Save(blueprint core.Blueprint) (uuid.UUID, error)
 	return opId, nil
 }
 
+func (fs *WritableFileSystem) Delete(opId uuid.UUID) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	blueprintFile, err := fs.getFilePath(opId)
+	if err != nil {
+		return err
+	}
+
+	delete(fs.cache, opId)
+	fs.uuids = nil
+
+	return os.Remove(blueprintFile)
+}
+
 func (fs *FileSystem) hasSupportedSuffix(filePath string) bool {
 	return utils.IsJSON(filePath) || utils.IsYAML(filePath)
 }
@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/Bitspark/slang/pkg/core"
 	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
 )
 
 func Test_ReadOnlyFilesystem(t *testing.T) {
@@ -35,3 +38,20 @@ func Test_cleanPath__ExpandRelativePath(t *testing.T) {
 	// filepath.join stips trailing slash
 	a.Equal(filepath.Join(cwd, "folder")+string(filepath.Separator), path)
 }
+
+func Test_WritableFilesystem__Delete(t *testing.T) {
+	a := assertions.New(t)
+	dir, err := ioutil.TempDir("", "slang-fs")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := NewWritableFileSystem(dir)
+	bp := core.Blueprint{Id: uuid.New()}
+	_, err = fs.Save(bp)
+	a.NoError(err)
+	a.True(fs.Has(bp.Id))
+
+	a.NoError(fs.Delete(bp.Id))
+	a.False(fs.Has(bp.Id))
+	a.Error(fs.Delete(bp.Id))
+}
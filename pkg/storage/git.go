@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// GitAuthor is who commits are attributed to
+type GitAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+var DefaultGitAuthor = GitAuthor{"slang", "slang@localhost"}
+
+// Revision is a commit which changed a blueprint
+type Revision struct {
+	Hash    string    `json:"hash"`
+	Author  GitAuthor `json:"author"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+var revisionPattern = regexp.MustCompile(`^[0-9a-zA-Z_./~^-]+$`)
+
+// GitRepository is a writable backend keeping blueprints in the working tree of a git repository.
+// Each save and delete is committed, so the history of a blueprint can be listed, loaded and reverted.
+// A repository cloned from a remote, such as a shared bare repository, pushes its commits there.
+// The git command line tool has to be installed.
+type GitRepository struct {
+	WritableFileSystem
+	// Serializes changing the working tree and committing
+	gitMutex *sync.Mutex
+	author   GitAuthor
+	push     bool
+}
+
+func newGitRepository(dir string, author GitAuthor) *GitRepository {
+	return &GitRepository{
+		WritableFileSystem: *NewWritableFileSystem(dir),
+		gitMutex:           &sync.Mutex{},
+		author:             author,
+	}
+}
+
+// NewGitRepository uses the repository in the directory, it is initialized if necessary
+func NewGitRepository(dir string, author GitAuthor) (*GitRepository, error) {
+	if _, err := utils.EnsureDirExists(dir); err != nil {
+		return nil, err
+	}
+	repo := newGitRepository(dir, author)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := repo.git(author, "init"); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// CloneGitRepository clones the remote into the directory unless it has been cloned before.
+// Commits are pushed to the remote.
+func CloneGitRepository(remote string, dir string, author GitAuthor) (*GitRepository, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if out, err := exec.Command("git", "clone", "--quiet", remote, dir).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("git clone: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	repo := newGitRepository(dir, author)
+	repo.push = true
+	return repo, nil
+}
+
+// git runs the git command in the working tree, committing as the author
+func (r *GitRepository) git(author GitAuthor, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.root}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+author.Name,
+		"GIT_AUTHOR_EMAIL="+author.Email,
+		"GIT_COMMITTER_NAME="+author.Name,
+		"GIT_COMMITTER_EMAIL="+author.Email,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// commit commits the changes of the files, if there are any, and pushes them if there is a remote
+func (r *GitRepository) commit(author GitAuthor, message string, files ...string) error {
+	status, err := r.git(author, append([]string{"status", "--porcelain", "--untracked-files=all", "--"}, files...)...)
+	if err != nil {
+		return err
+	}
+	// Only changed files can be added, git fails for files which neither exist nor are tracked
+	changed := []string{"--"}
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) > 3 {
+			changed = append(changed, line[3:])
+		}
+	}
+	if len(changed) == 1 {
+		return nil
+	}
+
+	if _, err := r.git(author, append([]string{"add", "--all"}, changed...)...); err != nil {
+		return err
+	}
+	if _, err := r.git(author, append([]string{"commit", "--quiet", "-m", message}, changed...)...); err != nil {
+		return err
+	}
+	if r.push {
+		if _, err := r.git(author, "push", "--quiet", "origin", "HEAD"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blueprintFiles are the names a blueprint file may have relative to the working tree
+func blueprintFiles(opId uuid.UUID) []string {
+	files := make([]string, 0, len(FILE_ENDINGS))
+	for _, ending := range FILE_ENDINGS {
+		files = append(files, opId.String()+ending)
+	}
+	return files
+}
+
+func (r *GitRepository) Save(blueprint core.Blueprint) (uuid.UUID, error) {
+	return r.SaveAs(blueprint, r.author)
+}
+
+// SaveAs saves the blueprint and commits it in the name of the author
+func (r *GitRepository) SaveAs(blueprint core.Blueprint, author GitAuthor) (uuid.UUID, error) {
+	return r.save(blueprint, author, fmt.Sprintf("Save %s (%s)", blueprint.Meta.Name, blueprint.Id))
+}
+
+func (r *GitRepository) save(blueprint core.Blueprint, author GitAuthor, message string) (uuid.UUID, error) {
+	r.gitMutex.Lock()
+	defer r.gitMutex.Unlock()
+
+	opId, err := r.WritableFileSystem.Save(blueprint)
+	if err != nil {
+		return opId, err
+	}
+	return opId, r.commit(author, message, blueprintFiles(opId)...)
+}
+
+func (r *GitRepository) Delete(opId uuid.UUID) error {
+	return r.DeleteAs(opId, r.author)
+}
+
+// DeleteAs deletes the blueprint and commits the deletion in the name of the author
+func (r *GitRepository) DeleteAs(opId uuid.UUID, author GitAuthor) error {
+	r.gitMutex.Lock()
+	defer r.gitMutex.Unlock()
+
+	name := opId.String()
+	if bp, err := r.Load(opId); err == nil {
+		name = bp.Meta.Name
+	}
+	if err := r.WritableFileSystem.Delete(opId); err != nil {
+		return err
+	}
+	return r.commit(author, fmt.Sprintf("Delete %s (%s)", name, opId), blueprintFiles(opId)...)
+}
+
+// History returns the revisions which changed the blueprint, the most recent first
+func (r *GitRepository) History(opId uuid.UUID) ([]Revision, error) {
+	r.gitMutex.Lock()
+	defer r.gitMutex.Unlock()
+
+	revisions := make([]Revision, 0)
+	if _, err := r.git(r.author, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		// Nothing committed yet
+		return revisions, nil
+	}
+
+	args := append([]string{"log", "--format=%H%x1f%an%x1f%ae%x1f%at%x1f%s", "--"}, blueprintFiles(opId)...)
+	out, err := r.git(r.author, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		seconds, _ := strconv.ParseInt(fields[3], 10, 64)
+		revisions = append(revisions, Revision{
+			Hash:    fields[0],
+			Author:  GitAuthor{fields[1], fields[2]},
+			Time:    time.Unix(seconds, 0),
+			Message: fields[4],
+		})
+	}
+	return revisions, nil
+}
+
+// LoadRevision loads the blueprint as it has been at the revision
+func (r *GitRepository) LoadRevision(opId uuid.UUID, revision string) (*core.Blueprint, error) {
+	if !revisionPattern.MatchString(revision) || strings.HasPrefix(revision, "-") {
+		return nil, fmt.Errorf("invalid revision: %s", revision)
+	}
+
+	r.gitMutex.Lock()
+	defer r.gitMutex.Unlock()
+
+	for _, file := range blueprintFiles(opId) {
+		content, err := r.git(r.author, "show", revision+":"+file)
+		if err != nil {
+			continue
+		}
+
+		var def core.Blueprint
+		if utils.IsYAML(file) {
+			def, err = core.ParseYAMLOperatorDef(content)
+		} else {
+			def, err = core.ParseJSONOperatorDef(content)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &def, nil
+	}
+	return nil, fmt.Errorf("blueprint %s does not exist at revision %s", opId, revision)
+}
+
+// Revert saves the blueprint as it has been at the revision, which is committed as a new revision
+func (r *GitRepository) Revert(opId uuid.UUID, revision string) (*core.Blueprint, error) {
+	return r.RevertAs(opId, revision, r.author)
+}
+
+// RevertAs reverts the blueprint to the revision in the name of the author
+func (r *GitRepository) RevertAs(opId uuid.UUID, revision string, author GitAuthor) (*core.Blueprint, error) {
+	bp, err := r.LoadRevision(opId, revision)
+	if err != nil {
+		return nil, err
+	}
+	if bp.Id != opId {
+		return nil, errors.New("blueprint at revision has a different id")
+	}
+	if _, err := r.save(*bp, author, fmt.Sprintf("Revert %s (%s) to %s", bp.Meta.Name, opId, revision)); err != nil {
+		return nil, err
+	}
+	return bp, nil
+}
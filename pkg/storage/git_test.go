@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+)
+
+func Test_GitRepository(t *testing.T) {
+	a := assertions.New(t)
+	repo := newGitRepository("/somewhere", DefaultGitAuthor)
+	a.Implements((*WriteableBackend)(nil), repo)
+	a.Implements((*WatchableBackend)(nil), repo)
+	a.Implements((*VersionedBackend)(nil), repo)
+}
+
+func Test_GitRepository__History_Load_Revert(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	a := assertions.New(t)
+	dir, err := ioutil.TempDir("", "slang-git")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// A bare repository stands in for a shared remote
+	remote := filepath.Join(dir, "remote.git")
+	a.NoError(exec.Command("git", "init", "--quiet", "--bare", remote).Run())
+	repo, err := CloneGitRepository(remote, filepath.Join(dir, "clone"), GitAuthor{"Alice", "alice@example.com"})
+	a.NoError(err)
+
+	bp := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "First"}}
+	_, err = repo.Save(bp)
+	a.NoError(err)
+	// Saving without changes does not create a revision
+	_, err = repo.Save(bp)
+	a.NoError(err)
+	bp.Meta.Name = "Second"
+	_, err = repo.SaveAs(bp, GitAuthor{"Bob", "bob@example.com"})
+	a.NoError(err)
+
+	history, err := repo.History(bp.Id)
+	a.NoError(err)
+	a.Len(history, 2)
+	a.Equal("Bob", history[0].Author.Name)
+	a.Equal("Alice", history[1].Author.Name)
+	a.Contains(history[1].Message, "First")
+
+	first, err := repo.LoadRevision(bp.Id, history[1].Hash)
+	a.NoError(err)
+	a.Equal("First", first.Meta.Name)
+	_, err = repo.LoadRevision(bp.Id, "--output=/tmp/x")
+	a.Error(err)
+
+	_, err = repo.Revert(bp.Id, history[1].Hash)
+	a.NoError(err)
+	loaded, err := repo.Load(bp.Id)
+	a.NoError(err)
+	a.Equal("First", loaded.Meta.Name)
+
+	a.NoError(repo.Delete(bp.Id))
+	a.False(repo.Has(bp.Id))
+	history, err = repo.History(bp.Id)
+	a.NoError(err)
+	a.Len(history, 4)
+
+	// All revisions have been pushed
+	out, err := exec.Command("git", "--git-dir", remote, "log", "--oneline").Output()
+	a.NoError(err)
+	a.Len(strings.Split(strings.TrimSpace(string(out)), "\n"), 4)
+}
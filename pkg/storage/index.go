@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/google/uuid"
+)
+
+// index knows which backend holds a blueprint, its meta information and what it depends on, so listing
+// blueprints and resolving dependencies does not have to ask every backend again. It is built on first use
+// and kept up to date when blueprints are saved or deleted through the storage or their files change.
+// Copies of a storage share its index.
+type index struct {
+	mutex   *sync.Mutex
+	built   bool
+	entries map[uuid.UUID]*indexEntry
+	// Computed from the entries when needed, nil if it has to be computed again
+	dependents map[uuid.UUID][]uuid.UUID
+}
+
+type indexEntry struct {
+	backend Backend
+	// Other backends having the blueprint as well, see Conflicts
+	others       []Backend
+	meta         core.BlueprintMetaDef
+	dependencies []uuid.UUID
+}
+
+func newIndex() *index {
+	return &index{mutex: &sync.Mutex{}}
+}
+
+func newIndexEntry(backend Backend, opId uuid.UUID) *indexEntry {
+	entry := &indexEntry{backend: backend, dependencies: make([]uuid.UUID, 0)}
+	bp, err := backend.Load(opId)
+	if err != nil {
+		return entry
+	}
+	entry.meta = bp.Meta
+	seen := make(map[uuid.UUID]bool)
+	for _, ins := range bp.InstanceDefs {
+		if !seen[ins.Operator] {
+			seen[ins.Operator] = true
+			entry.dependencies = append(entry.dependencies, ins.Operator)
+		}
+	}
+	return entry
+}
+
+// ensureIndex builds the index unless it has been built already, the mutex has to be held.
+// Like loading, the first backend having a blueprint wins according to the precedence.
+func (s *Storage) ensureIndex() {
+	if s.index.built {
+		return
+	}
+	s.index.entries = make(map[uuid.UUID]*indexEntry)
+	for _, backend := range s.orderedBackends() {
+		ids, err := backend.List()
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			if entry, ok := s.index.entries[id]; ok {
+				entry.others = append(entry.others, backend)
+			} else {
+				s.index.entries[id] = newIndexEntry(backend, id)
+			}
+		}
+	}
+	s.index.dependents = nil
+	s.index.built = true
+}
+
+// Reindex updates the entry of the blueprint after it has been saved, deleted or changed
+func (s *Storage) Reindex(opId uuid.UUID) {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	if !s.index.built {
+		return
+	}
+	delete(s.index.entries, opId)
+	if backends := s.selectBackends(s.orderedBackends(), func(b Backend) bool { return b.Has(opId) }); len(backends) > 0 {
+		entry := newIndexEntry(backends[0], opId)
+		entry.others = backends[1:]
+		s.index.entries[opId] = entry
+	}
+	s.index.dependents = nil
+}
+
+// Invalidate drops the index, it is built again on next use. This is only necessary if blueprints
+// have been changed by others while the storage has not been watching.
+func (s *Storage) Invalidate() {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.index.built = false
+	s.index.entries = nil
+	s.index.dependents = nil
+}
+
+// indexedBackend returns the backend holding the blueprint if the index has been built and knows it
+func (s *Storage) indexedBackend(opId uuid.UUID) Backend {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	if !s.index.built {
+		return nil
+	}
+	if entry, ok := s.index.entries[opId]; ok {
+		return entry.backend
+	}
+	return nil
+}
+
+// Meta returns the meta information of the blueprint without loading it
+func (s *Storage) Meta(opId uuid.UUID) (core.BlueprintMetaDef, bool) {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.ensureIndex()
+	entry, ok := s.index.entries[opId]
+	if !ok {
+		return core.BlueprintMetaDef{}, false
+	}
+	return entry.meta, true
+}
+
+// Dependencies returns the ids of the blueprints the blueprint uses directly, ids are sorted
+func (s *Storage) Dependencies(opId uuid.UUID) []uuid.UUID {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.ensureIndex()
+	deps := make([]uuid.UUID, 0)
+	if entry, ok := s.index.entries[opId]; ok {
+		deps = append(deps, entry.dependencies...)
+	}
+	sortIds(deps)
+	return deps
+}
+
+// Dependents returns the ids of the blueprints using the blueprint directly, ids are sorted
+func (s *Storage) Dependents(opId uuid.UUID) []uuid.UUID {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.ensureIndex()
+	if s.index.dependents == nil {
+		s.index.dependents = make(map[uuid.UUID][]uuid.UUID)
+		for id, entry := range s.index.entries {
+			for _, dep := range entry.dependencies {
+				s.index.dependents[dep] = append(s.index.dependents[dep], id)
+			}
+		}
+	}
+	dependents := append([]uuid.UUID{}, s.index.dependents[opId]...)
+	sortIds(dependents)
+	return dependents
+}
+
+// QueryableBackend is a backend looking up blueprints by name, tag and dependency itself, such as a database
+type QueryableBackend interface {
+	Backend
+	Named(text string) ([]uuid.UUID, error)
+	Tagged(tag string) ([]uuid.UUID, error)
+	Dependents(opId uuid.UUID) ([]uuid.UUID, error)
+}
+
+// Lookup selects blueprints by a text contained in their name, tags they all have and a blueprint they use directly.
+// Names and tags are compared ignoring case, zero values select all blueprints.
+type Lookup struct {
+	Name string
+	Tags []string
+	Uses uuid.UUID
+}
+
+func (l Lookup) matches(entry *indexEntry) bool {
+	if !strings.Contains(strings.ToLower(entry.meta.Name), strings.ToLower(l.Name)) {
+		return false
+	}
+	for _, tag := range l.Tags {
+		found := false
+		for _, t := range entry.meta.Tags {
+			found = found || strings.EqualFold(t, tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	if l.Uses == uuid.Nil {
+		return true
+	}
+	for _, dep := range entry.dependencies {
+		if dep == l.Uses {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupIn returns the ids of the blueprints of the backend selected by the lookup
+func lookupIn(backend QueryableBackend, l Lookup) (map[uuid.UUID]bool, error) {
+	var sets [][]uuid.UUID
+	if l.Name != "" {
+		ids, err := backend.Named(l.Name)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, ids)
+	}
+	for _, tag := range l.Tags {
+		ids, err := backend.Tagged(tag)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, ids)
+	}
+	if l.Uses != uuid.Nil {
+		ids, err := backend.Dependents(l.Uses)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, ids)
+	}
+
+	selected := make(map[uuid.UUID]bool)
+	for i, ids := range sets {
+		next := make(map[uuid.UUID]bool)
+		for _, id := range ids {
+			if i == 0 || selected[id] {
+				next[id] = true
+			}
+		}
+		selected = next
+	}
+	return selected, nil
+}
+
+// Find returns the sorted ids of the blueprints selected by the lookup. Queryable backends look up their
+// blueprints with their indexed columns, the blueprints of all other backends are looked up in the index.
+func (s *Storage) Find(l Lookup) ([]uuid.UUID, error) {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.ensureIndex()
+	selected := make(map[Backend]map[uuid.UUID]bool)
+	ids := make([]uuid.UUID, 0)
+	for id, entry := range s.index.entries {
+		qb, ok := entry.backend.(QueryableBackend)
+		if !ok || (l.Name == "" && len(l.Tags) == 0 && l.Uses == uuid.Nil) {
+			if l.matches(entry) {
+				ids = append(ids, id)
+			}
+			continue
+		}
+		if _, ok := selected[qb]; !ok {
+			set, err := lookupIn(qb, l)
+			if err != nil {
+				return nil, err
+			}
+			selected[qb] = set
+		}
+		if selected[qb][id] {
+			ids = append(ids, id)
+		}
+	}
+	sortIds(ids)
+	return ids, nil
+}
+
+func sortIds(ids []uuid.UUID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+}
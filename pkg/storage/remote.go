@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/google/uuid"
+)
+
+// RemoteCacheTTL is how long the blueprints listed by a remote daemon are used without asking it again
+var RemoteCacheTTL = time.Minute
+
+// RemoteRetryBackoff is how long a remote daemon which could not be reached is not asked again.
+// The backoff doubles with each further failure up to RemoteMaxRetryBackoff.
+var RemoteRetryBackoff = time.Second
+var RemoteMaxRetryBackoff = time.Minute
+
+// Remote is a backend loading the blueprints of another slangd, e.g. a central library daemon, through its
+// operator API. Elementary blueprints are left out as every daemon has them. Blueprints are cached and
+// served from the cache while the remote daemon cannot be reached.
+type Remote struct {
+	url    string
+	token  string
+	client *http.Client
+	// Guards the cache and the state of listing, it is not held while requesting the remote daemon
+	mutex  *sync.Mutex
+	cache  map[uuid.UUID]*core.Blueprint
+	listed time.Time
+	// Last failure to list, the remote daemon is not asked again before retry
+	failure error
+	retry   time.Time
+	backoff time.Duration
+	// Serializes listing, so concurrent callers wait for the same request
+	listMutex *sync.Mutex
+}
+
+// WritableRemote also saves and deletes blueprints on the remote daemon
+type WritableRemote struct {
+	Remote
+}
+
+type remoteErrorJSON struct {
+	Msg   string `json:"msg"`
+	Error *struct {
+		Msg string `json:"msg"`
+	} `json:"error"`
+}
+
+// NewReadOnlyRemote uses the daemon at the URL, e.g. http://library:5149. If the token is not empty
+// requests authenticate with it.
+func NewReadOnlyRemote(url string, token string) *Remote {
+	return &Remote{
+		url:       strings.TrimSuffix(url, "/"),
+		token:     token,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		mutex:     &sync.Mutex{},
+		cache:     make(map[uuid.UUID]*core.Blueprint),
+		listMutex: &sync.Mutex{},
+	}
+}
+
+func NewWritableRemote(url string, token string) *WritableRemote {
+	return &WritableRemote{Remote: *NewReadOnlyRemote(url, token)}
+}
+
+func (r *Remote) String() string {
+	return r.url
+}
+
+// request sends the request to the remote daemon and decodes its response into out unless it is nil
+func (r *Remote) request(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, r.url+path, body)
+	if err != nil {
+		return err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e remoteErrorJSON
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error != nil {
+			e.Msg = e.Error.Msg
+		}
+		return fmt.Errorf("%s %s: %s %s", method, r.url+path, resp.Status, e.Msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// upToDate tells whether the remote daemon is not to be asked again, because it has been listed recently
+// or it has failed recently. In the latter case the failure is returned if no blueprints have been cached.
+func (r *Remote) upToDate() (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.listed.IsZero() && time.Since(r.listed) < RemoteCacheTTL {
+		return true, nil
+	}
+	if r.failure != nil && time.Now().Before(r.retry) {
+		if !r.listed.IsZero() {
+			return true, nil
+		}
+		return true, r.failure
+	}
+	return false, nil
+}
+
+// refresh lists the blueprints of the remote daemon unless it is up to date
+func (r *Remote) refresh() error {
+	if ok, err := r.upToDate(); ok {
+		return err
+	}
+
+	r.listMutex.Lock()
+	defer r.listMutex.Unlock()
+	// Listed by another caller in the meantime
+	if ok, err := r.upToDate(); ok {
+		return err
+	}
+
+	cache, err := r.list()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err != nil {
+		if r.backoff == 0 {
+			r.backoff = RemoteRetryBackoff
+		} else if r.backoff *= 2; r.backoff > RemoteMaxRetryBackoff {
+			r.backoff = RemoteMaxRetryBackoff
+		}
+		r.failure = err
+		r.retry = time.Now().Add(r.backoff)
+		if !r.listed.IsZero() {
+			log.Printf("[WARNING] using cached blueprints of %s, retrying in %s: %v", r.url, r.backoff, err)
+			return nil
+		}
+		return err
+	}
+
+	r.cache = cache
+	r.listed = time.Now()
+	r.failure = nil
+	r.backoff = 0
+	return nil
+}
+
+// list requests the blueprints of the remote daemon
+func (r *Remote) list() (map[uuid.UUID]*core.Blueprint, error) {
+	var list struct {
+		Objects []struct {
+			Def  core.Blueprint `json:"def"`
+			Type string         `json:"type"`
+		} `json:"objects"`
+		Error *struct {
+			Msg string `json:"msg"`
+		} `json:"error"`
+	}
+	if err := r.request("GET", "/operator/", nil, &list); err != nil {
+		return nil, err
+	}
+	if list.Error != nil {
+		return nil, fmt.Errorf("%s: %s", r.url, list.Error.Msg)
+	}
+
+	cache := make(map[uuid.UUID]*core.Blueprint)
+	for _, obj := range list.Objects {
+		if obj.Type == "elementary" {
+			continue
+		}
+		def := obj.Def
+		cache[def.Id] = &def
+	}
+	return cache, nil
+}
+
+func (r *Remote) List() ([]uuid.UUID, error) {
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ids := make([]uuid.UUID, 0, len(r.cache))
+	for id := range r.cache {
+		ids = append(ids, id)
+	}
+	sortIds(ids)
+	return ids, nil
+}
+
+func (r *Remote) cached(opId uuid.UUID) (*core.Blueprint, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bp, ok := r.cache[opId]
+	return bp, ok
+}
+
+func (r *Remote) Has(opId uuid.UUID) bool {
+	if err := r.refresh(); err != nil {
+		return false
+	}
+	_, ok := r.cached(opId)
+	return ok
+}
+
+func (r *Remote) Load(opId uuid.UUID) (*core.Blueprint, error) {
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	if bp, ok := r.cached(opId); ok {
+		return bp, nil
+	}
+
+	// The blueprint may have been added since listing
+	var out struct {
+		Data struct {
+			Def  core.Blueprint `json:"def"`
+			Type string         `json:"type"`
+		} `json:"data"`
+	}
+	if err := r.request("GET", fmt.Sprintf("/operator/%s/", opId), nil, &out); err != nil {
+		return nil, err
+	}
+	if out.Data.Type == "elementary" {
+		return nil, fmt.Errorf("operator %s is elementary", opId)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cache[opId] = &out.Data.Def
+	return &out.Data.Def, nil
+}
+
+func (r *WritableRemote) Save(blueprint core.Blueprint) (uuid.UUID, error) {
+	if err := r.request("PUT", fmt.Sprintf("/operator/%s/", blueprint.Id), blueprint, nil); err != nil {
+		return blueprint.Id, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cache[blueprint.Id] = &blueprint
+	return blueprint.Id, nil
+}
+
+// Delete deletes the blueprint on the remote daemon, which refuses to delete blueprints used by others
+func (r *WritableRemote) Delete(opId uuid.UUID) error {
+	if err := r.request("DELETE", fmt.Sprintf("/operator/%s/", opId), nil, nil); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.cache, opId)
+	return nil
+}
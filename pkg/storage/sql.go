@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// sqlDialect covers the differences of the supported databases
+type sqlDialect struct {
+	// Type of the column holding the blueprint JSON
+	textType string
+	// Postgres numbers its placeholders
+	numberedPlaceholders bool
+}
+
+// SQLite is only available in builds with cgo, see sql_sqlite.go
+var sqlDialects = map[string]sqlDialect{
+	"mysql":    {"LONGTEXT", false},
+	"postgres": {"TEXT", true},
+}
+
+// Migrations of the schema, each one is a single statement which is applied once. MySQL commits DDL
+// statements implicitly, so a migration must not consist of several statements, a failing one would leave
+// the schema half migrated. Only append to this list.
+var sqlMigrations = []func(d sqlDialect) string{
+	func(d sqlDialect) string {
+		return `CREATE TABLE slang_blueprints (
+			id VARCHAR(36) NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			blueprint ` + d.textType + ` NOT NULL,
+			updated BIGINT NOT NULL
+		)`
+	},
+	func(d sqlDialect) string {
+		return `CREATE INDEX slang_blueprints_name ON slang_blueprints (name)`
+	},
+	// Tags are stored in lower case, so they do not collide under case insensitive collations
+	func(d sqlDialect) string {
+		return `CREATE TABLE slang_blueprint_tags (
+			id VARCHAR(36) NOT NULL,
+			tag VARCHAR(255) NOT NULL,
+			PRIMARY KEY (id, tag)
+		)`
+	},
+	func(d sqlDialect) string {
+		return `CREATE INDEX slang_blueprint_tags_tag ON slang_blueprint_tags (tag)`
+	},
+	func(d sqlDialect) string {
+		return `CREATE TABLE slang_blueprint_dependencies (
+			id VARCHAR(36) NOT NULL,
+			dependency VARCHAR(36) NOT NULL,
+			PRIMARY KEY (id, dependency)
+		)`
+	},
+	func(d sqlDialect) string {
+		return `CREATE INDEX slang_blueprint_dependencies_dependency ON slang_blueprint_dependencies (dependency)`
+	},
+}
+
+type sqlStatement struct {
+	query string
+	args  []interface{}
+}
+
+// Database is a writable backend keeping blueprints in a relational database. Next to the blueprint JSON
+// name, tags and dependencies are stored in indexed columns, so blueprints can be looked up without loading
+// all of them, see Storage.Find. Supported drivers are sqlite3, mysql and postgres.
+type Database struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// OpenDatabase connects to the database and migrates its schema to the current version
+func OpenDatabase(driver string, dataSource string) (*Database, error) {
+	dialect, ok := sqlDialects[driver]
+	if !ok && driver == "sqlite3" {
+		return nil, errors.New("sqlite3 is not supported by this build, it has to be built with cgo")
+	} else if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	d := &Database{db, dialect}
+	if err := d.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+func (d *Database) String() string {
+	return "database"
+}
+
+// bind replaces the ? placeholders with the ones of the database
+func (d *Database) bind(query string) string {
+	if !d.dialect.numberedPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Version returns the version of the schema, which is the number of migrations applied
+func (d *Database) Version() (int, error) {
+	var version sql.NullInt64
+	err := d.db.QueryRow(`SELECT MAX(version) FROM slang_migrations`).Scan(&version)
+	return int(version.Int64), err
+}
+
+func (d *Database) migrate() error {
+	if _, err := d.db.Exec(`CREATE TABLE IF NOT EXISTS slang_migrations (version INTEGER NOT NULL PRIMARY KEY)`); err != nil {
+		return err
+	}
+	version, err := d.Version()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqlMigrations[i](d.dialect)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %s", i+1, err)
+		}
+		if _, err := tx.Exec(d.bind(`INSERT INTO slang_migrations (version) VALUES (?)`), i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Database) queryIds(query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := d.db.Query(d.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (d *Database) List() ([]uuid.UUID, error) {
+	return d.queryIds(`SELECT id FROM slang_blueprints ORDER BY id`)
+}
+
+func (d *Database) Has(opId uuid.UUID) bool {
+	var n int
+	err := d.db.QueryRow(d.bind(`SELECT COUNT(*) FROM slang_blueprints WHERE id = ?`), opId.String()).Scan(&n)
+	return err == nil && n > 0
+}
+
+func (d *Database) Load(opId uuid.UUID) (*core.Blueprint, error) {
+	var content string
+	err := d.db.QueryRow(d.bind(`SELECT blueprint FROM slang_blueprints WHERE id = ?`), opId.String()).Scan(&content)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("blueprint %s not found", opId)
+	} else if err != nil {
+		return nil, err
+	}
+
+	def, err := core.ParseJSONOperatorDef(content)
+	if err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+func (d *Database) Save(blueprint core.Blueprint) (uuid.UUID, error) {
+	opId := blueprint.Id
+	content, err := json.Marshal(&blueprint)
+	if err != nil {
+		return opId, err
+	}
+
+	deps := make(map[string]bool)
+	for _, ins := range blueprint.InstanceDefs {
+		deps[ins.Operator.String()] = true
+	}
+	tags := make(map[string]bool)
+	for _, tag := range blueprint.Meta.Tags {
+		tags[strings.ToLower(tag)] = true
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return opId, err
+	}
+	stmts := append(d.deleteStatements(opId), sqlStatement{
+		`INSERT INTO slang_blueprints (id, name, blueprint, updated) VALUES (?, ?, ?, ?)`,
+		[]interface{}{opId.String(), blueprint.Meta.Name, string(content), time.Now().Unix()},
+	})
+	for _, tag := range sortedKeys(tags) {
+		stmts = append(stmts, sqlStatement{`INSERT INTO slang_blueprint_tags (id, tag) VALUES (?, ?)`, []interface{}{opId.String(), tag}})
+	}
+	for _, dep := range sortedKeys(deps) {
+		stmts = append(stmts, sqlStatement{`INSERT INTO slang_blueprint_dependencies (id, dependency) VALUES (?, ?)`, []interface{}{opId.String(), dep}})
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(d.bind(stmt.query), stmt.args...); err != nil {
+			tx.Rollback()
+			return opId, err
+		}
+	}
+	return opId, tx.Commit()
+}
+
+func (d *Database) deleteStatements(opId uuid.UUID) []sqlStatement {
+	args := []interface{}{opId.String()}
+	return []sqlStatement{
+		{`DELETE FROM slang_blueprint_dependencies WHERE id = ?`, args},
+		{`DELETE FROM slang_blueprint_tags WHERE id = ?`, args},
+		{`DELETE FROM slang_blueprints WHERE id = ?`, args},
+	}
+}
+
+func (d *Database) Delete(opId uuid.UUID) error {
+	if !d.Has(opId) {
+		return fmt.Errorf("blueprint %s not found", opId)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range d.deleteStatements(opId) {
+		if _, err := tx.Exec(d.bind(stmt.query), stmt.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, '!' is used as escape character as the databases
+// disagree on backslashes in string literals
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Named returns the ids of the blueprints whose name contains the text, ignoring case
+func (d *Database) Named(text string) ([]uuid.UUID, error) {
+	return d.queryIds(`SELECT id FROM slang_blueprints WHERE LOWER(name) LIKE ? ESCAPE '!' ORDER BY id`,
+		"%"+likeEscaper.Replace(strings.ToLower(text))+"%")
+}
+
+// Tagged returns the ids of the blueprints having the tag, ignoring case
+func (d *Database) Tagged(tag string) ([]uuid.UUID, error) {
+	return d.queryIds(`SELECT id FROM slang_blueprint_tags WHERE tag = ? ORDER BY id`, strings.ToLower(tag))
+}
+
+// Dependents returns the ids of the blueprints using the blueprint directly
+func (d *Database) Dependents(opId uuid.UUID) ([]uuid.UUID, error) {
+	return d.queryIds(`SELECT id FROM slang_blueprint_dependencies WHERE dependency = ? ORDER BY id`, opId.String())
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
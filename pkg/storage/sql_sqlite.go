@@ -0,0 +1,12 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sqlDialects["sqlite3"] = sqlDialect{"TEXT", false}
+}
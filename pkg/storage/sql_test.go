@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+)
+
+func Test_Database(t *testing.T) {
+	if _, ok := sqlDialects["sqlite3"]; !ok {
+		t.Skip("sqlite3 requires cgo")
+	}
+	a := assertions.New(t)
+	dir, err := ioutil.TempDir("", "slang-sql")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "blueprints.db")
+
+	d, err := OpenDatabase("sqlite3", file)
+	a.NoError(err)
+	a.Implements((*WriteableBackend)(nil), d)
+	a.Implements((*QueryableBackend)(nil), d)
+
+	used := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Used 100%", Tags: []string{"math", "Math"}}}
+	user := core.Blueprint{
+		Id:           uuid.New(),
+		Meta:         core.BlueprintMetaDef{Name: "User of used", Tags: []string{"math", "demo"}},
+		InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}, &core.InstanceDef{Name: "b", Operator: used.Id}},
+	}
+	for _, bp := range []core.Blueprint{used, user} {
+		_, err = d.Save(bp)
+		a.NoError(err)
+	}
+	// Saving again replaces the blueprint
+	user.Meta.Tags = []string{"demo"}
+	_, err = d.Save(user)
+	a.NoError(err)
+	a.NoError(d.Close())
+
+	// Migrations are only applied once
+	d, err = OpenDatabase("sqlite3", file)
+	a.NoError(err)
+	defer d.Close()
+	version, err := d.Version()
+	a.NoError(err)
+	a.Equal(len(sqlMigrations), version)
+
+	ids, err := d.List()
+	a.NoError(err)
+	a.Len(ids, 2)
+	a.True(d.Has(user.Id))
+
+	loaded, err := d.Load(user.Id)
+	a.NoError(err)
+	a.Equal("User of used", loaded.Meta.Name)
+	a.Len(loaded.InstanceDefs, 2)
+
+	ids, err = d.Tagged("Math")
+	a.NoError(err)
+	a.Equal([]uuid.UUID{used.Id}, ids)
+	ids, err = d.Named("user")
+	a.NoError(err)
+	a.Equal([]uuid.UUID{user.Id}, ids)
+	// Wildcards are matched literally
+	ids, err = d.Named("0%")
+	a.NoError(err)
+	a.Equal([]uuid.UUID{used.Id}, ids)
+	ids, err = d.Named("_")
+	a.NoError(err)
+	a.Empty(ids)
+	ids, err = d.Dependents(used.Id)
+	a.NoError(err)
+	a.Equal([]uuid.UUID{user.Id}, ids)
+
+	a.NoError(d.Delete(user.Id))
+	a.False(d.Has(user.Id))
+	a.Error(d.Delete(user.Id))
+	_, err = d.Load(user.Id)
+	a.Error(err)
+	ids, err = d.Dependents(used.Id)
+	a.NoError(err)
+	a.Empty(ids)
+}
+
+func Test_Database__Bind(t *testing.T) {
+	a := assertions.New(t)
+	d := &Database{dialect: sqlDialects["postgres"]}
+	a.Equal("SELECT $1 WHERE a = $2", d.bind("SELECT ? WHERE a = ?"))
+	d = &Database{dialect: sqlDialects["mysql"]}
+	a.Equal("SELECT ? WHERE a = ?", d.bind("SELECT ? WHERE a = ?"))
+}
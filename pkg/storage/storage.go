@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Bitspark/slang/pkg/core"
 	"github.com/Bitspark/slang/pkg/elem"
@@ -18,21 +19,67 @@ type Backend interface {
 type WriteableBackend interface {
 	Backend
 	Save(blueprint core.Blueprint) (uuid.UUID, error)
+	Delete(opId uuid.UUID) error
 }
 
+// AuthoringBackend is a writable backend which attributes changes to their author, such as a git repository
+type AuthoringBackend interface {
+	WriteableBackend
+	SaveAs(blueprint core.Blueprint, author GitAuthor) (uuid.UUID, error)
+	DeleteAs(opId uuid.UUID, author GitAuthor) error
+}
+
+// VersionedBackend is an authoring backend keeping the history of its blueprints, such as a git repository
+type VersionedBackend interface {
+	AuthoringBackend
+	History(opId uuid.UUID) ([]Revision, error)
+	LoadRevision(opId uuid.UUID, revision string) (*core.Blueprint, error)
+	RevertAs(opId uuid.UUID, revision string, author GitAuthor) (*core.Blueprint, error)
+	Revert(opId uuid.UUID, revision string) (*core.Blueprint, error)
+}
+
+// ErrNoHistory is returned for the history of blueprints if no writable backend keeps it
+var ErrNoHistory = errors.New("no writable backend keeps the history of blueprints")
+
 type Storage struct {
-	backends []Backend
+	backends   []Backend
+	precedence Precedence
+	index      *index
+	// Who changes are attributed to, authoring backends use their own author if it is not set
+	author *GitAuthor
 }
 
 func NewStorage() *Storage {
-	return &Storage{make([]Backend, 0)}
+	return &Storage{make([]Backend, 0), PrecedenceOrder, newIndex(), nil}
+}
+
+// As returns a storage sharing the backends of this storage which attributes changes to the author
+func (s *Storage) As(author GitAuthor) *Storage {
+	derived := *s
+	derived.author = &author
+	return &derived
 }
 
 func (s *Storage) AddBackend(backend Backend) *Storage {
 	s.backends = append(s.backends, backend)
+	s.Invalidate()
 	return s
 }
 
+// WithWritableBackend returns a storage which saves to the given backend and loads from it
+// and the read-only backends of this storage
+func (s *Storage) WithWritableBackend(backend WriteableBackend) *Storage {
+	derived := NewStorage().SetPrecedence(s.precedence).AddBackend(backend)
+	readOnlyBackends := s.selectBackends(s.backends, func(b Backend) bool {
+		_, ok := b.(WriteableBackend)
+		return !ok
+	})
+	for _, b := range readOnlyBackends {
+		derived.AddBackend(b)
+	}
+	return derived
+}
+
 func (s *Storage) IsSavedInWritableBackend(opId uuid.UUID) bool {
 	writableBackends := s.writeableBackends()
 	for _, backend := range writableBackends {
@@ -43,24 +90,35 @@ func (s *Storage) IsSavedInWritableBackend(opId uuid.UUID) bool {
 	return false
 }
 
-func (s *Storage) List() ([]uuid.UUID, error) {
-	all := make([]uuid.UUID, 0)
-
+// IsSavedInReadOnlyBackend tells whether a library, package or other read-only backend provides the blueprint
+func (s *Storage) IsSavedInReadOnlyBackend(opId uuid.UUID) bool {
 	for _, backend := range s.backends {
-		l, err := backend.List()
-
-		if err != nil {
-			continue
+		if _, ok := backend.(WriteableBackend); !ok && backend.Has(opId) {
+			return true
 		}
-		all = append(all, l...)
 	}
+	return false
+}
 
+// List returns the sorted ids of the blueprints of all backends, each id once
+func (s *Storage) List() ([]uuid.UUID, error) {
+	s.index.mutex.Lock()
+	defer s.index.mutex.Unlock()
+
+	s.ensureIndex()
+	all := make([]uuid.UUID, 0, len(s.index.entries))
+	for id := range s.index.entries {
+		all = append(all, id)
+	}
+	sortIds(all)
 	return all, nil
 }
 
+// Save saves the blueprint in all writable backends. If saving fails in one of them, the others are still
+// tried and the first error is returned.
 func (s *Storage) Save(blueprint core.Blueprint) (uuid.UUID, error) {
 	var opId uuid.UUID
-	var err error
+	var firstErr error
 	// The question is whether we want multiple backends that are able to take a write
 	// because if we need to make sure they all use the same identifier
 	writableBackends := s.writeableBackends()
@@ -68,15 +126,208 @@ func (s *Storage) Save(blueprint core.Blueprint) (uuid.UUID, error) {
 		return opId, errors.New("No writable backend for saving found")
 	}
 	for _, backend := range writableBackends {
-		opId, err = backend.Save(blueprint)
+		id, err := s.save(backend, blueprint)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		opId = id
+	}
+	s.Reindex(blueprint.Id)
+	return opId, firstErr
+}
+
+// InUseError is returned when a blueprint is to be removed while other blueprints still use it
+type InUseError struct {
+	Id         uuid.UUID
+	Dependents []uuid.UUID
+}
+
+func (e *InUseError) Error() string {
+	return fmt.Sprintf("operator %s is used by %d other operators", e.Id, len(e.Dependents))
+}
+
+// MissingDependenciesError is returned when a blueprint is to be copied to a storage lacking blueprints it uses
+type MissingDependenciesError struct {
+	Id           uuid.UUID
+	Dependencies []uuid.UUID
+}
+
+func (e *MissingDependenciesError) Error() string {
+	return fmt.Sprintf("operator %s uses %d operators missing in the target", e.Id, len(e.Dependencies))
+}
+
+// Delete removes the blueprint from all writable backends, blueprints of read-only backends cannot be deleted.
+// Unless forced, blueprints used by other blueprints are not deleted and an InUseError is returned.
+func (s *Storage) Delete(opId uuid.UUID, force bool) error {
+	if !s.IsSavedInWritableBackend(opId) {
+		return fmt.Errorf("operator %s is not saved in a writable backend", opId)
+	}
+	if !force {
+		if err := s.checkUnused(opId); err != nil {
+			return err
+		}
+	}
+	return s.delete(opId)
+}
+
+func (s *Storage) delete(opId uuid.UUID) error {
+	for _, backend := range s.writeableBackends() {
+		if !backend.Has(opId) {
+			continue
+		}
+		if err := s.deleteFrom(backend, opId); err != nil {
+			s.Reindex(opId)
+			return err
+		}
+	}
+	s.Reindex(opId)
+	return nil
+}
+
+func (s *Storage) save(backend WriteableBackend, blueprint core.Blueprint) (uuid.UUID, error) {
+	if ab, ok := backend.(AuthoringBackend); ok && s.author != nil {
+		return ab.SaveAs(blueprint, *s.author)
+	}
+	return backend.Save(blueprint)
+}
+
+func (s *Storage) deleteFrom(backend WriteableBackend, opId uuid.UUID) error {
+	if ab, ok := backend.(AuthoringBackend); ok && s.author != nil {
+		return ab.DeleteAs(opId, *s.author)
+	}
+	return backend.Delete(opId)
+}
+
+func (s *Storage) versionedBackend() (VersionedBackend, error) {
+	for _, backend := range s.writeableBackends() {
+		if vb, ok := backend.(VersionedBackend); ok {
+			return vb, nil
+		}
+	}
+	return nil, ErrNoHistory
+}
+
+// History returns the revisions of the blueprint kept by the writable backend, the most recent first.
+// Deleted blueprints have a history as well.
+func (s *Storage) History(opId uuid.UUID) ([]Revision, error) {
+	vb, err := s.versionedBackend()
+	if err != nil {
+		return nil, err
+	}
+	return vb.History(opId)
+}
+
+// LoadRevision loads the blueprint as it has been at the revision
+func (s *Storage) LoadRevision(opId uuid.UUID, revision string) (*core.Blueprint, error) {
+	vb, err := s.versionedBackend()
+	if err != nil {
+		return nil, err
 	}
-	return opId, err
+	return vb.LoadRevision(opId, revision)
+}
+
+// Revert saves the blueprint as it has been at the revision
+func (s *Storage) Revert(opId uuid.UUID, revision string) (*core.Blueprint, error) {
+	vb, err := s.versionedBackend()
+	if err != nil {
+		return nil, err
+	}
+	var bp *core.Blueprint
+	if s.author != nil {
+		bp, err = vb.RevertAs(opId, revision, *s.author)
+	} else {
+		bp, err = vb.Revert(opId, revision)
+	}
+	s.Reindex(opId)
+	return bp, err
+}
+
+func (s *Storage) checkUnused(opId uuid.UUID) error {
+	if dependents := s.Dependents(opId); len(dependents) > 0 {
+		return &InUseError{opId, dependents}
+	}
+	return nil
+}
+
+// Copy saves the blueprint in the writable backends of the other storage, the blueprint is kept here.
+// Unless forced, blueprints using blueprints the other storage cannot load are not copied and
+// a MissingDependenciesError is returned.
+func (s *Storage) Copy(opId uuid.UUID, to *Storage, force bool) (*core.Blueprint, error) {
+	if elem.IsRegistered(opId) {
+		return nil, fmt.Errorf("operator %s is elementary", opId)
+	}
+	bp, err := s.Load(opId)
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		missing := make([]uuid.UUID, 0)
+		for _, dep := range s.Dependencies(opId) {
+			if _, err := to.Load(dep); err != nil {
+				missing = append(missing, dep)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, &MissingDependenciesError{opId, missing}
+		}
+	}
+	if _, err := to.Save(*bp); err != nil {
+		return nil, err
+	}
+	return bp, nil
+}
+
+// Move copies the blueprint to the other storage and deletes it here. Only blueprints of writable backends
+// can be moved. Unless forced, the checks of Copy and Delete apply.
+func (s *Storage) Move(opId uuid.UUID, to *Storage, force bool) (*core.Blueprint, error) {
+	if !s.IsSavedInWritableBackend(opId) {
+		return nil, fmt.Errorf("operator %s is not saved in a writable backend", opId)
+	}
+	if !force {
+		if err := s.checkUnused(opId); err != nil {
+			return nil, err
+		}
+	}
+	bp, err := s.Copy(opId, to, force)
+	if err != nil {
+		return nil, err
+	}
+	// Storages sharing the writable backend already hold the moved blueprint
+	for _, backend := range to.writeableBackends() {
+		for _, own := range s.writeableBackends() {
+			if backend == own {
+				return bp, nil
+			}
+		}
+	}
+	return bp, s.delete(opId)
+}
+
+// Duplicate saves a copy of the blueprint with a new id and the given name, if it is empty the name of the
+// blueprint is used with "copy" appended
+func (s *Storage) Duplicate(opId uuid.UUID, name string) (*core.Blueprint, error) {
+	if elem.IsRegistered(opId) {
+		return nil, fmt.Errorf("operator %s is elementary", opId)
+	}
+	bp, err := s.Load(opId)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = strings.TrimSpace(bp.Meta.Name + " copy")
+	}
+	bp.Id = uuid.New()
+	bp.Meta.Name = name
+	if _, err := s.Save(*bp); err != nil {
+		return nil, err
+	}
+	return bp, nil
 }
 
 func (s *Storage) writeableBackends() []WriteableBackend {
 	writeableBackends := make([]WriteableBackend, 0)
 
-	backends := s.selectBackends(func(b Backend) bool {
+	backends := s.selectBackends(s.backends, func(b Backend) bool {
 		b, ok := b.(WriteableBackend)
 		return ok
 	})
@@ -95,9 +346,9 @@ func (s *Storage) Load(opId uuid.UUID) (*core.Blueprint, error) {
 	return &cpyBlueprint, nil
 }
 
-func (s *Storage) selectBackends(f func(Backend) bool) []Backend {
+func (s *Storage) selectBackends(backends []Backend, f func(Backend) bool) []Backend {
 	selected := make([]Backend, 0)
-	for _, backend := range s.backends {
+	for _, backend := range backends {
 		if f(backend) {
 			selected = append(selected, backend)
 		}
@@ -106,9 +357,9 @@ func (s *Storage) selectBackends(f func(Backend) bool) []Backend {
 }
 
 func (s *Storage) selectBackend(opId uuid.UUID) Backend {
-	backends := s.selectBackends(func(b Backend) bool { return b.Has(opId) })
+	backends := s.selectBackends(s.orderedBackends(), func(b Backend) bool { return b.Has(opId) })
 	if len(backends) > 0 {
-		return backends[0] // always return the first backend as there should not be different version of the same operator.
+		return backends[0] // different versions of the same operator are reported by Conflicts
 	}
 	return nil
 }
@@ -118,7 +369,10 @@ func (s *Storage) getBlueprintId(opId uuid.UUID) (*core.Blueprint, error) {
 		return blueprint, nil
 	}
 
-	backend := s.selectBackend(opId)
+	backend := s.indexedBackend(opId)
+	if backend == nil {
+		backend = s.selectBackend(opId)
+	}
 
 	if backend == nil {
 		return nil, fmt.Errorf("unknown operator for id: %s", opId)
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/Bitspark/slang/pkg/core"
@@ -34,3 +36,267 @@ func Test_SavingWithoutWritableBackend(t *testing.T) {
 	a.Equal(id, u)
 	a.EqualError(err, "No writable backend for saving found")
 }
+
+func Test_WithWritableBackend(t *testing.T) {
+	a := assertions.New(t)
+	s := NewStorage()
+	s.AddBackend(NewWritableFileSystem("/somewhere"))
+	s.AddBackend(NewReadOnlyFileSystem("/somewhere/lib"))
+	ws := NewWritableFileSystem("/elsewhere")
+	derived := s.WithWritableBackend(ws)
+	a.Len(derived.backends, 2)
+	a.Equal([]WriteableBackend{ws}, derived.writeableBackends())
+}
+
+// countingBackend is an in-memory backend counting how often it has been asked
+type countingBackend struct {
+	blueprints map[uuid.UUID]core.Blueprint
+	lists      int
+	loads      int
+}
+
+func (b *countingBackend) List() ([]uuid.UUID, error) {
+	b.lists++
+	ids := make([]uuid.UUID, 0)
+	for id := range b.blueprints {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (b *countingBackend) Load(opId uuid.UUID) (*core.Blueprint, error) {
+	b.loads++
+	bp, ok := b.blueprints[opId]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &bp, nil
+}
+
+func (b *countingBackend) Has(opId uuid.UUID) bool {
+	_, ok := b.blueprints[opId]
+	return ok
+}
+
+func (b *countingBackend) Save(blueprint core.Blueprint) (uuid.UUID, error) {
+	b.blueprints[blueprint.Id] = blueprint
+	return blueprint.Id, nil
+}
+
+func (b *countingBackend) Delete(opId uuid.UUID) error {
+	delete(b.blueprints, opId)
+	return nil
+}
+
+// failingBackend refuses to save blueprints
+type failingBackend struct {
+	countingBackend
+}
+
+func (b *failingBackend) Save(blueprint core.Blueprint) (uuid.UUID, error) {
+	return blueprint.Id, errors.New("cannot save")
+}
+
+func Test_Save__First_Error(t *testing.T) {
+	a := assertions.New(t)
+	failing := &failingBackend{countingBackend{blueprints: map[uuid.UUID]core.Blueprint{}}}
+	working := &countingBackend{blueprints: map[uuid.UUID]core.Blueprint{}}
+	s := NewStorage().AddBackend(failing).AddBackend(working)
+
+	bp := core.Blueprint{Id: uuid.New()}
+	id, err := s.Save(bp)
+	a.EqualError(err, "cannot save")
+	a.Equal(bp.Id, id)
+	a.True(working.Has(bp.Id))
+}
+
+func Test_Index(t *testing.T) {
+	a := assertions.New(t)
+	used := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Used"}}
+	user := core.Blueprint{Id: uuid.New(), InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}}}
+	b := &countingBackend{blueprints: map[uuid.UUID]core.Blueprint{used.Id: used, user.Id: user}}
+	s := NewStorage().AddBackend(b)
+
+	ids, err := s.List()
+	a.NoError(err)
+	a.Len(ids, 2)
+	ids, _ = s.List()
+	a.Len(ids, 2)
+	a.Equal(1, b.lists)
+	a.Equal(2, b.loads)
+
+	meta, ok := s.Meta(used.Id)
+	a.True(ok)
+	a.Equal("Used", meta.Name)
+	a.Equal([]uuid.UUID{used.Id}, s.Dependencies(user.Id))
+	a.Equal([]uuid.UUID{user.Id}, s.Dependents(used.Id))
+	a.Equal(2, b.loads)
+
+	// Saving and deleting through the storage keeps the index up to date
+	other := core.Blueprint{Id: uuid.New(), InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}}}
+	_, err = s.Save(other)
+	a.NoError(err)
+	a.Len(s.Dependents(used.Id), 2)
+	a.NoError(s.Delete(user.Id, false))
+	a.Equal([]uuid.UUID{other.Id}, s.Dependents(used.Id))
+	ids, _ = s.List()
+	a.Len(ids, 2)
+	a.Equal(1, b.lists)
+
+	// Changes made behind the back of the storage need an invalidation
+	delete(b.blueprints, other.Id)
+	s.Invalidate()
+	a.Empty(s.Dependents(used.Id))
+	a.Equal(2, b.lists)
+}
+
+func Test_Delete_Move_Duplicate(t *testing.T) {
+	a := assertions.New(t)
+	used := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Used"}}
+	user := core.Blueprint{Id: uuid.New(), InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}}}
+	s := NewStorage().AddBackend(&countingBackend{blueprints: map[uuid.UUID]core.Blueprint{used.Id: used, user.Id: user}})
+	other := NewStorage().AddBackend(&countingBackend{blueprints: map[uuid.UUID]core.Blueprint{}})
+
+	err := s.Delete(used.Id, false)
+	a.IsType(&InUseError{}, err)
+	_, err = s.Move(user.Id, other, false)
+	a.IsType(&MissingDependenciesError{}, err)
+
+	_, err = s.Move(user.Id, other, true)
+	a.NoError(err)
+	a.False(s.IsSavedInWritableBackend(user.Id))
+	a.True(other.IsSavedInWritableBackend(user.Id))
+	a.NoError(s.Delete(used.Id, false))
+
+	dup, err := other.Duplicate(user.Id, "")
+	a.NoError(err)
+	a.NotEqual(user.Id, dup.Id)
+	a.Equal("copy", dup.Meta.Name)
+	ids, _ := other.List()
+	a.Len(ids, 2)
+}
+
+func Test_Conflicts_Precedence(t *testing.T) {
+	a := assertions.New(t)
+	same := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Same"}}
+	local := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Local"}}
+	library := local
+	library.Meta.Name = "Library"
+	s := NewStorage().
+		AddBackend(&countingBackend{blueprints: map[uuid.UUID]core.Blueprint{same.Id: same, local.Id: local}}).
+		AddBackend(NewReadOnlyFileSystem("/somewhere")).
+		AddBackend(readOnlyBackend{&countingBackend{blueprints: map[uuid.UUID]core.Blueprint{same.Id: same, library.Id: library}}})
+
+	conflicts := s.Conflicts()
+	a.Len(conflicts, 1)
+	a.Equal(local.Id, conflicts[0].Id)
+	a.Len(conflicts[0].Versions, 2)
+	a.True(conflicts[0].Versions[0].Selected)
+	a.True(conflicts[0].Versions[0].Writable)
+	bp, err := s.Load(local.Id)
+	a.NoError(err)
+	a.Equal("Local", bp.Meta.Name)
+
+	s.SetPrecedence(PrecedenceLibrary)
+	bp, err = s.Load(local.Id)
+	a.NoError(err)
+	a.Equal("Library", bp.Meta.Name)
+	a.False(s.Conflicts()[0].Versions[0].Writable)
+
+	_, err = ParsePrecedence("newest")
+	a.Error(err)
+}
+
+// readOnlyBackend hides the write methods of a backend
+type readOnlyBackend struct {
+	b Backend
+}
+
+func (r readOnlyBackend) List() ([]uuid.UUID, error)                   { return r.b.List() }
+func (r readOnlyBackend) Load(opId uuid.UUID) (*core.Blueprint, error) { return r.b.Load(opId) }
+func (r readOnlyBackend) Has(opId uuid.UUID) bool                      { return r.b.Has(opId) }
+
+// queryableBackend looks up blueprints itself and counts how often it has been asked
+type queryableBackend struct {
+	countingBackend
+	queries int
+}
+
+func (b *queryableBackend) Named(text string) ([]uuid.UUID, error) {
+	b.queries++
+	ids := make([]uuid.UUID, 0)
+	for id, bp := range b.blueprints {
+		if strings.Contains(strings.ToLower(bp.Meta.Name), strings.ToLower(text)) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (b *queryableBackend) Tagged(tag string) ([]uuid.UUID, error) {
+	b.queries++
+	ids := make([]uuid.UUID, 0)
+	for id, bp := range b.blueprints {
+		for _, t := range bp.Meta.Tags {
+			if strings.EqualFold(t, tag) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (b *queryableBackend) Dependents(opId uuid.UUID) ([]uuid.UUID, error) {
+	b.queries++
+	ids := make([]uuid.UUID, 0)
+	for id, bp := range b.blueprints {
+		for _, ins := range bp.InstanceDefs {
+			if ins.Operator == opId {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+func Test_Find(t *testing.T) {
+	a := assertions.New(t)
+	used := core.Blueprint{Id: uuid.New(), Meta: core.BlueprintMetaDef{Name: "Used", Tags: []string{"math"}}}
+	user := core.Blueprint{
+		Id:           uuid.New(),
+		Meta:         core.BlueprintMetaDef{Name: "User", Tags: []string{"Math", "demo"}},
+		InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}},
+	}
+	stored := core.Blueprint{
+		Id:           uuid.New(),
+		Meta:         core.BlueprintMetaDef{Name: "Stored user", Tags: []string{"demo"}},
+		InstanceDefs: core.InstanceDefList{&core.InstanceDef{Name: "a", Operator: used.Id}},
+	}
+	db := &queryableBackend{countingBackend: countingBackend{blueprints: map[uuid.UUID]core.Blueprint{stored.Id: stored}}}
+	s := NewStorage().
+		AddBackend(&countingBackend{blueprints: map[uuid.UUID]core.Blueprint{used.Id: used, user.Id: user}}).
+		AddBackend(db)
+
+	ids, err := s.Find(Lookup{})
+	a.NoError(err)
+	a.Len(ids, 3)
+	a.Equal(0, db.queries)
+
+	ids, err = s.Find(Lookup{Name: "user"})
+	a.NoError(err)
+	a.ElementsMatch([]uuid.UUID{user.Id, stored.Id}, ids)
+	a.Equal(1, db.queries)
+
+	ids, err = s.Find(Lookup{Tags: []string{"MATH"}})
+	a.NoError(err)
+	a.ElementsMatch([]uuid.UUID{used.Id, user.Id}, ids)
+
+	ids, err = s.Find(Lookup{Name: "user", Tags: []string{"demo"}, Uses: used.Id})
+	a.NoError(err)
+	a.ElementsMatch([]uuid.UUID{user.Id, stored.Id}, ids)
+
+	ids, err = s.Find(Lookup{Uses: user.Id})
+	a.NoError(err)
+	a.Empty(ids)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/utils"
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+// WatchDelay is how long a file has to be left alone until its change is reported.
+// Editors and git touch files several times when saving them.
+var WatchDelay = 200 * time.Millisecond
+
+type ChangeKind string
+
+const (
+	BlueprintAdded   ChangeKind = "added"
+	BlueprintChanged ChangeKind = "changed"
+	BlueprintRemoved ChangeKind = "removed"
+)
+
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Id   uuid.UUID  `json:"id"`
+}
+
+// WatchableBackend is a backend which notices when blueprints are changed by others
+type WatchableBackend interface {
+	Backend
+	// Watch reports changes until the context is done, then the channel is closed
+	Watch(ctx context.Context) (<-chan Change, error)
+}
+
+// Watch reports the changes of all watchable backends until the context is done, the index is kept up to date
+func (s *Storage) Watch(ctx context.Context) (<-chan Change, error) {
+	merged := make(chan Change)
+	sources := make([]<-chan Change, 0)
+	for _, backend := range s.backends {
+		wb, ok := backend.(WatchableBackend)
+		if !ok {
+			continue
+		}
+		changes, err := wb.Watch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, changes)
+	}
+
+	done := make(chan bool)
+	for _, changes := range sources {
+		go func(changes <-chan Change) {
+			for c := range changes {
+				s.Reindex(c.Id)
+				merged <- c
+			}
+			done <- true
+		}(changes)
+	}
+	go func() {
+		for range sources {
+			<-done
+		}
+		close(merged)
+	}()
+
+	return merged, nil
+}
+
+// Watch reports changes of the blueprint files in the root directory, such as edits by hand or by git.
+// Cached blueprints are reloaded once they have changed.
+func (fs *FileSystem) Watch(ctx context.Context) (<-chan Change, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(fs.root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	// Learn about the existing files to tell added from changed blueprints
+	if _, err := fs.List(); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	changes := make(chan Change)
+	go fs.watch(ctx, watcher, changes)
+	return changes, nil
+}
+
+// Watch creates the root directory if necessary, so blueprints saved later on are reported as well
+func (fs *WritableFileSystem) Watch(ctx context.Context) (<-chan Change, error) {
+	if _, err := utils.EnsureDirExists(fs.root); err != nil {
+		return nil, err
+	}
+	return fs.FileSystem.Watch(ctx)
+}
+
+func (fs *FileSystem) watch(ctx context.Context, watcher *fsnotify.Watcher, changes chan Change) {
+	defer close(changes)
+	defer watcher.Close()
+
+	pending := make(map[string]bool)
+	var timer <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(event.Name)
+			if strings.HasPrefix(name, ".") || !fs.hasSupportedSuffix(name) {
+				continue
+			}
+			pending[filepath.Clean(event.Name)] = true
+			timer = time.After(WatchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watching %s: %s", fs.root, err)
+		case <-timer:
+			timer = nil
+			for _, c := range fs.refresh(pending) {
+				select {
+				case changes <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// refresh drops the changed files from the cache and tells which blueprints have changed
+func (fs *FileSystem) refresh(files map[string]bool) []Change {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	changes := make([]Change, 0)
+	for path := range files {
+		oldId, known := fs.paths[path]
+		if known {
+			delete(fs.cache, oldId)
+		}
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if known {
+				delete(fs.paths, path)
+				changes = append(changes, Change{BlueprintRemoved, oldId})
+			}
+			continue
+		}
+
+		bp, err := fs.readBlueprintFile(path)
+		if bp == nil {
+			// Not readable (yet), report it so clients can show the problem
+			if known {
+				changes = append(changes, Change{BlueprintChanged, oldId})
+			} else {
+				log.Printf("cannot read file %s: %s", path, err)
+			}
+			continue
+		}
+
+		delete(fs.cache, bp.Id)
+		fs.paths[path] = bp.Id
+		if known && oldId == bp.Id {
+			changes = append(changes, Change{BlueprintChanged, bp.Id})
+			continue
+		}
+		if known {
+			changes = append(changes, Change{BlueprintRemoved, oldId})
+		}
+		changes = append(changes, Change{BlueprintAdded, bp.Id})
+	}
+
+	fs.uuids = nil
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Id.String() < changes[j].Id.String()
+	})
+	return changes
+}
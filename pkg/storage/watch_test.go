@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/tests/assertions"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBlueprintFile(t *testing.T, dir string, id uuid.UUID, name string) string {
+	file := filepath.Join(dir, id.String()+".yaml")
+	content := "id: " + id.String() + "\nmeta:\n  name: " + name + "\n" +
+		"services:\n  main:\n    in:\n      type: trigger\n    out:\n      type: trigger\n" +
+		"connections:\n  (:\n  - )\n"
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file
+}
+
+func nextChange(t *testing.T, changes <-chan Change) Change {
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+	return Change{}
+}
+
+func Test_FileSystem_Watch(t *testing.T) {
+	a := assertions.New(t)
+	dir, err := ioutil.TempDir("", "slang-watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	WatchDelay = 50 * time.Millisecond
+	fs := NewReadOnlyFileSystem(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := fs.Watch(ctx)
+	require.NoError(t, err)
+
+	id := uuid.New()
+	file := writeBlueprintFile(t, dir, id, "first")
+	a.Equal(Change{BlueprintAdded, id}, nextChange(t, changes))
+
+	bp, err := fs.Load(id)
+	a.NoError(err)
+	a.Equal("first", bp.Meta.Name)
+
+	writeBlueprintFile(t, dir, id, "second")
+	a.Equal(Change{BlueprintChanged, id}, nextChange(t, changes))
+
+	// The cache has been invalidated
+	bp, err = fs.Load(id)
+	a.NoError(err)
+	a.Equal("second", bp.Meta.Name)
+
+	require.NoError(t, os.Remove(file))
+	a.Equal(Change{BlueprintRemoved, id}, nextChange(t, changes))
+	a.False(fs.Has(id))
+
+	cancel()
+	_, open := <-changes
+	a.False(open)
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeComponentArchive writes COMPONENT-VERSION.zip holding the file in a top-level directory like GitHub
+// archives, it returns the checksum of the archive
+func writeComponentArchive(t *testing.T, dir string, component string, version string, file string, content string) string {
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.zip", component, version))
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(out)
+	f, err := w.Create(component + "/" + file)
+	require.NoError(t, err)
+	f.Write([]byte(content))
+	require.NoError(t, w.Close())
+	require.NoError(t, out.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestComponentLoader_Directory_Source(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slang-components")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "source")
+	require.NoError(t, os.MkdirAll(src, os.ModePerm))
+	lib := filepath.Join(dir, "lib")
+
+	writeComponentArchive(t, src, "slang-lib", "1.0.0", "a.yaml", "first")
+	sum := writeComponentArchive(t, src, "slang-lib", "1.1.0", "a.yaml", "second")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "slang-lib-1.1.0.zip.sha256"), []byte(sum+"  slang-lib-1.1.0.zip\n"), os.ModePerm))
+
+	source, err := daemon.ParseComponentSource("file://" + src)
+	require.NoError(t, err)
+	dl := daemon.NewComponentLoader("slang-lib", lib, source)
+	require.NoError(t, dl.Err())
+	assert.True(t, dl.NewerVersionExists())
+	require.NoError(t, dl.Load())
+	assert.Equal(t, "1.1.0", dl.GetLocalReleaseVersion().String())
+	content, err := ioutil.ReadFile(filepath.Join(lib, "a.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+	assert.False(t, daemon.NewComponentLoader("slang-lib", lib, source).NewerVersionExists())
+
+	// A newer archive not matching its checksum is not installed
+	writeComponentArchive(t, src, "slang-lib", "1.2.0", "a.yaml", "third")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "slang-lib-1.2.0.zip.sha256"), []byte(sum), os.ModePerm))
+	dl = daemon.NewComponentLoader("slang-lib", lib, source)
+	assert.Error(t, dl.Load())
+	content, _ = ioutil.ReadFile(filepath.Join(lib, "a.yaml"))
+	assert.Equal(t, "second", string(content))
+
+	// A newer archive without checksum is installed unverified unless checksums are required
+	writeComponentArchive(t, src, "slang-lib", "1.3.0", "a.yaml", "fourth")
+	dl = daemon.NewComponentLoader("slang-lib", lib, source).SetRequireChecksum(true)
+	assert.Error(t, dl.Load())
+	content, _ = ioutil.ReadFile(filepath.Join(lib, "a.yaml"))
+	assert.Equal(t, "second", string(content))
+	dl = daemon.NewComponentLoader("slang-lib", lib, source)
+	require.NoError(t, dl.Load())
+	content, _ = ioutil.ReadFile(filepath.Join(lib, "a.yaml"))
+	assert.Equal(t, "fourth", string(content))
+
+	// Without a source the loader reports why
+	source, err = daemon.ParseComponentSource(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	dl = daemon.NewComponentLoader("slang-lib", lib, source)
+	assert.Error(t, dl.Err())
+	assert.False(t, dl.NewerVersionExists())
+}
+
+func TestComponentLoader_Mirror_Source_And_Rollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slang-components")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	mirror := filepath.Join(dir, "mirror")
+	require.NoError(t, os.MkdirAll(filepath.Join(mirror, "archives"), os.ModePerm))
+	ui := filepath.Join(dir, "ui")
+
+	sum := writeComponentArchive(t, filepath.Join(mirror, "archives"), "slang-ui", "2.0.0", "index.html", "v2")
+	index := fmt.Sprintf(`{"version": "v2.0.0", "archive": "archives/slang-ui-2.0.0.zip", "sha256": "%s"}`, sum)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(mirror, "slang-ui.json"), []byte(index), os.ModePerm))
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+
+	require.NoError(t, os.MkdirAll(ui, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(ui, "index.html"), []byte("v1"), os.ModePerm))
+
+	source, err := daemon.ParseComponentSource(server.URL)
+	require.NoError(t, err)
+	dl := daemon.NewComponentLoader("slang-ui", ui, source)
+	require.NoError(t, dl.Load())
+	content, _ := ioutil.ReadFile(filepath.Join(ui, "index.html"))
+	assert.Equal(t, "v2", string(content))
+
+	require.NoError(t, dl.Rollback())
+	content, _ = ioutil.ReadFile(filepath.Join(ui, "index.html"))
+	assert.Equal(t, "v1", string(content))
+}
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Bitspark/slang/pkg/core"
 	"github.com/Bitspark/slang/tests/assertions"
@@ -122,3 +124,46 @@ func TestOperator_Compile__NestedChildren(t *testing.T) {
 	a.False(op3.Main().In().Connected(op6.Main().In()))
 	a.False(op6.Main().Out().Connected(op3.Main().Out()))
 }
+
+func TestOperator_Stop__FullBuffer(t *testing.T) {
+	a := assertions.New(t)
+	defer func(size int) { core.CHANNEL_SIZE = size }(core.CHANNEL_SIZE)
+	core.CHANNEL_SIZE = 4
+
+	op, _ := core.NewOperator("", nil, nil, nil, nil, core.Blueprint{ServiceDefs: map[string]*core.ServiceDef{core.MAIN_SERVICE: {In: core.TypeDef{Type: "number"}, Out: core.TypeDef{Type: "number"}}}})
+	a.NoError(op.Main().In().Connect(op.Main().Out()))
+	op.Main().Out().Bufferize()
+	op.Start()
+
+	// Nobody pulls, so pushing blocks as soon as the buffer is full
+	var pushing sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		pushing.Add(1)
+		go func() {
+			defer pushing.Done()
+			for j := 0; j < 10; j++ {
+				op.Main().In().Push(j)
+				op.Main().Out().Closed()
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan bool)
+	go func() {
+		op.Stop()
+		pushing.Wait()
+		stopped <- true
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopping the operator blocked")
+	}
+
+	a.True(op.Main().Out().Closed())
+	for i := 0; i < 4; i++ {
+		a.NotNil(op.Main().Out().Pull())
+	}
+	a.Nil(op.Main().Out().Pull())
+}
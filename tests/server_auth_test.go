@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const aliceToken = "alice-token"
+
+// newAuthTestServer serves with the users alice (password and token), bob (password) and admin (password)
+func newAuthTestServer(t *testing.T) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "slang-auth")
+	require.NoError(t, err)
+
+	hash := func(password string) string {
+		h, err := daemon.HashPassword(password)
+		require.NoError(t, err)
+		return h
+	}
+	users := fmt.Sprintf(`users:
+- name: alice
+  password: %s
+  tokens: [%s]
+- name: bob
+  password: %s
+- name: admin
+  password: %s
+  admin: true
+`, hash("alice"), daemon.HashToken(aliceToken), hash("bob"), hash("admin"))
+	usersFile := filepath.Join(dir, "users.yaml")
+	require.NoError(t, ioutil.WriteFile(usersFile, []byte(users), 0644))
+
+	uf, err := daemon.LoadUserFile(usersFile)
+	require.NoError(t, err)
+
+	st := storage.NewStorage().
+		AddBackend(storage.NewWritableFileSystem(filepath.Join(dir, "local"))).
+		AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.EnableAuth(uf, filepath.Join(dir, "owners.json")))
+	return httptest.NewServer(s.Handler()), dir
+}
+
+func getResponseAs(t *testing.T, server *httptest.Server, user string, method string, url string, body interface{}) *http.Response {
+	b, _ := json.Marshal(body)
+	request, _ := http.NewRequest(method, server.URL+url, bytes.NewReader(b))
+	request.SetBasicAuth(user, user)
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestServer_Auth_Rejects_Missing_Or_Invalid_Credentials(t *testing.T) {
+	server, dir := newAuthTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	response := getResponse(t, server, "GET", "/instances/", nil)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, _ := http.NewRequest("GET", server.URL+"/instances/", nil)
+	request.SetBasicAuth("alice", "wrong")
+	response, _ = server.Client().Do(request)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	request, _ = http.NewRequest("GET", server.URL+"/instances/", nil)
+	request.Header.Set("Authorization", "Bearer "+aliceToken)
+	response, _ = server.Client().Do(request)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// Query tokens are only accepted by the websocket
+	response = getResponse(t, server, "GET", "/instances/?token="+aliceToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	response = getResponseAs(t, server, "alice", "GET", "/instances/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestServer_Auth_Instances_Belong_To_Their_Owner(t *testing.T) {
+	server, dir := newAuthTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	response := getResponseAs(t, server, "alice", "POST", "/run/", daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}})
+	var rs daemon.RunState
+	json.NewDecoder(response.Body).Decode(&rs)
+	assert.Equal(t, "success", rs.Status)
+
+	listAs := func(user string) []instanceJSON {
+		var instances []instanceJSON
+		json.NewDecoder(getResponseAs(t, server, user, "GET", "/instances/", nil).Body).Decode(&instances)
+		return instances
+	}
+	assert.Len(t, listAs("alice"), 1)
+	assert.Len(t, listAs("bob"), 0)
+	assert.Len(t, listAs("admin"), 1)
+
+	input := map[string]interface{}{"input": "hello"}
+	response = getResponseAs(t, server, "bob", "POST", rs.URL+"?wait=true", input)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	response = getResponseAs(t, server, "bob", "POST", rs.URL+"stop", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = getResponseAs(t, server, "alice", "POST", rs.URL+"?wait=true", input)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponseAs(t, server, "admin", "POST", rs.URL+"stop", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestServer_Auth_Websocket_Only_Receives_Own_Outputs(t *testing.T) {
+	server, dir := newAuthTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	wsurl := fmt.Sprintf("ws://%s/ws?token=%s", server.Listener.Addr().String(), aliceToken)
+	wsc, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	ri := daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}}
+	var bobs, alices daemon.RunState
+	json.NewDecoder(getResponseAs(t, server, "bob", "POST", "/run/", ri).Body).Decode(&bobs)
+	json.NewDecoder(getResponseAs(t, server, "alice", "POST", "/run/", ri).Body).Decode(&alices)
+
+	getResponseAs(t, server, "bob", "POST", bobs.URL+"?wait=true", map[string]interface{}{"input": "bob"})
+	getResponseAs(t, server, "alice", "POST", alices.URL+"?wait=true", map[string]interface{}{"input": "alice"})
+
+	out := readUntil(t, wsc, "Port", 1)
+	assert.Equal(t, "alice", out[0].Payload.(map[string]interface{})["data"])
+
+	// Instances of other users cannot be subscribed to
+	wsc.WriteJSON(map[string]interface{}{"type": "subscribe", "handle": bobs.Handle})
+	reply := readUntil(t, wsc, "Reply", 1)
+	assert.Contains(t, reply[0].Payload, "error")
+}
+
+func TestServer_Auth_Blueprints_Can_Only_Be_Changed_By_Their_Owner(t *testing.T) {
+	server, dir := newAuthTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	response := getResponseAs(t, server, "alice", "GET", "/operator/", nil)
+	var operators struct {
+		Objects []struct {
+			Def core.Blueprint `json:"def"`
+		} `json:"objects"`
+	}
+	json.NewDecoder(response.Body).Decode(&operators)
+	var bp core.Blueprint
+	for _, obj := range operators.Objects {
+		if obj.Def.Id == fixtureOperatorId {
+			bp = obj.Def
+		}
+	}
+	require.Equal(t, fixtureOperatorId, bp.Id)
+
+	// Library blueprints cannot be shadowed by users
+	response = getResponseAs(t, server, "alice", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	bp.Id = uuid.New()
+	response = getResponseAs(t, server, "alice", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response = getResponseAs(t, server, "bob", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	response = getResponseAs(t, server, "alice", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response = getResponseAs(t, server, "admin", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	owners, err := ioutil.ReadFile(filepath.Join(dir, "owners.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"%s": "alice"}`, bp.Id), string(owners))
+}
+
+func TestServer_Auth_Blueprint_Events_Are_Sent_To_Their_Owner(t *testing.T) {
+	server, dir := newAuthTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	wsurl := fmt.Sprintf("ws://%s/ws?token=%s", server.Listener.Addr().String(), aliceToken)
+	wsc, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+	require.NoError(t, err)
+	defer wsc.Close()
+
+	bobs := fixtureCopy(t, "Bob's")
+	require.Equal(t, http.StatusOK, getResponseAs(t, server, "bob", "POST", "/operator/def/", bobs).StatusCode)
+	require.Equal(t, http.StatusOK, getResponseAs(t, server, "bob", "DELETE", "/operator/"+bobs.Id.String()+"/", nil).StatusCode)
+
+	alices := fixtureCopy(t, "Alice's")
+	require.Equal(t, http.StatusOK, getResponseAs(t, server, "alice", "POST", "/operator/def/", alices).StatusCode)
+	require.Equal(t, http.StatusOK, getResponseAs(t, server, "alice", "DELETE", "/operator/"+alices.Id.String()+"/", nil).StatusCode)
+
+	// The first event alice receives is about her own blueprint
+	out := readUntil(t, wsc, "Operator", 1)
+	assert.Equal(t, alices.Id.String(), out[0].Payload.(map[string]interface{})["id"])
+}
@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type operatorsJSON struct {
+	Objects []struct {
+		Def  core.Blueprint `json:"def"`
+		Type string         `json:"type"`
+	} `json:"objects"`
+	Total int `json:"total"`
+}
+
+func fixtureCopy(t *testing.T, name string, tags ...string) *core.Blueprint {
+	st := storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	bp, err := st.Load(fixtureOperatorId)
+	require.NoError(t, err)
+	bp.Id = uuid.New()
+	bp.Meta.Name = name
+	bp.Meta.Tags = tags
+	return bp
+}
+
+func TestServer_Definitions_Get_Put_Delete(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	bp := fixtureCopy(t, "Echo")
+	url := fmt.Sprintf("/operator/%s/", bp.Id)
+
+	response := getResponseIn(t, server, "", "GET", url, nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = getResponseIn(t, server, "", "PUT", url, bp)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var out struct {
+		Data struct {
+			Def  core.Blueprint `json:"def"`
+			Type string         `json:"type"`
+		} `json:"data"`
+	}
+	response = getResponseIn(t, server, "", "GET", url, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&out)
+	assert.Equal(t, "Echo", out.Data.Def.Meta.Name)
+	assert.Equal(t, "local", out.Data.Type)
+
+	other := fixtureCopy(t, "Other")
+	response = getResponseIn(t, server, "", "PUT", url, other)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response = getResponseIn(t, server, "", "DELETE", fmt.Sprintf("/operator/%s/", fixtureOperatorId), nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response = getResponseIn(t, server, "", "DELETE", url, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponseIn(t, server, "", "GET", url, nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestServer_Definitions_Filter_And_Page(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	for i, tag := range []string{"alpha", "beta", "alpha"} {
+		bp := fixtureCopy(t, fmt.Sprintf("Tagged %d", i), tag)
+		getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+	}
+
+	query := func(q string) operatorsJSON {
+		var ops operatorsJSON
+		json.NewDecoder(getResponseIn(t, server, "", "GET", "/operator/?"+q, nil).Body).Decode(&ops)
+		return ops
+	}
+
+	ops := query("type=local&tag=alpha")
+	assert.Equal(t, 2, ops.Total)
+
+	ops = query("type=local&q=tagged&limit=2")
+	assert.Equal(t, 3, ops.Total)
+	assert.Len(t, ops.Objects, 2)
+	next := query("type=local&q=tagged&limit=2&offset=2")
+	assert.Len(t, next.Objects, 1)
+	assert.NotEqual(t, ops.Objects[0].Def.Id, next.Objects[0].Def.Id)
+	assert.NotEqual(t, ops.Objects[1].Def.Id, next.Objects[0].Def.Id)
+
+	ops = query("type=library")
+	assert.Equal(t, 1, ops.Total)
+	assert.Equal(t, fixtureOperatorId, ops.Objects[0].Def.Id)
+}
+
+func TestServer_Definitions_Dependencies_And_Validation(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	user := fixtureCopy(t, "User")
+	user.InstanceDefs = core.InstanceDefList{&core.InstanceDef{Name: "echo", Operator: fixtureOperatorId}}
+	user.Connections = map[string][]string{"(": {"(echo"}, "echo)": {")"}}
+
+	var validation struct {
+		Data struct {
+			Valid       bool          `json:"valid"`
+			Diagnostics []interface{} `json:"diagnostics"`
+		} `json:"data"`
+	}
+	response := getResponseIn(t, server, "", "POST", "/operator/def/?validate=true", user)
+	json.NewDecoder(response.Body).Decode(&validation)
+	assert.True(t, validation.Data.Valid)
+	response = getResponseIn(t, server, "", "GET", fmt.Sprintf("/operator/%s/", user.Id), nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode, "validation must not save")
+
+	broken := fixtureCopy(t, "Broken")
+	broken.InstanceDefs = append(broken.InstanceDefs, &core.InstanceDef{Name: "missing", Operator: uuid.New()})
+	response = getResponseIn(t, server, "", "POST", "/operator/def/?validate=true", broken)
+	json.NewDecoder(response.Body).Decode(&validation)
+	assert.False(t, validation.Data.Valid)
+	assert.NotEmpty(t, validation.Data.Diagnostics)
+
+	getResponseIn(t, server, "", "POST", "/operator/def/", user)
+
+	var refs struct {
+		Data []struct {
+			Id uuid.UUID `json:"id"`
+		} `json:"data"`
+	}
+	response = getResponseIn(t, server, "", "GET", fmt.Sprintf("/operator/%s/dependents/", fixtureOperatorId), nil)
+	json.NewDecoder(response.Body).Decode(&refs)
+	require.Len(t, refs.Data, 1)
+	assert.Equal(t, user.Id, refs.Data[0].Id)
+
+	response = getResponseIn(t, server, "", "GET", fmt.Sprintf("/operator/%s/dependencies/", user.Id), nil)
+	json.NewDecoder(response.Body).Decode(&refs)
+	require.Len(t, refs.Data, 1)
+	assert.Equal(t, fixtureOperatorId, refs.Data[0].Id)
+}
+
+func TestServer_Definitions_Delete_Move_Copy_Duplicate(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	response := getResponseIn(t, server, "", "POST", "/workspaces/", map[string]string{"name": "project-a"})
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	used := fixtureCopy(t, "Used")
+	user := fixtureCopy(t, "User")
+	user.InstanceDefs = core.InstanceDefList{&core.InstanceDef{Name: "used", Operator: used.Id}}
+	user.Connections = map[string][]string{"(": {"(used"}, "used)": {")"}}
+	getResponseIn(t, server, "", "POST", "/operator/def/", used)
+	getResponseIn(t, server, "", "POST", "/operator/def/", user)
+
+	// Blueprints in use are only deleted or moved when forced
+	usedUrl := fmt.Sprintf("/operator/%s/", used.Id)
+	response = getResponseIn(t, server, "", "DELETE", usedUrl, nil)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	response = getResponseIn(t, server, "", "POST", usedUrl+"move", map[string]string{"workspace": "project-a"})
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	// Copying needs the blueprints it uses in the target
+	response = getResponseIn(t, server, "", "POST", fmt.Sprintf("/operator/%s/copy", user.Id), map[string]string{"workspace": "project-a"})
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	response = getResponseIn(t, server, "", "POST", usedUrl+"copy", map[string]string{"workspace": "project-a"})
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponseIn(t, server, "", "POST", fmt.Sprintf("/operator/%s/move", user.Id), map[string]string{"workspace": "project-a"})
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.ElementsMatch(t, []uuid.UUID{used.Id, user.Id}, localBlueprintIds(t, server, "project-a"))
+	assert.Equal(t, []uuid.UUID{used.Id}, localBlueprintIds(t, server, ""))
+
+	response = getResponseIn(t, server, "", "DELETE", usedUrl, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponseIn(t, server, "project-a", "DELETE", usedUrl+"?force=true", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var out struct {
+		Data struct {
+			Def core.Blueprint `json:"def"`
+		} `json:"data"`
+	}
+	response = getResponseIn(t, server, "project-a", "POST", fmt.Sprintf("/operator/%s/duplicate", user.Id), nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&out)
+	assert.NotEqual(t, user.Id, out.Data.Def.Id)
+	assert.Equal(t, "User copy", out.Data.Def.Meta.Name)
+	assert.ElementsMatch(t, []uuid.UUID{user.Id, out.Data.Def.Id}, localBlueprintIds(t, server, "project-a"))
+}
+
+func TestServer_Definitions_Conflicts(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	var out struct {
+		Data []storage.Conflict `json:"data"`
+	}
+	json.NewDecoder(getResponseIn(t, server, "", "GET", "/operator/conflicts/", nil).Body).Decode(&out)
+	assert.Empty(t, out.Data)
+
+	// The same blueprint with different content locally and in the library
+	bp := fixtureCopy(t, "Changed locally")
+	bp.Id = fixtureOperatorId
+	getResponseIn(t, server, "", "PUT", fmt.Sprintf("/operator/%s/", bp.Id), bp)
+
+	json.NewDecoder(getResponseIn(t, server, "", "GET", "/operator/conflicts/", nil).Body).Decode(&out)
+	require.Len(t, out.Data, 1)
+	assert.Equal(t, fixtureOperatorId, out.Data[0].Id)
+	assert.Len(t, out.Data[0].Versions, 2)
+	assert.Equal(t, "Changed locally", out.Data[0].Versions[0].Name)
+	assert.True(t, out.Data[0].Versions[0].Selected)
+}
+
+func TestServer_Definitions_Delete_Notifies_Clients(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	bp := fixtureCopy(t, "Deleted")
+	response := getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+	var status map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&status)
+	assert.Equal(t, map[string]interface{}{"status": "success"}, status)
+
+	wsc := newWebsocketClient(t, server)
+	defer wsc.Close()
+
+	response = getResponseIn(t, server, "", "DELETE", fmt.Sprintf("/operator/%s/", bp.Id), nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	status = nil
+	json.NewDecoder(response.Body).Decode(&status)
+	assert.Equal(t, map[string]interface{}{"status": "success"}, status)
+
+	out := readUntil(t, wsc, "Operator", 1)
+	assert.Equal(t, map[string]interface{}{"kind": "removed", "id": bp.Id.String(), "workspace": "default"}, out[0].Payload)
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHistoryTestServer serves blueprints from a git repository with the users alice and bob
+func newHistoryTestServer(t *testing.T) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "slang-history")
+	require.NoError(t, err)
+
+	hash, err := daemon.HashPassword("alice")
+	require.NoError(t, err)
+	bobHash, err := daemon.HashPassword("bob")
+	require.NoError(t, err)
+	users := fmt.Sprintf("users:\n- name: alice\n  email: alice@example.com\n  password: %s\n- name: bob\n  password: %s\n", hash, bobHash)
+	usersFile := filepath.Join(dir, "users.yaml")
+	require.NoError(t, ioutil.WriteFile(usersFile, []byte(users), 0644))
+	uf, err := daemon.LoadUserFile(usersFile)
+	require.NoError(t, err)
+
+	repo, err := storage.NewGitRepository(filepath.Join(dir, "projects"), storage.DefaultGitAuthor)
+	require.NoError(t, err)
+	st := storage.NewStorage().AddBackend(repo)
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.EnableAuth(uf, filepath.Join(dir, "owners.json")))
+	return httptest.NewServer(s.Handler()), dir
+}
+
+type revisionJSON struct {
+	Hash   string            `json:"hash"`
+	Author storage.GitAuthor `json:"author"`
+}
+
+func blueprintHistory(t *testing.T, server *httptest.Server, id uuid.UUID) []revisionJSON {
+	var history struct {
+		Data []revisionJSON `json:"data"`
+	}
+	response := getResponseAs(t, server, "alice", "GET", "/operator/"+id.String()+"/history/", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&history)
+	return history.Data
+}
+
+func TestServer_History_Is_Committed_By_The_User(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	server, dir := newHistoryTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	bp := core.Blueprint{
+		Id:   uuid.New(),
+		Meta: core.BlueprintMetaDef{Name: "First"},
+		ServiceDefs: map[string]*core.ServiceDef{
+			core.MAIN_SERVICE: {In: core.TypeDef{Type: "trigger"}, Out: core.TypeDef{Type: "trigger"}},
+		},
+		Connections: map[string][]string{"(": {")"}},
+	}
+	response := getResponseAs(t, server, "alice", "POST", "/operator/def/", bp)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	bp.Meta.Name = "Second"
+	response = getResponseAs(t, server, "alice", "POST", "/operator/def/", bp)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	history := blueprintHistory(t, server, bp.Id)
+	require.Len(t, history, 2)
+	assert.Equal(t, storage.GitAuthor{Name: "alice", Email: "alice@example.com"}, history[0].Author)
+
+	var revision struct {
+		Data struct {
+			Def core.Blueprint `json:"def"`
+		} `json:"data"`
+	}
+	response = getResponseAs(t, server, "alice", "GET", "/operator/"+bp.Id.String()+"/history/"+history[1].Hash+"/", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&revision)
+	assert.Equal(t, "First", revision.Data.Def.Meta.Name)
+
+	response = getResponseAs(t, server, "alice", "GET", "/operator/"+bp.Id.String()+"/history/unknown/", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	// Only the owner may revert
+	revertURL := "/operator/" + bp.Id.String() + "/history/" + history[1].Hash + "/revert"
+	response = getResponseAs(t, server, "bob", "POST", revertURL, nil)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	response = getResponseAs(t, server, "alice", "POST", revertURL, nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	history = blueprintHistory(t, server, bp.Id)
+	require.Len(t, history, 3)
+	assert.Equal(t, "alice", history[0].Author.Name)
+	var loaded struct {
+		Data struct {
+			Def core.Blueprint `json:"def"`
+		} `json:"data"`
+	}
+	response = getResponseAs(t, server, "alice", "GET", "/operator/"+bp.Id.String()+"/", nil)
+	json.NewDecoder(response.Body).Decode(&loaded)
+	assert.Equal(t, "First", loaded.Data.Def.Meta.Name)
+}
+
+func TestServer_History_Requires_Git(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	response := getResponse(t, server, "GET", "/operator/"+fixtureOperatorId.String()+"/history/", nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests are meant to be run with -race
+
+var fixtureOperatorId = uuid.MustParse("3ceccd71-0ea5-4aeb-957a-4dff1a419071")
+
+type instanceJSON struct {
+	Handle string `json:"handle"`
+	State  string `json:"state"`
+}
+
+func listInstances(t *testing.T, server *httptest.Server) []instanceJSON {
+	var instances []instanceJSON
+	response := getResponse(t, server, "GET", "/instances/", nil)
+	if err := json.NewDecoder(response.Body).Decode(&instances); err != nil {
+		t.Fatal(err)
+	}
+	return instances
+}
+
+func stopInstance(t *testing.T, server *httptest.Server, handle string, keep bool) *http.Response {
+	instruction := map[string]interface{}{"handle": handle}
+	if keep {
+		instruction["keep"] = true
+	}
+	body, _ := json.Marshal(instruction)
+	return getResponse(t, server, "DELETE", "/run/", bytes.NewBuffer(body))
+}
+
+func TestServer_Instances_Concurrent_Start_Stop_List(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	const n = 20
+	handles := make(chan string, n)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rs := startOperator(t, server, daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}})
+			handles <- rs.Handle
+		}()
+		go func() {
+			defer wg.Done()
+			listInstances(t, server)
+		}()
+	}
+	wg.Wait()
+	close(handles)
+
+	unique := make(map[string]bool)
+	for handle := range handles {
+		unique[handle] = true
+	}
+	assert.Len(t, unique, n)
+	assert.Len(t, listInstances(t, server), n)
+
+	// Push into, stop and list the instances at the same time
+	for handle := range unique {
+		wg.Add(3)
+		go func(handle string) {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]interface{}{"input": "race"})
+			getResponse(t, server, "POST", "/instance/"+handle+"/", bytes.NewBuffer(body))
+		}(handle)
+		go func(handle string) {
+			defer wg.Done()
+			assert.Equal(t, 200, stopInstance(t, server, handle, true).StatusCode)
+		}(handle)
+		go func() {
+			defer wg.Done()
+			listInstances(t, server)
+		}()
+	}
+	wg.Wait()
+
+	for _, ins := range listInstances(t, server) {
+		assert.Equal(t, "stopped", ins.State)
+	}
+}
+
+func TestServer_Instance_Lifecycle(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	rs := startOperator(t, server, daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}})
+	instanceURL := "/instance/" + rs.Handle + "/"
+
+	// A running instance cannot be started again
+	response := getResponse(t, server, "POST", instanceURL+"start", nil)
+	assert.Equal(t, 400, response.StatusCode)
+
+	response = getResponse(t, server, "POST", instanceURL+"stop", nil)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, _ := json.Marshal(map[string]interface{}{"input": "stopped"})
+	response = getResponse(t, server, "POST", instanceURL, bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	// Restarting keeps the handle
+	response = getResponse(t, server, "POST", instanceURL+"start", nil)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, _ = json.Marshal(map[string]interface{}{"input": "restarted"})
+	response = getResponse(t, server, "POST", instanceURL+"?wait=true", bytes.NewBuffer(body))
+	assert.Equal(t, 200, response.StatusCode)
+	out, _ := ioutil.ReadAll(response.Body)
+	assert.JSONEq(t, `{"output":"restarted"}`, string(out))
+
+	stopInstance(t, server, rs.Handle, false)
+	response = getResponse(t, server, "GET", instanceURL, nil)
+	assert.Equal(t, 404, response.StatusCode)
+}
+
+func TestServer_Instance_Concurrent_Pushes_Receive_Own_Outputs(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	rs := startOperator(t, server, daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(input string) {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]interface{}{"input": input})
+			response := getResponse(t, server, "POST", "/instance/"+rs.Handle+"/?wait=true", bytes.NewBuffer(body))
+			var out map[string]interface{}
+			json.NewDecoder(response.Body).Decode(&out)
+			assert.Equal(t, input, out["output"])
+		}(uuid.New().String())
+	}
+	wg.Wait()
+}
+
+func TestServer_Instance_Hot_Reload_Keeps_Handle(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	bp := fixtureCopy(t, "Reloaded")
+	bp.InstanceDefs[0].Properties = core.Properties{"expression": "a", "variables": []interface{}{"a"}}
+	getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+
+	rs := startOperator(t, server, daemon.RunInstruction{Id: bp.Id, Props: core.Properties{}, Gens: core.Generics{}, HotReload: true})
+	push := func() interface{} {
+		var out map[string]interface{}
+		response := getResponse(t, server, "POST", rs.URL+"?wait=true", bytes.NewBufferString(`{"input": 1}`))
+		json.NewDecoder(response.Body).Decode(&out)
+		return out["output"]
+	}
+	assert.Equal(t, 1.0, push())
+
+	bp.InstanceDefs[0].Properties["expression"] = "a + 1"
+	getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+	assert.Equal(t, 2.0, push())
+
+	// A version which cannot be built leaves the running instance alone
+	bp.InstanceDefs[0].Operator = uuid.New()
+	getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+	assert.Equal(t, 2.0, push())
+
+	var info struct {
+		Handle      string `json:"handle"`
+		State       string `json:"state"`
+		ReloadError string `json:"reloadError"`
+	}
+	json.NewDecoder(getResponse(t, server, "GET", rs.URL, nil).Body).Decode(&info)
+	assert.Equal(t, rs.Handle, info.Handle)
+	assert.Equal(t, "running", info.State)
+	assert.NotEmpty(t, info.ReloadError)
+
+	response := getResponse(t, server, "POST", rs.URL+"reload", nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type runJSON struct {
+	Id          string `json:"id"`
+	Handle      string `json:"handle"`
+	Status      string `json:"status"`
+	InputCount  int    `json:"inputCount"`
+	OutputCount int    `json:"outputCount"`
+	Inputs      []struct {
+		Data interface{} `json:"data"`
+	} `json:"inputs"`
+	Outputs []struct {
+		Port string      `json:"port"`
+		Data interface{} `json:"data"`
+	} `json:"outputs"`
+}
+
+func newRunsTestServer(t *testing.T, dir string, retention daemon.RunRetention) *httptest.Server {
+	st := storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.LoadRuns(dir, retention))
+	return httptest.NewServer(s.Handler())
+}
+
+func listRuns(t *testing.T, server *httptest.Server) []runJSON {
+	var runs []runJSON
+	json.NewDecoder(getResponse(t, server, "GET", "/runs/", nil).Body).Decode(&runs)
+	return runs
+}
+
+func TestServer_Runs_Are_Recorded_And_Retained(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "slang-runs")
+	defer os.RemoveAll(dir)
+	server := newRunsTestServer(t, dir, daemon.RunRetention{MaxRuns: 1})
+	defer server.Close()
+
+	ri := daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}}
+	rs := startOperator(t, server, ri)
+	getResponse(t, server, "POST", rs.URL+"?wait=true", bytes.NewBufferString(`{"input": "recorded"}`))
+
+	runs := listRuns(t, server)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "running", runs[0].Status)
+
+	stopInstance(t, server, rs.Handle, true)
+	runs = listRuns(t, server)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "stopped", runs[0].Status)
+	assert.Equal(t, rs.Handle, runs[0].Handle)
+	assert.Equal(t, 1, runs[0].InputCount)
+	assert.Equal(t, 1, runs[0].OutputCount)
+	first := runs[0].Id
+
+	// Finished runs are read from the directory
+	server.Close()
+	server = newRunsTestServer(t, dir, daemon.RunRetention{MaxRuns: 1})
+	defer server.Close()
+
+	var run runJSON
+	response := getResponse(t, server, "GET", "/runs/"+first+"/download", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, response.Header.Get("Content-Disposition"), "attachment")
+	json.NewDecoder(response.Body).Decode(&run)
+	require.Len(t, run.Inputs, 1)
+	require.Len(t, run.Outputs, 1)
+	assert.Equal(t, map[string]interface{}{"input": "recorded"}, run.Inputs[0].Data)
+	assert.Equal(t, ")output", run.Outputs[0].Port)
+	assert.Equal(t, "recorded", run.Outputs[0].Data)
+
+	// Only the most recent run is kept
+	rs = startOperator(t, server, ri)
+	stopInstance(t, server, rs.Handle, false)
+	runs = listRuns(t, server)
+	require.Len(t, runs, 1)
+	assert.NotEqual(t, first, runs[0].Id)
+	_, err := os.Stat(filepath.Join(dir, first+".json"))
+	assert.True(t, os.IsNotExist(err))
+
+	response = getResponse(t, server, "GET", "/runs/"+first+"/", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestServer_Runs_Count_Items_Beyond_Limit(t *testing.T) {
+	defer func(max int) { daemon.MaxRunLogItems = max }(daemon.MaxRunLogItems)
+	daemon.MaxRunLogItems = 1
+
+	dir, _ := ioutil.TempDir("", "slang-runs")
+	defer os.RemoveAll(dir)
+	server := newRunsTestServer(t, dir, daemon.RunRetention{})
+	defer server.Close()
+
+	ri := daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}}
+	rs := startOperator(t, server, ri)
+	for i := 0; i < 3; i++ {
+		getResponse(t, server, "POST", rs.URL+"?wait=true", bytes.NewBufferString(`{"input": "counted"}`))
+	}
+	stopInstance(t, server, rs.Handle, false)
+
+	runs := listRuns(t, server)
+	require.Len(t, runs, 1)
+	var run runJSON
+	json.NewDecoder(getResponse(t, server, "GET", "/runs/"+runs[0].Id+"/", nil).Body).Decode(&run)
+	assert.Equal(t, 3, run.InputCount)
+	assert.Equal(t, 3, run.OutputCount)
+	assert.Len(t, run.Inputs, 1)
+	assert.Len(t, run.Outputs, 1)
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scheduledRunJSON struct {
+	Id       string      `json:"id"`
+	Handle   string      `json:"handle"`
+	Schedule string      `json:"schedule"`
+	Status   string      `json:"status"`
+	Output   interface{} `json:"output"`
+	Error    string      `json:"error"`
+	Stopped  *time.Time  `json:"stopped"`
+}
+
+func scheduledRuns(t *testing.T, server *httptest.Server, id string) []scheduledRunJSON {
+	var runs []scheduledRunJSON
+	response := getResponse(t, server, "GET", "/schedules/"+id+"/runs/", nil)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&runs)
+	return runs
+}
+
+func TestServer_Schedules_Run_Blueprint_And_Record_Runs(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	si := daemon.ScheduleInstruction{Id: fixtureOperatorId, Input: map[string]interface{}{"input": "tick"}, Cron: "invalid"}
+	body, _ := json.Marshal(si)
+	response := getResponse(t, server, "POST", "/schedules/", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	si.Cron = "@every 1s"
+	body, _ = json.Marshal(si)
+	var created struct {
+		Data struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	response = getResponse(t, server, "POST", "/schedules/", bytes.NewBuffer(body))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	json.NewDecoder(response.Body).Decode(&created)
+	id := created.Data.Id
+
+	var finished *scheduledRunJSON
+	for deadline := time.Now().Add(5 * time.Second); finished == nil && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		for _, run := range scheduledRuns(t, server, id) {
+			if run.Stopped != nil {
+				finished = &run
+				break
+			}
+		}
+	}
+	require.NotNil(t, finished)
+	assert.Equal(t, "success", finished.Status)
+	assert.Equal(t, map[string]interface{}{"output": "tick"}, finished.Output)
+	assert.Equal(t, id, finished.Schedule)
+
+	// Scheduled runs are recorded along with the runs of all other instances
+	var runs []scheduledRunJSON
+	json.NewDecoder(getResponse(t, server, "GET", "/runs/?schedule="+id, nil).Body).Decode(&runs)
+	require.NotEmpty(t, runs)
+	found := false
+	for _, run := range runs {
+		assert.Equal(t, id, run.Schedule)
+		found = found || run.Id == finished.Id
+	}
+	assert.True(t, found)
+	var run runJSON
+	json.NewDecoder(getResponse(t, server, "GET", "/runs/"+finished.Id+"/", nil).Body).Decode(&run)
+	assert.Equal(t, 1, run.InputCount)
+
+	// The instance of a run is removed afterwards
+	for _, ins := range listInstances(t, server) {
+		assert.NotEqual(t, finished.Handle, ins.Handle)
+	}
+
+	response = getResponse(t, server, "DELETE", "/schedules/"+id+"/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponse(t, server, "GET", "/schedules/"+id+"/", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestServer_Schedules_Are_Restored(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "slang-schedules")
+	defer os.RemoveAll(dir)
+	registryFile := filepath.Join(dir, "schedules.json")
+
+	registry := []map[string]interface{}{{
+		"id":        "restored",
+		"owner":     "root",
+		"workspace": "default",
+		"operator":  fixtureOperatorId.String(),
+		"cron":      "@yearly",
+		"created":   time.Now(),
+	}}
+	b, _ := json.Marshal(registry)
+	ioutil.WriteFile(registryFile, b, 0644)
+
+	st := storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.LoadSchedules(registryFile))
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	var schedules []struct {
+		Id   string    `json:"id"`
+		Next time.Time `json:"next"`
+	}
+	json.NewDecoder(getResponse(t, server, "GET", "/schedules/", nil).Body).Decode(&schedules)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "restored", schedules[0].Id)
+	assert.True(t, schedules[0].Next.After(time.Now()))
+
+	assert.Empty(t, scheduledRuns(t, server, "restored"))
+}
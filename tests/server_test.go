@@ -8,8 +8,12 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,20 +32,28 @@ type message struct {
 }
 
 func newTestServer() *httptest.Server {
-	env := env.New("localhost", 8000)
 	// This storage allows us to load prebuilt operators for tests,
 	// it's also useful to have regressions there.
 	st := storage.NewStorage().
 		AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	return newTestServerWithStorage(st)
+}
 
+func newTestServerWithStorage(st *storage.Storage) *httptest.Server {
+	env := env.New("localhost", 8000)
 	ctx := daemon.SetStorage(context.Background(), st)
 	s := daemon.NewServer(&ctx, env)
 	return httptest.NewServer(s.Handler())
 }
 
 func newWebsocketClient(t *testing.T, server *httptest.Server) *websocket.Conn {
+	return newWebsocketClientIn(t, server, daemon.DefaultWorkspace)
+}
+
+// newWebsocketClientIn connects a client which selects the workspace
+func newWebsocketClientIn(t *testing.T, server *httptest.Server, workspace string) *websocket.Conn {
 	serverAddr := server.Listener.Addr().String()
-	wsurl := fmt.Sprintf("ws://%s%s", serverAddr, "/ws")
+	wsurl := fmt.Sprintf("ws://%s/ws?workspace=%s", serverAddr, workspace)
 	wsc, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
 	if err != nil {
 		t.Fatal(err)
@@ -168,6 +180,82 @@ func TestServer_Websocket_Messages_Are_Not_Collected_If_Sent_With_Time_InBetween
 	assert.Len(t, out, 1)
 }
 
+// readUntil reads messages from the websocket until n messages of the topic have been received
+func readUntil(t *testing.T, wsc *websocket.Conn, topic string, n int) []message {
+	var out []message
+	wsc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(out) < n {
+		for _, msg := range readOneMessage(t, wsc) {
+			if msg.Topic == topic {
+				out = append(out, msg)
+			}
+		}
+	}
+	return out
+}
+
+func TestServer_Websocket_Subscriptions_Filter_Outputs(t *testing.T) {
+	server := newTestServer()
+	wsc := newWebsocketClient(t, server)
+	defer wsc.Close()
+	defer server.Close()
+
+	ri := daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}}
+	subscribed := startOperator(t, server, ri)
+	other := startOperator(t, server, ri)
+
+	wsc.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "1", "handle": subscribed.Handle, "ports": []string{")output"}})
+	reply := readUntil(t, wsc, "Reply", 1)[0]
+	assert.Equal(t, map[string]interface{}{"id": "1", "type": "subscribe", "handle": subscribed.Handle}, reply.Payload)
+
+	body, _ := json.Marshal(map[string]interface{}{"input": "other"})
+	getResponse(t, server, "POST", other.URL+"?wait=true", bytes.NewBuffer(body))
+	body, _ = json.Marshal(map[string]interface{}{"input": "subscribed"})
+	getResponse(t, server, "POST", subscribed.URL+"?wait=true", bytes.NewBuffer(body))
+
+	out := readUntil(t, wsc, "Port", 1)
+	assert.Len(t, out, 1)
+	assert.Equal(t, map[string]interface{}{"data": "subscribed", "handle": subscribed.Handle, "isBOS": false, "isEOS": false, "port": ")output"}, out[0].Payload)
+
+	// Subscribing to unknown instances fails
+	wsc.WriteJSON(map[string]interface{}{"type": "subscribe", "id": "2", "handle": "unknown"})
+	reply = readUntil(t, wsc, "Reply", 1)[0]
+	assert.Contains(t, reply.Payload, "error")
+}
+
+func TestServer_Websocket_Push_Input(t *testing.T) {
+	server := newTestServer()
+	wsc := newWebsocketClient(t, server)
+	defer wsc.Close()
+	defer server.Close()
+
+	instance := startOperator(t, server, daemon.RunInstruction{Id: fixtureOperatorId, Props: core.Properties{}, Gens: core.Generics{}})
+
+	wsc.WriteJSON(map[string]interface{}{"type": "subscribe", "handle": instance.Handle})
+	readUntil(t, wsc, "Reply", 1)
+
+	wsc.WriteJSON(map[string]interface{}{"type": "push", "id": "1", "handle": instance.Handle, "data": map[string]interface{}{"input": "ws"}})
+	// Items not matching the type of the instance are rejected
+	wsc.WriteJSON(map[string]interface{}{"type": "push", "id": "2", "handle": instance.Handle, "data": map[string]interface{}{"wrong": 1}})
+
+	var outputs []interface{}
+	replies := make(map[string]map[string]interface{})
+	wsc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(outputs) < 1 || len(replies) < 2 {
+		for _, msg := range readOneMessage(t, wsc) {
+			payload := msg.Payload.(map[string]interface{})
+			if msg.Topic == "Port" {
+				outputs = append(outputs, payload["data"])
+			} else if msg.Topic == "Reply" {
+				replies[payload["id"].(string)] = payload
+			}
+		}
+	}
+	assert.Equal(t, []interface{}{"ws"}, outputs)
+	assert.Nil(t, replies["1"]["error"])
+	assert.NotNil(t, replies["2"]["error"])
+}
+
 func TestServer_List_Running_Instances(t *testing.T) {
 	server := newTestServer()
 	id := "8b62495a-e482-4a3e-8020-0ab8a350ad2d"
@@ -187,3 +275,104 @@ func TestServer_List_Running_Instances(t *testing.T) {
 	body, _ := ioutil.ReadAll(response.Body)
 	assert.Contains(t, string(body), id)
 }
+
+func TestServer_Export_Import_Operator(t *testing.T) {
+	exportServer := newTestServer()
+	defer exportServer.Close()
+
+	response := getResponse(t, exportServer, "GET", "/share/export?id=3ceccd71-0ea5-4aeb-957a-4dff1a419071", nil)
+	assert.Equal(t, 200, response.StatusCode)
+	archive, _ := ioutil.ReadAll(response.Body)
+
+	dir, _ := ioutil.TempDir("", "slang-import")
+	defer os.RemoveAll(dir)
+	importStorage := storage.NewStorage().AddBackend(storage.NewWritableFileSystem(dir))
+	importServer := newTestServerWithStorage(importStorage)
+	defer importServer.Close()
+
+	upload := func() *http.Response {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", "operator.zip")
+		fw.Write(archive)
+		mw.Close()
+
+		request, _ := http.NewRequest("POST", importServer.URL+"/share/import?conflict=rename", body)
+		request.Header.Set("Content-Type", mw.FormDataContentType())
+		response, err := importServer.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	id, _ := uuid.Parse("3ceccd71-0ea5-4aeb-957a-4dff1a419071")
+	response = upload()
+	assert.Equal(t, 200, response.StatusCode)
+	assert.True(t, importStorage.IsSavedInWritableBackend(id))
+
+	// Importing again results into a copy with a new id
+	response = upload()
+	assert.Equal(t, 200, response.StatusCode)
+	var out struct {
+		Data struct {
+			Renamed map[string]string `json:"renamed"`
+		} `json:"data"`
+	}
+	json.NewDecoder(response.Body).Decode(&out)
+	assert.Len(t, out.Data.Renamed, 1)
+	assert.Contains(t, out.Data.Renamed, id.String())
+}
+
+func TestServer_Restores_Persisted_Instances(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "slang-instances")
+	defer os.RemoveAll(dir)
+	registryFile := filepath.Join(dir, "instances.json")
+
+	handle := strings.Replace(uuid.New().String(), "-", "", -1)
+	failingHandle := strings.Replace(uuid.New().String(), "-", "", -1)
+	registry := []map[string]interface{}{
+		{"handle": handle, "operator": "3ceccd71-0ea5-4aeb-957a-4dff1a419071", "desiredState": "running"},
+		{"handle": failingHandle, "operator": uuid.New().String(), "desiredState": "running"},
+	}
+	b, _ := json.Marshal(registry)
+	ioutil.WriteFile(registryFile, b, 0644)
+
+	st := storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	assert.NoError(t, s.LoadInstances(registryFile))
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	var instances []struct {
+		Handle string `json:"handle"`
+		State  string `json:"state"`
+	}
+	response := getResponse(t, server, "GET", "/instances/", nil)
+	json.NewDecoder(response.Body).Decode(&instances)
+	states := make(map[string]string)
+	for _, ins := range instances {
+		states[ins.Handle] = ins.State
+	}
+	assert.Equal(t, "running", states[handle])
+	assert.Equal(t, "failed", states[failingHandle])
+
+	body, _ := json.Marshal(map[string]interface{}{"input": "restored"})
+	response = getResponse(t, server, "POST", "/instance/"+handle+"/?wait=true", bytes.NewBuffer(body))
+	assert.Equal(t, 200, response.StatusCode)
+	out, _ := ioutil.ReadAll(response.Body)
+	assert.JSONEq(t, `{"output":"restored"}`, string(out))
+
+	response = getResponse(t, server, "POST", "/instance/"+failingHandle+"/", bytes.NewBuffer(body))
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+	// Stopped instances which are kept are persisted with their desired state, others are removed
+	stopInstance(t, server, handle, true)
+	b, _ = ioutil.ReadFile(registryFile)
+	assert.Contains(t, string(b), `"desiredState": "stopped"`)
+
+	stopInstance(t, server, failingHandle, false)
+	b, _ = ioutil.ReadFile(registryFile)
+	assert.NotContains(t, string(b), failingHandle)
+}
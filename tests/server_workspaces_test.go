@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/core"
+	"github.com/Bitspark/slang/pkg/daemon"
+	"github.com/Bitspark/slang/pkg/env"
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func newWorkspacesTestServer(t *testing.T) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "slang-workspaces")
+	require.NoError(t, err)
+
+	st := storage.NewStorage().
+		AddBackend(storage.NewWritableFileSystem(filepath.Join(dir, "projects"))).
+		AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.LoadWorkspaces(filepath.Join(dir, "workspaces")))
+	return httptest.NewServer(s.Handler()), dir
+}
+
+func getResponseIn(t *testing.T, server *httptest.Server, workspace string, method string, url string, body interface{}) *http.Response {
+	b, _ := json.Marshal(body)
+	request, _ := http.NewRequest(method, server.URL+url, bytes.NewReader(b))
+	request.Header.Set("X-Slang-Workspace", workspace)
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func localBlueprintIds(t *testing.T, server *httptest.Server, workspace string) []uuid.UUID {
+	var operators struct {
+		Objects []struct {
+			Def  core.Blueprint `json:"def"`
+			Type string         `json:"type"`
+		} `json:"objects"`
+	}
+	json.NewDecoder(getResponseIn(t, server, workspace, "GET", "/operator/", nil).Body).Decode(&operators)
+	ids := make([]uuid.UUID, 0)
+	for _, obj := range operators.Objects {
+		if obj.Type == "local" {
+			ids = append(ids, obj.Def.Id)
+		}
+	}
+	return ids
+}
+
+func TestServer_Workspaces_Create_List_Delete(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	response := getResponse(t, server, "POST", "/workspaces/", bytes.NewBufferString(`{"name": "project-a"}`))
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = getResponse(t, server, "POST", "/workspaces/", bytes.NewBufferString(`{"name": "project-a"}`))
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	response = getResponse(t, server, "POST", "/workspaces/", bytes.NewBufferString(`{"name": "../escape"}`))
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	body, _ := ioutil.ReadAll(getResponse(t, server, "GET", "/workspaces/", nil).Body)
+	assert.JSONEq(t, `[{"name": "default", "default": true}, {"name": "project-a", "default": false}]`, string(body))
+
+	response = getResponse(t, server, "DELETE", "/workspaces/default/", nil)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	response = getResponse(t, server, "DELETE", "/workspaces/project-a/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	_, err := os.Stat(filepath.Join(dir, "workspaces", "project-a"))
+	assert.True(t, os.IsNotExist(err))
+
+	response = getResponseIn(t, server, "project-a", "GET", "/operator/", nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestServer_Workspaces_Separate_Blueprints_And_Instances(t *testing.T) {
+	server, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	getResponse(t, server, "POST", "/workspaces/", bytes.NewBufferString(`{"name": "project-a"}`))
+
+	st := storage.NewStorage().AddBackend(storage.NewReadOnlyFileSystem("../fixtures"))
+	bp, err := st.Load(fixtureOperatorId)
+	require.NoError(t, err)
+	bp.Id = uuid.New()
+
+	response := getResponseIn(t, server, "project-a", "POST", "/operator/def/", bp)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []uuid.UUID{bp.Id}, localBlueprintIds(t, server, "project-a"))
+	assert.Empty(t, localBlueprintIds(t, server, "default"))
+
+	ri := daemon.RunInstruction{Id: bp.Id, Props: core.Properties{}, Gens: core.Generics{}}
+	var rs daemon.RunState
+	json.NewDecoder(getResponseIn(t, server, "default", "POST", "/run/", ri).Body).Decode(&rs)
+	assert.Equal(t, "error", rs.Status)
+	json.NewDecoder(getResponseIn(t, server, "project-a", "POST", "/run/", ri).Body).Decode(&rs)
+	assert.Equal(t, "success", rs.Status)
+
+	// Instances keep the workspace they have been started in
+	getResponse(t, server, "POST", rs.URL+"stop", nil)
+	response = getResponse(t, server, "POST", rs.URL+"start", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response = getResponse(t, server, "DELETE", "/workspaces/project-a/", nil)
+	assert.Equal(t, http.StatusConflict, response.StatusCode)
+	stopInstance(t, server, rs.Handle, false)
+	response = getResponse(t, server, "DELETE", "/workspaces/project-a/", nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestServer_Blueprint_Changes_Are_Sent_Through_Websocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slang-watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage.WatchDelay = 50 * time.Millisecond
+	st := storage.NewStorage().AddBackend(storage.NewWritableFileSystem(filepath.Join(dir, "projects")))
+	ctx := daemon.SetStorage(context.Background(), st)
+	s := daemon.NewServer(&ctx, env.New("localhost", 8000))
+	require.NoError(t, s.LoadWorkspaces(filepath.Join(dir, "workspaces")))
+	require.NoError(t, s.WatchBlueprints())
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	getResponse(t, server, "POST", "/workspaces/", bytes.NewBufferString(`{"name": "project-a"}`))
+	wsc := newWebsocketClientIn(t, server, "project-a")
+	defer wsc.Close()
+	dflt := newWebsocketClient(t, server)
+	defer dflt.Close()
+
+	// Edited by hand
+	bp := fixtureCopy(t, "Edited")
+	content, _ := yaml.Marshal(bp)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "workspaces", "project-a", bp.Id.String()+".yaml"), content, 0644))
+
+	out := readUntil(t, wsc, "Operator", 1)
+	assert.Equal(t, map[string]interface{}{"kind": "added", "id": bp.Id.String(), "workspace": "project-a"}, out[0].Payload)
+
+	// Saved through the daemon, only clients of the default workspace are notified
+	bp.Meta.Name = "Saved"
+	getResponseIn(t, server, "", "POST", "/operator/def/", bp)
+	out = readUntil(t, dflt, "Operator", 1)
+	assert.Equal(t, map[string]interface{}{"kind": "added", "id": bp.Id.String(), "workspace": "default"}, out[0].Payload)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "workspaces", "project-a", bp.Id.String()+".yaml")))
+	out = readUntil(t, wsc, "Operator", 1)
+	assert.Equal(t, map[string]interface{}{"kind": "removed", "id": bp.Id.String(), "workspace": "project-a"}, out[0].Payload)
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bitspark/slang/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Remote_Reads_And_Writes_Through_Another_Daemon(t *testing.T) {
+	central, dir := newWorkspacesTestServer(t)
+	defer os.RemoveAll(dir)
+
+	remote := storage.NewWritableRemote(central.URL, "")
+	st := storage.NewStorage().AddBackend(remote)
+
+	bp, err := st.Load(fixtureOperatorId)
+	require.NoError(t, err)
+	assert.Equal(t, fixtureOperatorId, bp.Id)
+	ids, err := st.List()
+	require.NoError(t, err)
+	assert.Len(t, ids, 1, "elementary blueprints are not listed")
+
+	shared := fixtureCopy(t, "Shared")
+	_, err = st.Save(*shared)
+	require.NoError(t, err)
+	response := getResponseIn(t, central, "", "GET", fmt.Sprintf("/operator/%s/", shared.Id), nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// A daemon using the central daemon as library
+	client := newTestServerWithStorage(storage.NewStorage().AddBackend(storage.NewReadOnlyRemote(central.URL, "")))
+	defer client.Close()
+	var ops operatorsJSON
+	json.NewDecoder(getResponseIn(t, client, "", "GET", "/operator/?type=library&q=shared", nil).Body).Decode(&ops)
+	require.Equal(t, 1, ops.Total)
+	assert.Equal(t, shared.Id, ops.Objects[0].Def.Id)
+
+	// Blueprints are served from the cache while the central daemon is gone
+	ttl := storage.RemoteCacheTTL
+	storage.RemoteCacheTTL = 0
+	defer func() { storage.RemoteCacheTTL = ttl }()
+	central.Close()
+	assert.True(t, remote.Has(shared.Id))
+	_, err = remote.Load(shared.Id)
+	assert.NoError(t, err)
+	_, err = remote.Save(*shared)
+	assert.Error(t, err)
+}
+
+func TestStorage_Remote_Backs_Off_While_Unreachable(t *testing.T) {
+	backoff, maxBackoff := storage.RemoteRetryBackoff, storage.RemoteMaxRetryBackoff
+	storage.RemoteRetryBackoff, storage.RemoteMaxRetryBackoff = 200*time.Millisecond, time.Second
+	defer func() { storage.RemoteRetryBackoff, storage.RemoteMaxRetryBackoff = backoff, maxBackoff }()
+
+	var requests int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	remote := storage.NewReadOnlyRemote(unavailable.URL, "")
+	_, err := remote.List()
+	assert.Error(t, err)
+	assert.False(t, remote.Has(fixtureOperatorId))
+	_, err = remote.Load(fixtureOperatorId)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "the failure is cached")
+
+	time.Sleep(250 * time.Millisecond)
+	_, err = remote.List()
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// The backoff has doubled
+	time.Sleep(250 * time.Millisecond)
+	_, err = remote.List()
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}